@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/astralkn/k8s-logs-extractor/pkg/analyze"
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/checkpoint"
+	"github.com/astralkn/k8s-logs-extractor/pkg/compare"
+	"github.com/astralkn/k8s-logs-extractor/pkg/report"
+	"github.com/astralkn/k8s-logs-extractor/pkg/rules"
+	"github.com/astralkn/k8s-logs-extractor/pkg/search"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	"github.com/astralkn/k8s-logs-extractor/pkg/summarize"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// command works on a bundle extracted by a previous run.
+type command struct {
+	usage string
+	run   func(name string, args []string) error
+}
+
+var commands = map[string]command{
+	"report":    {"generate a static HTML report of a bundle", reportCommand},
+	"analyze":   {"look for common failures in a bundle and write " + analyze.FindingsFile, analyzeCommand},
+	"rules":     {"run the tests of a rules file against their fixture bundles", rulesCommand},
+	"compare":   {"report the objects added, removed and changed between two bundles", compareCommand},
+	"search":    {"find lines matching a regex in the container logs and describe files of a bundle", searchCommand},
+	"summarize": {"cluster the container logs of a bundle into templates and write " + summarize.SummaryFile, summarizeCommand},
+	"verify":    {"check the files of a bundle against its checksum manifest " + sink.ManifestFile, verifyCommand},
+}
+
+func commandsUsage() string {
+	var names []string
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, n := range names {
+		b.WriteString(fmt.Sprintf("    %-10s %s\n", n, commands[n].usage))
+	}
+	return b.String()
+}
+
+// parseCommandFlags parses the flags of a command, which takes the bundle directory as its only
+// argument.
+func parseCommandFlags(name string, flags *pflag.FlagSet, usage string, args []string) (string, error) {
+	flags.Usage = func() {
+		log.Errorf(`Usage:
+    %s [flags] %s
+Flags:
+`, name, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			return "", err
+		}
+		flags.Usage()
+		return "", err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return "", fmt.Errorf("expected 1 argument, got %d", flags.NArg())
+	}
+	return flags.Arg(0), nil
+}
+
+func reportCommand(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	out := flags.String("o", "", "set the report output directory, <bundle>/report by default")
+	dir, err := parseCommandFlags(name, flags, "<bundle dir>", args)
+	if err == pflag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b, err := bundle.Load(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load bundle %s: %v", dir, err)
+	}
+	if *out == "" {
+		*out = filepath.Join(dir, "report")
+	}
+	if err := report.Generate(b, *out); err != nil {
+		return err
+	}
+	log.Println("Report written to ", filepath.Join(*out, "index.html"))
+	return nil
+}
+
+// findingsTextFile holds the human readable summary of the findings, next to analyze.FindingsFile.
+const findingsTextFile = "findings.txt"
+
+func analyzeCommand(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	out := flags.String("o", "", "set the directory of "+analyze.FindingsFile+" and "+findingsTextFile+", the bundle directory by default")
+	rulesFile := flags.String("rules", "", "also evaluate the rules of this YAML file")
+	builtin := flags.Bool("builtin", true, "run the built-in checks")
+	dir, err := parseCommandFlags(name, flags, "<bundle dir>", args)
+	if err == pflag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var checks []analyze.Check
+	if *builtin {
+		checks = analyze.Checks()
+	}
+	if *rulesFile != "" {
+		rs, err := rules.Load(*rulesFile)
+		if err != nil {
+			return err
+		}
+		checks = append(checks, rules.Checks(rs)...)
+	}
+	b, err := bundle.Load(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load bundle %s: %v", dir, err)
+	}
+	if *out == "" {
+		*out = dir
+	}
+	return writeFindings(*out, analyze.Analyze(b, checks))
+}
+
+// writeFindings writes findings as JSON and as a summary to dir, and prints the summary.
+func writeFindings(dir string, findings []analyze.Finding) error {
+	var js, summary bytes.Buffer
+	if err := analyze.WriteJSON(&js, findings); err != nil {
+		return err
+	}
+	if err := analyze.WriteSummary(&summary, findings); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := sink.WriteFile(filepath.Join(dir, analyze.FindingsFile), js.Bytes()); err != nil {
+		return err
+	}
+	if err := sink.WriteFile(filepath.Join(dir, findingsTextFile), summary.Bytes()); err != nil {
+		return err
+	}
+	_, err := os.Stdout.Write(summary.Bytes())
+	return err
+}
+
+func rulesCommand(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	file, err := parseCommandFlags(name, flags, "<rules file>", args)
+	if err == pflag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rs, err := rules.Load(file)
+	if err != nil {
+		return err
+	}
+	failed, total := 0, 0
+	for _, res := range rules.RunTests(rs) {
+		fmt.Println(res)
+		total++
+		if !res.Passed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rule tests failed", failed, total)
+	}
+	log.Infof("%d rule tests passed", total)
+	return nil
+}
+
+func compareCommand(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	format := flags.String("format", compare.Text, "set the output format: text, json or html")
+	out := flags.String("o", "", "write the comparison to this file instead of stdout")
+	ignore := flags.StringArray("ignore-field", nil, "leave this field out of the comparison too, can be repeated, e.g. metadata.labels.pod-template-hash or spec.containers[].image")
+	flags.Usage = func() {
+		log.Errorf(`Usage:
+    %s [flags] <bundle dir A> <bundle dir B>
+Flags:
+`, name)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			return nil
+		}
+		flags.Usage()
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected 2 arguments, got %d", flags.NArg())
+	}
+	var bundles [2]*bundle.Bundle
+	for i, dir := range flags.Args() {
+		b, err := bundle.Load(dir)
+		if err != nil {
+			return fmt.Errorf("failed to load bundle %s: %v", dir, err)
+		}
+		bundles[i] = b
+	}
+	res, err := compare.Bundles(bundles[0], bundles[1], *ignore...)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return compare.Write(os.Stdout, res, *format)
+	}
+	var buf bytes.Buffer
+	if err := compare.Write(&buf, res, *format); err != nil {
+		return err
+	}
+	return sink.WriteFile(*out, buf.Bytes())
+}
+
+func searchCommand(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	q := search.Query{}
+	flags.StringVar(&q.Cluster, "cluster", "", "only search the sources of clusters matching this pattern")
+	flags.StringVar(&q.Namespace, "namespace", "", "only search the sources of namespaces matching this pattern")
+	flags.StringVar(&q.Pod, "pod", "", "only search the sources of pods, or described objects, matching this pattern")
+	flags.StringVar(&q.Container, "container", "", "only search the logs of containers matching this pattern")
+	flags.IntVarP(&q.Context, "context", "C", 0, "print this many lines around every match")
+	from := flags.String("from", "", "only match log lines timestamped at or after this RFC3339 time")
+	to := flags.String("to", "", "only match log lines timestamped at or before this RFC3339 time")
+	since := flags.Duration("since", 0, "only match log lines of this last period of the bundle, e.g. 1h")
+	ignoreCase := flags.BoolP("ignore-case", "i", false, "match the regex case-insensitively")
+	flags.Usage = func() {
+		log.Errorf(`Usage:
+    %s [flags] <bundle dir> <regex>
+Flags:
+`, name)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			return nil
+		}
+		flags.Usage()
+		return err
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected 2 arguments, got %d", flags.NArg())
+	}
+	dir, pattern := flags.Arg(0), flags.Arg(1)
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	var err error
+	if q.Pattern, err = regexp.Compile(pattern); err != nil {
+		return err
+	}
+	for _, t := range []struct {
+		value string
+		time  *time.Time
+	}{{*from, &q.From}, {*to, &q.To}} {
+		if t.value == "" {
+			continue
+		}
+		if *t.time, err = time.Parse(time.RFC3339, t.value); err != nil {
+			return fmt.Errorf("invalid time %q: %v", t.value, err)
+		}
+	}
+
+	b, err := bundle.Load(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load bundle %s: %v", dir, err)
+	}
+	idx, err := search.Open(b)
+	if err != nil {
+		return err
+	}
+	if *since > 0 {
+		// The window ends with the latest log line rather than now, since bundles are searched
+		// long after they were extracted.
+		var end time.Time
+		for _, s := range idx.Sources {
+			if s.Last.After(end) {
+				end = s.Last
+			}
+		}
+		q.From = end.Add(-*since)
+	}
+	results, err := search.Search(b.Dir, idx, q)
+	if err != nil {
+		return err
+	}
+	if err := search.Write(os.Stdout, results); err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		log.Info("No match found")
+	}
+	return nil
+}
+
+func summarizeCommand(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	opts := summarize.Options{}
+	flags.IntVar(&opts.Top, "top", 10, "set the number of templates listed per container")
+	flags.DurationVar(&opts.RestartWindow, "restart-window", 2*time.Minute, "count the lines written this close to a restart as near it")
+	dir, err := parseCommandFlags(name, flags, "<bundle dir>", args)
+	if err == pflag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	b, err := bundle.Load(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load bundle %s: %v", dir, err)
+	}
+	for _, c := range b.Clusters {
+		summaries, err := summarize.Cluster(c, opts)
+		if err != nil {
+			return fmt.Errorf("failed to summarize the logs of %s: %v", c.Name, err)
+		}
+		if summaries == nil {
+			summaries = []summarize.ContainerSummary{}
+		}
+		js, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return err
+		}
+		var text bytes.Buffer
+		if err := summarize.WriteText(&text, summaries); err != nil {
+			return err
+		}
+		if err := sink.WriteFile(filepath.Join(c.Dir, summarize.SummaryFile), append(js, '\n')); err != nil {
+			return err
+		}
+		if err := sink.WriteFile(filepath.Join(c.Dir, summarize.SummaryText), text.Bytes()); err != nil {
+			return err
+		}
+		if _, err := os.Stdout.Write(text.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyCommand(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	quiet := flags.BoolP("quiet", "q", false, "do not list the files the manifest does not cover")
+	dir, err := parseCommandFlags(name, flags, "<bundle dir>", args)
+	if err == pflag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v, err := sink.Verify(dir, checkpoint.File)
+	if err != nil {
+		return fmt.Errorf("failed to verify bundle %s: %v", dir, err)
+	}
+	for _, f := range v.Mismatched {
+		fmt.Printf("MISMATCH  %s\n", f)
+	}
+	for _, f := range v.Missing {
+		fmt.Printf("MISSING   %s\n", f)
+	}
+	if !*quiet {
+		for _, f := range v.Unlisted {
+			fmt.Printf("UNLISTED  %s\n", f)
+		}
+	}
+	if !v.OK() {
+		return fmt.Errorf("%d of %d files failed verification", len(v.Mismatched)+len(v.Missing), v.Checked)
+	}
+	log.Infof("%d files verified, %d not covered by %s", v.Checked, len(v.Unlisted), sink.ManifestFile)
+	return nil
+}
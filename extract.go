@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/checkpoint"
+	"github.com/astralkn/k8s-logs-extractor/pkg/extractor"
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	"github.com/astralkn/k8s-logs-extractor/pkg/redact"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	log "github.com/sirupsen/logrus"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// preflightFile holds the permission matrix of a cluster.
+const preflightFile = "preflight.out"
+
+// optionsMetadata are the effective options recorded in the bundle metadata.
+type optionsMetadata struct {
+	KubeConfigPath string              `json:"kubeConfigPath"`
+	Output         string              `json:"output"`
+	OutputType     string              `json:"outputType"`
+	Extractors     []string            `json:"extractors"`
+	ExtractorOpts  extractor.Options   `json:"extractorOptions"`
+	CLI            string              `json:"cli"`
+	CLIArgs        []string            `json:"cliArgs,omitempty"`
+	Impersonate    *kube.Impersonation `json:"impersonate,omitempty"`
+	Retry          kube.RetryPolicy    `json:"retry"`
+	Profile        string              `json:"profile,omitempty"`
+	S3Config       string              `json:"s3Config,omitempty"`
+	NormalizeLogs  bool                `json:"normalizeLogs,omitempty"`
+	Incremental    bool                `json:"incremental,omitempty"`
+	Resume         bool                `json:"resume,omitempty"`
+	PushURL        string              `json:"pushURL,omitempty"`
+	PushFormat     string              `json:"pushFormat,omitempty"`
+	PushHeaders    map[string]string   `json:"pushHeaders,omitempty"`
+}
+
+// metadata returns the options with secrets masked.
+func (o *options) metadata(regs []extractor.Registration) optionsMetadata {
+	m := optionsMetadata{
+		KubeConfigPath: o.kubeConfigPath,
+		Output:         outputLocation(o),
+		OutputType:     o.outputType,
+		ExtractorOpts:  o.extractorOpts,
+		NormalizeLogs:  o.normalizeLogs,
+		Incremental:    o.incremental,
+		Resume:         o.resume,
+		CLI:            o.cli.Binary,
+		CLIArgs:        redact.Args(o.cli.Args),
+		Retry:          o.retry,
+		Profile:        o.profile,
+		S3Config:       o.s3Config,
+		PushHeaders:    redact.StringMap(o.pushHeaders),
+	}
+	for _, r := range regs {
+		m.Extractors = append(m.Extractors, r.Name)
+	}
+	if o.impersonate.User != "" {
+		imp := o.impersonate
+		m.Impersonate = &imp
+	}
+	if o.pushURL != "" {
+		m.PushURL, m.PushFormat = redact.URL(o.pushURL), o.pushFormat
+	}
+	return m
+}
+
+func run(opts *options) (err error) {
+	start := time.Now()
+	if opts.incremental && opts.outputType != "dir" {
+		return fmt.Errorf("--incremental requires --output-type=dir")
+	}
+	if opts.resume && opts.outputType != "dir" {
+		return fmt.Errorf("--resume requires --output-type=dir")
+	}
+	if opts.resume && opts.incremental {
+		// The state of an interrupted incremental run is not saved, its log lines would be
+		// appended twice.
+		return fmt.Errorf("--resume cannot be combined with --incremental")
+	}
+	regs, err := extractor.Resolve(opts.selectedExtractors())
+	if err != nil {
+		return err
+	}
+	if regs, err = extractor.Configure(regs, opts.extractorOpts); err != nil {
+		return err
+	}
+	cliVersion, err := kube.CheckCLI(opts.cli)
+	if err != nil {
+		return err
+	}
+	log.Infof("Using %s %s", opts.cli.Binary, cliVersion)
+	var profile *kube.Profile
+	if opts.profile != "" {
+		if profile, err = kube.LoadProfile(opts.profile); err != nil {
+			return err
+		}
+	}
+	configs, err := getConfigs(opts.kubeConfigPath)
+	if err != nil {
+		return err
+	}
+	var progress *checkpoint.Checkpoint
+	if opts.outputType == "dir" {
+		if progress, err = checkpoint.Open(opts.outputFile, opts.resume); err != nil {
+			return fmt.Errorf("failed to open the checkpoint: %v", err)
+		}
+		defer progress.Close()
+	}
+	out, err := newSink(opts, progress)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+	meta := bundle.Metadata{ToolVersion: version, Options: opts.metadata(regs), Start: start}
+	var errs errs
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, cfg := range configs {
+		cluster := filepath.Base(cfg)
+		meta.Clusters = append(meta.Clusters, cluster)
+		if progress != nil && progress.Status(cluster, "") == checkpoint.Done {
+			log.Infof("%s: completed by a previous run, skipping", cluster)
+			continue
+		}
+		accOpts := profile.Options(cluster, kube.Options{CLI: opts.cli, Impersonate: opts.impersonate})
+		kacc, err := kube.NewAccessor(cfg, "", accOpts)
+		if err != nil {
+			// The clusters started before are still extracting, the others go on.
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("%s: %v", cluster, err))
+			mu.Unlock()
+			continue
+		}
+		acc := kube.NewRetrying(kacc, opts.retry)
+		var state *extractor.State
+		if opts.incremental {
+			if state, err = extractor.LoadState(filepath.Join(opts.outputFile, cluster, extractor.StateFile), start); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: failed to load the incremental state: %v", cluster, err))
+				mu.Unlock()
+				continue
+			}
+		}
+		clusterOut := sink.Prefix(out, cluster)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cerrs := extractCluster(cluster, acc, regs, clusterOut, meta.Options, state, progress); len(cerrs) > 0 {
+				mu.Lock()
+				errs = append(errs, cerrs...)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	meta.End = time.Now()
+	for _, e := range errs {
+		meta.Errors = append(meta.Errors, e.Error())
+	}
+	if err := writeJSON(out, bundle.MetadataFile, meta); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// extractCluster runs the extractors permitted by the preflight check against a single cluster
+// and records how it went in the metadata of the cluster. If state is set, the extractors
+// able to run incrementally do and the state is saved for the next run. If progress is set, the
+// extractors it records as done are skipped and the outcome of the others is recorded.
+func extractCluster(cluster string, acc kube.Interface, regs []extractor.Registration, out sink.Sink, opts interface{}, state *extractor.State, progress *checkpoint.Checkpoint) (errs errs) {
+	if progress != nil {
+		if err := progress.Start(cluster, ""); err != nil {
+			log.Warnf("%s: failed to update the checkpoint: %v", cluster, err)
+		}
+		defer func() {
+			var err error
+			if len(errs) > 0 {
+				err = errs
+			}
+			if err := progress.Finish(cluster, "", err); err != nil {
+				log.Warnf("%s: failed to update the checkpoint: %v", cluster, err)
+			}
+		}()
+	}
+	meta := clusterMetadata(cluster, acc, opts)
+	meta.Incremental = state != nil && state.Incremental()
+	var mu sync.Mutex
+	// unavailable tells, for the extractors that were skipped or failed as a whole, why their
+	// dependents cannot run.
+	unavailable := map[string]string{}
+	preflight, err := extractor.Preflight(acc, regs)
+	if err != nil {
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("permission preflight check skipped: %v", err))
+		log.Warnf("%s: skipping the permission preflight check: %v", cluster, err)
+	} else {
+		var matrix bytes.Buffer
+		_ = preflight.WriteMatrix(&matrix)
+		if err := out.Write(preflightFile, matrix.Bytes()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", cluster, err))
+		}
+		for _, r := range regs {
+			required, optional := preflight.Missing(r.Name)
+			if len(required) > 0 {
+				unavailable[r.Name] = "was skipped, missing permissions: " + permissions(required)
+				meta.Warnings = append(meta.Warnings, fmt.Sprintf("extractor %s skipped, missing permissions: %s", r.Name, permissions(required)))
+				log.Warnf("%s: skipping extractor %s, missing permissions: %s", cluster, r.Name, permissions(required))
+			} else if len(optional) > 0 {
+				meta.Warnings = append(meta.Warnings, fmt.Sprintf("extractor %s incomplete, missing permissions: %s", r.Name, permissions(optional)))
+				log.Warnf("%s: extractor %s will be incomplete, missing permissions: %s", cluster, r.Name, permissions(optional))
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	// failures are written to the errors file of the cluster, even if empty, so that it does not
+	// keep the failures of a previous run.
+	failures := extractor.ObjectErrors{}
+	done := make(map[string]chan struct{}, len(regs))
+	for _, r := range regs {
+		done[r.Name] = make(chan struct{})
+	}
+	meta.Extractors = make([]bundle.ExtractorRun, len(regs))
+	for i, r := range regs {
+		meta.Extractors[i].Name = r.Name
+		if reason, ok := unavailable[r.Name]; ok {
+			meta.Extractors[i].Skipped = true
+			meta.Extractors[i].SkipReason = strings.TrimPrefix(reason, "was skipped, ")
+			close(done[r.Name])
+			continue
+		}
+		if progress != nil && progress.Status(cluster, r.Name) == checkpoint.Done {
+			meta.Extractors[i].Resumed = true
+			close(done[r.Name])
+			continue
+		}
+		wg.Add(1)
+		go func(r extractor.Registration, run *bundle.ExtractorRun) {
+			defer wg.Done()
+			defer close(done[r.Name])
+			for _, d := range r.DependsOn {
+				<-done[d]
+			}
+			// A dependent of an extractor that did not run, or failed as a whole, would only
+			// write output that is missing its context, e.g. custom resources without their
+			// definitions.
+			mu.Lock()
+			for _, d := range r.DependsOn {
+				if reason, ok := unavailable[d]; ok {
+					run.Skipped, run.SkipReason = true, fmt.Sprintf("dependency %s %s", d, reason)
+					unavailable[r.Name] = "was skipped, " + run.SkipReason
+					failures = append(failures, extractor.ObjectError{Extractor: r.Name, Error: "skipped, " + run.SkipReason})
+					break
+				}
+			}
+			mu.Unlock()
+			if run.Skipped {
+				log.Warnf("%s: skipping extractor %s, %s", cluster, r.Name, run.SkipReason)
+				return
+			}
+			run.Start = time.Now()
+			if progress != nil {
+				if err := progress.Start(cluster, r.Name); err != nil {
+					log.Warnf("%s: failed to update the checkpoint: %v", cluster, err)
+				}
+			}
+			var err error
+			if inc, ok := r.Extractor.(extractor.IncrementalExtractor); ok && state != nil {
+				run.Incremental = state.Incremental()
+				err = inc.ExtractIncremental(acc, out, state)
+			} else {
+				err = r.Extractor.Extract(acc, out)
+			}
+			run.Duration = time.Since(run.Start)
+			if progress != nil {
+				if err := progress.Finish(cluster, r.Name, err); err != nil {
+					log.Warnf("%s: failed to update the checkpoint: %v", cluster, err)
+				}
+			}
+			if err != nil {
+				run.Error = err.Error()
+				mu.Lock()
+				if _, partial := err.(extractor.ObjectErrors); !partial {
+					unavailable[r.Name] = "failed: " + err.Error()
+				}
+				errs = append(errs, fmt.Errorf("%s: %s: %v", cluster, r.Name, err))
+				failures = append(failures, objectErrors(r.Name, err)...)
+				mu.Unlock()
+			}
+		}(r, &meta.Extractors[i])
+	}
+	wg.Wait()
+	if err := writeJSON(out, extractor.ErrorsFile, failures); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %v", cluster, err))
+	}
+	if state != nil {
+		if err := saveState(out, state); err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to save the incremental state: %v", cluster, err))
+		}
+	}
+	if r, ok := acc.(*kube.Retrying); ok {
+		meta.Retries = r.Records()
+		if len(meta.Retries) > 0 {
+			failed := 0
+			for _, rec := range meta.Retries {
+				if rec.Error != "" {
+					failed++
+				}
+			}
+			log.Infof("%s: %d calls retried, %d failed despite retries", cluster, len(meta.Retries), failed)
+		}
+	}
+	meta.End = time.Now()
+	if err := writeJSON(out, bundle.MetadataFile, meta); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %v", cluster, err))
+	}
+	return errs
+}
+
+// objectErrors returns the failures of an extractor as listed in the errors file: every object
+// that failed, or the extractor as a whole.
+func objectErrors(name string, err error) extractor.ObjectErrors {
+	oes, ok := err.(extractor.ObjectErrors)
+	if !ok {
+		return extractor.ObjectErrors{{Extractor: name, Error: err.Error()}}
+	}
+	failures := make(extractor.ObjectErrors, len(oes))
+	for i, oe := range oes {
+		oe.Extractor = name
+		failures[i] = oe
+	}
+	return failures
+}
+
+func saveState(out sink.Sink, state *extractor.State) error {
+	data, err := state.Marshal()
+	if err != nil {
+		return err
+	}
+	return out.Write(extractor.StateFile, data)
+}
+
+// clusterMetadata collects the version and size of the cluster. Failures only end up as
+// warnings, the metadata must not prevent the extraction.
+func clusterMetadata(cluster string, acc kube.Interface, opts interface{}) *bundle.ClusterMetadata {
+	meta := &bundle.ClusterMetadata{
+		Cluster:     cluster,
+		ToolVersion: version,
+		Identity:    acc.Identity(),
+		Options:     opts,
+		Start:       time.Now(),
+	}
+	var err error
+	if meta.ServerVersion, meta.Platform, err = acc.ServerVersion(); err != nil {
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("failed to get the server version: %v", err))
+	}
+	if meta.APIResources, err = acc.APIResources(); err != nil {
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("failed to list the api resources: %v", err))
+	}
+	if nodes, err := acc.ListNodes(); err != nil {
+		meta.Warnings = append(meta.Warnings, fmt.Sprintf("failed to list the nodes: %v", err))
+	} else {
+		meta.NodeCount = len(nodes.Items)
+	}
+	return meta
+}
+
+func permissions(ps []kube.Permission) string {
+	var s []string
+	for _, p := range ps {
+		s = append(s, p.String())
+	}
+	return strings.Join(s, ", ")
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/checkpoint"
 	"github.com/astralkn/k8s-logs-extractor/pkg/extractor"
 	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"io/ioutil"
@@ -13,7 +17,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-	"sync"
+	"text/tabwriter"
+	"time"
 )
 
 var (
@@ -22,6 +27,15 @@ var (
 
 func main() {
 	name := os.Args[0]
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd.run(name+" "+os.Args[1], os.Args[2:]); err != nil {
+				log.Error(err.Error())
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
 	flags, opts := setupFlags(name)
 	switch err := flags.Parse(os.Args[1:]); {
 	case err == pflag.ErrHelp:
@@ -37,13 +51,30 @@ func main() {
 		os.Exit(0)
 	}
 
+	if opts.listExtractors {
+		listExtractors()
+		os.Exit(0)
+	}
+
 	if err := run(opts); err != nil {
 		log.Error(err.Error())
 	} else {
-		log.Println("Logs extracted to ", opts.outputFile)
+		log.Println("Logs extracted to ", outputLocation(opts))
 	}
 }
 
+func outputLocation(opts *options) string {
+	switch opts.outputType {
+	case "tar.gz":
+		return archivePath(opts.outputFile)
+	case "s3":
+		return "s3 object " + opts.s3Key
+	case "stdout":
+		return "stdout"
+	}
+	return opts.outputFile
+}
+
 func getConfigs(kcPath string) ([]string, error) {
 	var configs []string
 	dir, err := ioutil.ReadDir(kcPath)
@@ -67,7 +98,7 @@ func getConfigs(kcPath string) ([]string, error) {
 		case mode.IsRegular():
 			if m.MatchString(fi.Name()) {
 				configs = append(configs, conf)
-				fmt.Println(conf)
+				log.Infof("Found kubeconfig %s", conf)
 			}
 		}
 	}
@@ -79,15 +110,17 @@ func getConfigs(kcPath string) ([]string, error) {
 }
 
 func setupFlags(name string) (*pflag.FlagSet, *options) {
-	opts := options{}
+	opts := options{retry: kube.DefaultRetryPolicy}
 	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
 	flags.SetInterspersed(false)
 	flags.Usage = func() {
 		log.Errorf(`Usage:
     %s [flags]
-Default options: all extractions enabled
+    %s <command> [flags]
+Commands:
+%sDefault extractors: %s
 Flags:
-`, name)
+`, name, name, commandsUsage(), strings.Join(extractor.Defaults(), ","))
 		flags.PrintDefaults()
 		log.Errorf(`
 `)
@@ -95,11 +128,36 @@ Flags:
 
 	flags.StringVar(&opts.kubeConfigPath, "kc", os.Getenv("HOME")+"/.kube/", "set cluster kubeconfig path")
 	flags.StringVar(&opts.outputFile, "o", "/cluster-logs/", "set logs output file")
+	flags.StringVar(&opts.outputType, "output-type", "dir", "set output type: dir, tar.gz, s3 or stdout")
+	flags.StringVar(&opts.s3Config, "s3-config", "", "set the JSON file holding the s3 endpoint, bucket, prefix and credentials")
+	flags.StringVar(&opts.pushURL, "push-url", "", "also push container logs and events to this Loki push API or HTTP endpoint")
+	flags.StringVar(&opts.pushFormat, "push-format", sink.PushLoki, "set the push payload format: loki or json")
+	flags.StringToStringVar(&opts.pushHeaders, "push-header", nil, "add a header to push requests, e.g. X-Scope-OrgID=tenant")
+	flags.StringVar(&opts.cli.Binary, "cli", kube.DefaultCLIBinary, "set the kubectl compatible binary to use, e.g. oc or /opt/kubectl-1.18/kubectl")
+	flags.StringArrayVar(&opts.cli.Args, "cli-arg", nil, "add a global argument to every cli call, e.g. --cli-arg=--request-timeout=30s")
+	flags.StringVar(&opts.impersonate.User, "as", "", "impersonate this user for every request")
+	flags.StringArrayVar(&opts.impersonate.Groups, "as-group", nil, "impersonate this group, can be repeated")
+	flags.StringVar(&opts.impersonate.UID, "as-uid", "", "impersonate this uid")
+	flags.StringVar(&opts.profile, "profile", "", "set the YAML file holding per cluster credentials and impersonation overrides")
+	flags.IntVar(&opts.retry.MaxAttempts, "retry-attempts", kube.DefaultRetryPolicy.MaxAttempts, "set the number of attempts of cluster calls failing with a transient error, 1 disables retries")
+	flags.DurationVar(&opts.retry.Backoff, "retry-backoff", kube.DefaultRetryPolicy.Backoff, "set the delay before the first retry, doubled with every attempt")
+	flags.DurationVar(&opts.retry.MaxBackoff, "retry-max-backoff", kube.DefaultRetryPolicy.MaxBackoff, "set the maximum delay between two attempts")
 	flags.BoolVar(&opts.version, "version", false, "show version and exit")
-	flags.BoolVar(&opts.pod, "no-pod", true, "do not extract pod logs option")
-	flags.BoolVar(&opts.cm, "no-cm", true, "do not extract config maps option")
-	flags.BoolVar(&opts.svc, "no-svc", true, "do not extract services option")
-	flags.BoolVar(&opts.crd, "no-crd", true, "do not extract crds option")
+	flags.StringSliceVar(&opts.extractors, "extractors", extractor.Defaults(), "comma separated list of extractors to run")
+	flags.BoolVar(&opts.normalizeLogs, "normalize-logs", false, "also write JSON and logfmt container logs as normalized NDJSON")
+	flags.BoolVar(&opts.resume, "resume", false, "resume the interrupted run in the output directory, skipping what it completed and retrying what failed")
+	flags.BoolVar(&opts.incremental, "incremental", false, "update the bundle of a previous run in the output directory, extracting only changed objects and new log lines")
+	flags.StringVar(&opts.extractorOpts.TimelineSelector, "timeline-selector", "", "merge the logs of the pods matching this label selector into a single timeline, e.g. app=api")
+	flags.StringSliceVar(&opts.extractorOpts.HelmNamespaces, "helm-namespaces", nil, "comma separated list of namespaces the helm extractor reads the releases from, all if empty")
+	flags.BoolVar(&opts.extractorOpts.Strict, "strict", false, "stop an extractor at the first object it fails to extract instead of listing the failures in "+extractor.ErrorsFile)
+	flags.BoolVar(&opts.listExtractors, "list-extractors", false, "list the available extractors and exit")
+	flags.BoolVar(&opts.noPod, "no-pod", false, "do not extract pod logs option")
+	flags.BoolVar(&opts.noCM, "no-cm", false, "do not extract config maps option")
+	flags.BoolVar(&opts.noSVC, "no-svc", false, "do not extract services option")
+	flags.BoolVar(&opts.noCRD, "no-crd", false, "do not extract crds option")
+	for _, f := range []string{"no-pod", "no-cm", "no-svc", "no-crd"} {
+		_ = flags.MarkDeprecated(f, "use --extractors instead")
+	}
 
 	return flags, &opts
 }
@@ -107,74 +165,131 @@ Flags:
 type options struct {
 	kubeConfigPath string
 	outputFile     string
+	outputType     string
+	s3Config       string
+	s3Key          string
+	pushURL        string
+	pushFormat     string
+	pushHeaders    map[string]string
+	cli            kube.CLI
+	impersonate    kube.Impersonation
+	retry          kube.RetryPolicy
+	profile        string
 	version        bool
-	pod            bool
-	cm             bool
-	svc            bool
-	crd            bool
+	extractors     []string
+	extractorOpts  extractor.Options
+	normalizeLogs  bool
+	incremental    bool
+	resume         bool
+	listExtractors bool
+	noPod          bool
+	noCM           bool
+	noSVC          bool
+	noCRD          bool
 }
 
-func run(opts *options) error {
-	configs, err := getConfigs(opts.kubeConfigPath)
+// selectedExtractors returns the extractors enabled by --extractors minus the ones
+// disabled by the deprecated --no-* flags.
+func (o *options) selectedExtractors() []string {
+	skip := map[string]bool{
+		"pods":       o.noPod,
+		"configmaps": o.noCM,
+		"services":   o.noSVC,
+		"crds":       o.noCRD,
+		"crs":        o.noCRD,
+	}
+	var names []string
+	for _, n := range o.extractors {
+		if n = strings.TrimSpace(n); n != "" && !skip[n] {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func listExtractors() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tDEFAULT\tDEPENDS ON\tDESCRIPTION")
+	for _, r := range extractor.Registered() {
+		_, _ = fmt.Fprintf(w, "%s\t%t\t%s\t%s\n", r.Name, r.Default, strings.Join(r.DependsOn, ","), r.Description)
+	}
+	_ = w.Flush()
+}
+
+// newSink creates the sink selected by --output-type, pushing logs to --push-url if set. The
+// checksums of the files written are recorded in the manifest of the bundle, and the files are
+// recorded in progress, if set.
+func newSink(opts *options, progress *checkpoint.Checkpoint) (sink.Sink, error) {
+	out, err := newOutputSink(opts)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	out = sink.NewChecksumSink(out)
+	if progress != nil {
+		out = checkpoint.Sink(out, progress, bundle.MetadataFile, preflightFile, extractor.StateFile, extractor.ErrorsFile)
 	}
-	var errs errs
-	var wg sync.WaitGroup
-	for _, cfg := range configs {
-		acc, err := kube.NewAccessor(cfg, "")
+	if opts.normalizeLogs {
+		out = sink.NewNormalizeSink(out)
+	}
+	if opts.pushURL == "" {
+		return out, nil
+	}
+	push, err := sink.NewPushSink(sink.PushConfig{
+		URL:        opts.pushURL,
+		Format:     opts.pushFormat,
+		Headers:    opts.pushHeaders,
+		MaxRetries: 5,
+	}, out)
+	if err != nil {
+		_ = out.Close()
+		return nil, err
+	}
+	return push, nil
+}
+
+func newOutputSink(opts *options) (sink.Sink, error) {
+	switch opts.outputType {
+	case "dir":
+		return sink.NewFileSink(opts.outputFile), nil
+	case "tar.gz":
+		return sink.NewTarGzFile(archivePath(opts.outputFile))
+	case "s3":
+		cfg, err := sink.LoadS3Config(opts.s3Config)
 		if err != nil {
-			return err
-		}
-		str := strings.Split(cfg, "/")
-		cluster := str[len(str)-1]
-		if opts.pod {
-			wg.Add(1)
-			go func(acc *kube.Accessor, outputFile, clusterName string) {
-				err := extractor.PodExtractor{}.Extract(acc, filepath.Join(outputFile, clusterName))
-				if err != nil {
-					errs = append(errs, err)
-				}
-				defer wg.Done()
-			}(acc, opts.outputFile, cluster)
-		}
-		if opts.cm {
-			wg.Add(1)
-			go func(acc *kube.Accessor, outputFile, clusterName string) {
-				err := extractor.CMExtractor{}.Extract(acc, filepath.Join(outputFile, clusterName))
-				if err != nil {
-					errs = append(errs, err)
-				}
-				defer wg.Done()
-
-			}(acc, opts.outputFile, cluster)
+			return nil, err
 		}
-		if opts.svc {
-			wg.Add(1)
-			go func(acc *kube.Accessor, outputFile, clusterName string) {
-				err := extractor.SVCExtractor{}.Extract(acc, filepath.Join(outputFile, clusterName))
-				if err != nil {
-					errs = append(errs, err)
-				}
-				defer wg.Done()
-			}(acc, opts.outputFile, cluster)
-		}
-		if opts.crd {
-			wg.Add(1)
-			go func(acc *kube.Accessor, outputFile, clusterName string) {
-				err := extractor.CRDExtractor{}.Extract(acc, filepath.Join(outputFile, clusterName))
-				if err != nil {
-					errs = append(errs, err)
-				}
-				defer wg.Done()
-			}(acc, opts.outputFile, cluster)
+		c, err := sink.NewS3Client(cfg)
+		if err != nil {
+			return nil, err
 		}
+		opts.s3Key = c.Key(s3ObjectName(opts.outputFile, time.Now()))
+		return sink.NewS3Sink(c, opts.s3Key), nil
+	case "stdout":
+		return sink.NewStdoutSink(), nil
 	}
-	wg.Wait()
-	if len(errs) > 0 {
-		return errs
+	return nil, fmt.Errorf("unknown output type %q", opts.outputType)
+}
+
+// archivePath turns the output location into the path of a tar.gz archive.
+func archivePath(output string) string {
+	if strings.HasSuffix(output, ".tar.gz") || strings.HasSuffix(output, ".tgz") {
+		return output
+	}
+	return strings.TrimSuffix(output, "/") + ".tar.gz"
+}
+
+// s3ObjectName returns the name of the uploaded archive, made unique by the time of the run.
+func s3ObjectName(output string, t time.Time) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(archivePath(output)), ".tgz"), ".tar.gz")
+	return fmt.Sprintf("%s-%s.tar.gz", name, t.UTC().Format("20060102T150405Z"))
+}
+
+func writeJSON(out sink.Sink, name string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
 	}
-	return nil
+	return out.Write(name, append(b, '\n'))
 }
 
 type errs []error
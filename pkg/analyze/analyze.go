@@ -0,0 +1,130 @@
+// Package analyze looks for common failures in the objects of an extracted bundle.
+package analyze
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+)
+
+// FindingsFile is written at the root of the analyzed bundle.
+const FindingsFile = "findings.json"
+
+// Severity of a finding.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	Info    Severity = "info"
+)
+
+func (s Severity) rank() int {
+	switch s {
+	case Error:
+		return 0
+	case Warning:
+		return 1
+	}
+	return 2
+}
+
+// Finding is a problem found in a bundle, together with the object that triggered it.
+type Finding struct {
+	// Rule identifies the check or the user rule that produced the finding.
+	Rule      string   `json:"rule"`
+	Severity  Severity `json:"severity"`
+	Cluster   string   `json:"cluster"`
+	Namespace string   `json:"namespace,omitempty"`
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Message   string   `json:"message"`
+}
+
+// Object returns the object of the finding in the form namespace/kind/name.
+func (f Finding) Object() string {
+	obj := strings.ToLower(f.Kind) + "/" + f.Name
+	if f.Namespace != "" {
+		obj = f.Namespace + "/" + obj
+	}
+	return obj
+}
+
+// Check looks for one kind of failure in a cluster.
+type Check struct {
+	Name        string
+	Description string
+	Run         func(c *bundle.Cluster) []Finding
+}
+
+// Analyze runs checks against every cluster of b. The findings are sorted by severity, cluster
+// and object.
+func Analyze(b *bundle.Bundle, checks []Check) []Finding {
+	var findings []Finding
+	for _, c := range b.Clusters {
+		for _, check := range checks {
+			for _, f := range check.Run(c) {
+				f.Rule, f.Cluster = check.Name, c.Name
+				findings = append(findings, f)
+			}
+		}
+	}
+	Sort(findings)
+	return findings
+}
+
+// Sort orders findings by severity, cluster, object and rule.
+func Sort(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity.rank() != b.Severity.rank() {
+			return a.Severity.rank() < b.Severity.rank()
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Object() != b.Object() {
+			return a.Object() < b.Object()
+		}
+		return a.Rule < b.Rule
+	})
+}
+
+// WriteJSON writes findings as a JSON array.
+func WriteJSON(w io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	b, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteSummary writes a human readable summary of findings.
+func WriteSummary(w io.Writer, findings []Finding) error {
+	counts := map[Severity]int{}
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	if _, err := fmt.Fprintf(w, "%d findings: %d errors, %d warnings, %d info\n\n",
+		len(findings), counts[Error], counts[Warning], counts[Info]); err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "SEVERITY\tCLUSTER\tOBJECT\tRULE\tMESSAGE")
+	for _, f := range findings {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", strings.ToUpper(string(f.Severity)), f.Cluster, f.Object(), f.Rule, f.Message)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,250 @@
+package analyze
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	kubeApiCore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Checks returns the built-in checks.
+func Checks() []Check {
+	return []Check{
+		{"crash-loop", "containers restarting in CrashLoopBackOff", crashLoops},
+		{"oom-killed", "containers killed for running out of memory", oomKills},
+		{"image-pull", "containers failing to pull their image", imagePulls},
+		{"unschedulable", "pods the scheduler cannot place", unschedulable},
+		{"failing-probe", "liveness, readiness or startup probes reported failing by events", failingProbes},
+		{"failed-mount", "volumes failing to attach or mount reported by events", failedMounts},
+		{"node-not-ready", "nodes not reporting Ready", notReadyNodes},
+		{"no-ready-endpoints", "services selecting pods without any ready address", noReadyEndpoints},
+	}
+}
+
+var imagePullReasons = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// containers calls fn with every container status of the pods of c.
+func containers(c *bundle.Cluster, fn func(pod kubeApiCore.Pod, cs kubeApiCore.ContainerStatus) *Finding) []Finding {
+	var findings []Finding
+	for _, ns := range c.Namespaces {
+		for _, pod := range ns.Pods {
+			statuses := append(append([]kubeApiCore.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+			for _, cs := range statuses {
+				if f := fn(pod, cs); f != nil {
+					findings = append(findings, *f)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+func podFinding(pod kubeApiCore.Pod, sev Severity, format string, args ...interface{}) *Finding {
+	return &Finding{Severity: sev, Namespace: pod.Namespace, Kind: "Pod", Name: pod.Name, Message: fmt.Sprintf(format, args...)}
+}
+
+func crashLoops(c *bundle.Cluster) []Finding {
+	return containers(c, func(pod kubeApiCore.Pod, cs kubeApiCore.ContainerStatus) *Finding {
+		if cs.State.Waiting == nil || cs.State.Waiting.Reason != "CrashLoopBackOff" {
+			return nil
+		}
+		msg := fmt.Sprintf("container %s is crash looping after %d restarts", cs.Name, cs.RestartCount)
+		if t := cs.LastTerminationState.Terminated; t != nil {
+			msg += fmt.Sprintf(", last exit code %d", t.ExitCode)
+			if t.Reason != "" {
+				msg += " (" + t.Reason + ")"
+			}
+		}
+		return podFinding(pod, Error, "%s", msg)
+	})
+}
+
+func oomKills(c *bundle.Cluster) []Finding {
+	return containers(c, func(pod kubeApiCore.Pod, cs kubeApiCore.ContainerStatus) *Finding {
+		for _, state := range []kubeApiCore.ContainerState{cs.State, cs.LastTerminationState} {
+			if state.Terminated == nil || state.Terminated.Reason != "OOMKilled" {
+				continue
+			}
+			if at := state.Terminated.FinishedAt; !at.IsZero() {
+				return podFinding(pod, Error, "container %s was OOM killed at %s", cs.Name, at.UTC().Format(time.RFC3339))
+			}
+			return podFinding(pod, Error, "container %s was OOM killed", cs.Name)
+		}
+		return nil
+	})
+}
+
+func imagePulls(c *bundle.Cluster) []Finding {
+	return containers(c, func(pod kubeApiCore.Pod, cs kubeApiCore.ContainerStatus) *Finding {
+		if cs.State.Waiting == nil || !imagePullReasons[cs.State.Waiting.Reason] {
+			return nil
+		}
+		image := cs.Image
+		for _, c := range append(append([]kubeApiCore.Container(nil), pod.Spec.InitContainers...), pod.Spec.Containers...) {
+			if c.Name == cs.Name && image == "" {
+				image = c.Image
+			}
+		}
+		return podFinding(pod, Error, "container %s cannot pull image %s: %s", cs.Name, image,
+			strings.TrimSpace(cs.State.Waiting.Reason+" "+cs.State.Waiting.Message))
+	})
+}
+
+func unschedulable(c *bundle.Cluster) []Finding {
+	var findings []Finding
+	for _, ns := range c.Namespaces {
+		for _, pod := range ns.Pods {
+			for _, cond := range pod.Status.Conditions {
+				if cond.Type == kubeApiCore.PodScheduled && cond.Status == kubeApiCore.ConditionFalse &&
+					cond.Reason == kubeApiCore.PodReasonUnschedulable {
+					findings = append(findings, *podFinding(pod, Warning, "pod cannot be scheduled: %s", cond.Message))
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// failingProbes reports the Unhealthy events the kubelet records for failed probes. Repeated
+// events of an object are reported once.
+func failingProbes(c *bundle.Cluster) []Finding {
+	var findings []Finding
+	seen := map[string]bool{}
+	for _, ns := range c.Namespaces {
+		for _, e := range ns.Events {
+			if e.Reason != "Unhealthy" || !strings.Contains(e.Message, "probe failed") {
+				continue
+			}
+			probe := strings.ToLower(strings.Fields(e.Message)[0])
+			key := e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name + "/" + probe
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			findings = append(findings, Finding{
+				Severity:  Warning,
+				Namespace: e.InvolvedObject.Namespace,
+				Kind:      e.InvolvedObject.Kind,
+				Name:      e.InvolvedObject.Name,
+				Message:   fmt.Sprintf("%s (%d times)", e.Message, count(e)),
+			})
+		}
+	}
+	return findings
+}
+
+// failedMounts reports the FailedAttachVolume and FailedMount events recorded when a volume of a
+// pod cannot be attached to its node or mounted. Repeated events of an object are reported once.
+func failedMounts(c *bundle.Cluster) []Finding {
+	var findings []Finding
+	seen := map[string]bool{}
+	for _, ns := range c.Namespaces {
+		for _, e := range ns.Events {
+			if e.Reason != "FailedMount" && e.Reason != "FailedAttachVolume" {
+				continue
+			}
+			key := e.InvolvedObject.Kind + "/" + e.InvolvedObject.Name + "/" + e.Reason
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			findings = append(findings, Finding{
+				Severity:  Error,
+				Namespace: e.InvolvedObject.Namespace,
+				Kind:      e.InvolvedObject.Kind,
+				Name:      e.InvolvedObject.Name,
+				Message:   fmt.Sprintf("%s: %s (%d times)", e.Reason, e.Message, count(e)),
+			})
+		}
+	}
+	return findings
+}
+
+func count(e kubeApiCore.Event) int32 {
+	if e.Count == 0 {
+		return 1
+	}
+	return e.Count
+}
+
+func notReadyNodes(c *bundle.Cluster) []Finding {
+	var findings []Finding
+	for _, n := range c.Nodes {
+		ready := false
+		msg := "node does not report a Ready condition"
+		for _, cond := range n.Status.Conditions {
+			if cond.Type != kubeApiCore.NodeReady {
+				continue
+			}
+			ready = cond.Status == kubeApiCore.ConditionTrue
+			msg = strings.TrimSpace("node is not ready: " + cond.Reason + " " + cond.Message)
+		}
+		if !ready {
+			findings = append(findings, Finding{Severity: Error, Kind: "Node", Name: n.Name, Message: strings.TrimSuffix(msg, ":")})
+		}
+	}
+	return findings
+}
+
+// noReadyEndpoints reports services with a selector but no ready address. The extracted
+// Endpoints are used when present, otherwise the ready pods matching the selector are counted.
+func noReadyEndpoints(c *bundle.Cluster) []Finding {
+	var findings []Finding
+	for _, ns := range c.Namespaces {
+		endpoints := map[string]kubeApiCore.Endpoints{}
+		for _, ep := range ns.Endpoints {
+			endpoints[ep.Name] = ep
+		}
+		for _, svc := range ns.Services {
+			if len(svc.Spec.Selector) == 0 || svc.Spec.Type == kubeApiCore.ServiceTypeExternalName {
+				continue
+			}
+			var ready, notReady int
+			if ep, ok := endpoints[svc.Name]; ok {
+				for _, s := range ep.Subsets {
+					ready += len(s.Addresses)
+					notReady += len(s.NotReadyAddresses)
+				}
+			} else if len(ns.Endpoints) == 0 {
+				sel := labels.SelectorFromSet(svc.Spec.Selector)
+				for _, pod := range ns.Pods {
+					if !sel.Matches(labels.Set(pod.Labels)) {
+						continue
+					}
+					if podReady(pod) {
+						ready++
+					} else {
+						notReady++
+					}
+				}
+			}
+			if ready == 0 {
+				findings = append(findings, Finding{
+					Severity:  Warning,
+					Namespace: svc.Namespace,
+					Kind:      "Service",
+					Name:      svc.Name,
+					Message:   fmt.Sprintf("service has no ready endpoints (%d not ready) for selector %s", notReady, labels.SelectorFromSet(svc.Spec.Selector)),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func podReady(pod kubeApiCore.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == kubeApiCore.PodReady {
+			return cond.Status == kubeApiCore.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package analyze
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func pod(name string, status kubeApiCore.PodStatus) kubeApiCore.Pod {
+	return kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": name}},
+		Spec:       kubeApiCore.PodSpec{Containers: []kubeApiCore.Container{{Name: "app", Image: "registry/app:1"}}},
+		Status:     status,
+	}
+}
+
+func waiting(reason, message string) kubeApiCore.PodStatus {
+	return kubeApiCore.PodStatus{ContainerStatuses: []kubeApiCore.ContainerStatus{{
+		Name:  "app",
+		State: kubeApiCore.ContainerState{Waiting: &kubeApiCore.ContainerStateWaiting{Reason: reason, Message: message}},
+	}}}
+}
+
+func ready(status kubeApiCore.ConditionStatus) kubeApiCore.PodStatus {
+	return kubeApiCore.PodStatus{Conditions: []kubeApiCore.PodCondition{{Type: kubeApiCore.PodReady, Status: status}}}
+}
+
+func event(kind, name, reason, message string, count int32) kubeApiCore.Event {
+	return kubeApiCore.Event{
+		InvolvedObject: kubeApiCore.ObjectReference{Kind: kind, Namespace: "default", Name: name},
+		Reason:         reason,
+		Message:        message,
+		Count:          count,
+	}
+}
+
+func service(name string) kubeApiCore.Service {
+	return kubeApiCore.Service{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       kubeApiCore.ServiceSpec{Selector: map[string]string{"app": name}},
+	}
+}
+
+func namespace(ns bundle.Namespace) *bundle.Cluster {
+	ns.Name = "default"
+	return &bundle.Cluster{Name: "prod", Namespaces: []*bundle.Namespace{&ns}}
+}
+
+func podFindings(sev Severity, name string, messages ...string) []Finding {
+	var findings []Finding
+	for _, m := range messages {
+		findings = append(findings, Finding{Severity: sev, Namespace: "default", Kind: "Pod", Name: name, Message: m})
+	}
+	return findings
+}
+
+func TestChecks(t *testing.T) {
+	oomAt := kubeApiMeta.NewTime(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	tests := []struct {
+		check   string
+		name    string
+		cluster *bundle.Cluster
+		want    []Finding
+	}{
+		{
+			check: "crash-loop",
+			name:  "with last exit code",
+			cluster: namespace(bundle.Namespace{Pods: []kubeApiCore.Pod{
+				pod("web", kubeApiCore.PodStatus{ContainerStatuses: []kubeApiCore.ContainerStatus{{
+					Name:                 "app",
+					RestartCount:         5,
+					State:                kubeApiCore.ContainerState{Waiting: &kubeApiCore.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+					LastTerminationState: kubeApiCore.ContainerState{Terminated: &kubeApiCore.ContainerStateTerminated{ExitCode: 137, Reason: "Error"}},
+				}}}),
+				pod("ok", waiting("ContainerCreating", "")),
+			}}),
+			want: podFindings(Error, "web", "container app is crash looping after 5 restarts, last exit code 137 (Error)"),
+		},
+		{
+			check: "crash-loop",
+			name:  "init container",
+			cluster: namespace(bundle.Namespace{Pods: []kubeApiCore.Pod{
+				pod("web", kubeApiCore.PodStatus{InitContainerStatuses: []kubeApiCore.ContainerStatus{{
+					Name:         "migrate",
+					RestartCount: 2,
+					State:        kubeApiCore.ContainerState{Waiting: &kubeApiCore.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				}}}),
+			}}),
+			want: podFindings(Error, "web", "container migrate is crash looping after 2 restarts"),
+		},
+		{
+			check: "oom-killed",
+			name:  "last termination",
+			cluster: namespace(bundle.Namespace{Pods: []kubeApiCore.Pod{
+				pod("web", kubeApiCore.PodStatus{ContainerStatuses: []kubeApiCore.ContainerStatus{{
+					Name:                 "app",
+					LastTerminationState: kubeApiCore.ContainerState{Terminated: &kubeApiCore.ContainerStateTerminated{Reason: "OOMKilled", FinishedAt: oomAt}},
+				}}}),
+				pod("batch", kubeApiCore.PodStatus{ContainerStatuses: []kubeApiCore.ContainerStatus{{
+					Name:  "app",
+					State: kubeApiCore.ContainerState{Terminated: &kubeApiCore.ContainerStateTerminated{Reason: "OOMKilled"}},
+				}}}),
+				pod("done", kubeApiCore.PodStatus{ContainerStatuses: []kubeApiCore.ContainerStatus{{
+					Name:  "app",
+					State: kubeApiCore.ContainerState{Terminated: &kubeApiCore.ContainerStateTerminated{Reason: "Completed"}},
+				}}}),
+			}}),
+			want: append(podFindings(Error, "web", "container app was OOM killed at 2024-03-01T10:00:00Z"),
+				podFindings(Error, "batch", "container app was OOM killed")...),
+		},
+		{
+			check: "image-pull",
+			name:  "image taken from the spec",
+			cluster: namespace(bundle.Namespace{Pods: []kubeApiCore.Pod{
+				pod("web", waiting("ImagePullBackOff", "Back-off pulling image")),
+				pod("crash", waiting("CrashLoopBackOff", "")),
+			}}),
+			want: podFindings(Error, "web", "container app cannot pull image registry/app:1: ImagePullBackOff Back-off pulling image"),
+		},
+		{
+			check: "unschedulable",
+			name:  "pod scheduled false",
+			cluster: namespace(bundle.Namespace{Pods: []kubeApiCore.Pod{
+				pod("web", kubeApiCore.PodStatus{Conditions: []kubeApiCore.PodCondition{{
+					Type:    kubeApiCore.PodScheduled,
+					Status:  kubeApiCore.ConditionFalse,
+					Reason:  kubeApiCore.PodReasonUnschedulable,
+					Message: "0/3 nodes are available: 3 Insufficient cpu.",
+				}}}),
+				pod("ok", kubeApiCore.PodStatus{Conditions: []kubeApiCore.PodCondition{{Type: kubeApiCore.PodScheduled, Status: kubeApiCore.ConditionTrue}}}),
+			}}),
+			want: podFindings(Warning, "web", "pod cannot be scheduled: 0/3 nodes are available: 3 Insufficient cpu."),
+		},
+		{
+			check: "failing-probe",
+			name:  "repeated events reported once",
+			cluster: namespace(bundle.Namespace{Events: []kubeApiCore.Event{
+				event("Pod", "web", "Unhealthy", "Readiness probe failed: HTTP probe failed with statuscode: 503", 12),
+				event("Pod", "web", "Unhealthy", "Readiness probe failed: connection refused", 1),
+				event("Pod", "web", "Unhealthy", "Liveness probe failed: timeout", 0),
+				event("Pod", "web", "BackOff", "Back-off restarting failed container", 3),
+			}}),
+			want: podFindings(Warning, "web",
+				"Readiness probe failed: HTTP probe failed with statuscode: 503 (12 times)",
+				"Liveness probe failed: timeout (1 times)"),
+		},
+		{
+			check: "failed-mount",
+			name:  "attach and mount",
+			cluster: namespace(bundle.Namespace{Events: []kubeApiCore.Event{
+				event("Pod", "db", "FailedAttachVolume", "Multi-Attach error for volume \"pvc-1\"", 4),
+				event("Pod", "db", "FailedMount", "Unable to attach or mount volumes: timed out waiting for the condition", 2),
+				event("Pod", "db", "FailedMount", "MountVolume.SetUp failed for volume \"config\": configmap \"db\" not found", 7),
+				event("Pod", "web", "SuccessfulAttachVolume", "AttachVolume.Attach succeeded", 1),
+			}}),
+			want: podFindings(Error, "db",
+				"FailedAttachVolume: Multi-Attach error for volume \"pvc-1\" (4 times)",
+				"FailedMount: Unable to attach or mount volumes: timed out waiting for the condition (2 times)"),
+		},
+		{
+			check: "node-not-ready",
+			name:  "not ready and unknown",
+			cluster: &bundle.Cluster{Nodes: []kubeApiCore.Node{
+				{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "node-1"}, Status: kubeApiCore.NodeStatus{Conditions: []kubeApiCore.NodeCondition{
+					{Type: kubeApiCore.NodeReady, Status: kubeApiCore.ConditionTrue},
+				}}},
+				{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "node-2"}, Status: kubeApiCore.NodeStatus{Conditions: []kubeApiCore.NodeCondition{
+					{Type: kubeApiCore.NodeReady, Status: kubeApiCore.ConditionUnknown, Reason: "NodeStatusUnknown", Message: "Kubelet stopped posting node status."},
+				}}},
+				{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "node-3"}},
+			}},
+			want: []Finding{
+				{Severity: Error, Kind: "Node", Name: "node-2", Message: "node is not ready: NodeStatusUnknown Kubelet stopped posting node status."},
+				{Severity: Error, Kind: "Node", Name: "node-3", Message: "node does not report a Ready condition"},
+			},
+		},
+		{
+			check: "no-ready-endpoints",
+			name:  "from the endpoints",
+			cluster: namespace(bundle.Namespace{
+				Services: []kubeApiCore.Service{service("web"), service("api")},
+				Endpoints: []kubeApiCore.Endpoints{
+					{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "web"}, Subsets: []kubeApiCore.EndpointSubset{{
+						NotReadyAddresses: []kubeApiCore.EndpointAddress{{IP: "10.1.0.5"}},
+					}}},
+					{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "api"}, Subsets: []kubeApiCore.EndpointSubset{{
+						Addresses: []kubeApiCore.EndpointAddress{{IP: "10.1.0.6"}},
+					}}},
+				},
+			}),
+			want: []Finding{{Severity: Warning, Namespace: "default", Kind: "Service", Name: "web",
+				Message: "service has no ready endpoints (1 not ready) for selector app=web"}},
+		},
+		{
+			check: "no-ready-endpoints",
+			name:  "from the pods without endpoints",
+			cluster: namespace(bundle.Namespace{
+				Services: []kubeApiCore.Service{service("web"), service("api"), {ObjectMeta: kubeApiMeta.ObjectMeta{Name: "headless"}}},
+				Pods:     []kubeApiCore.Pod{pod("web", ready(kubeApiCore.ConditionFalse)), pod("api", ready(kubeApiCore.ConditionTrue))},
+			}),
+			want: []Finding{{Severity: Warning, Namespace: "default", Kind: "Service", Name: "web",
+				Message: "service has no ready endpoints (1 not ready) for selector app=web"}},
+		},
+	}
+	checks := map[string]Check{}
+	for _, c := range Checks() {
+		checks[c.Name] = c
+	}
+	tested := map[string]bool{}
+	for _, tt := range tests {
+		tested[tt.check] = true
+		t.Run(tt.check+"/"+tt.name, func(t *testing.T) {
+			check, ok := checks[tt.check]
+			if !ok {
+				t.Fatalf("check %s is not built in", tt.check)
+			}
+			if got := check.Run(tt.cluster); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %+v\nwant %+v", got, tt.want)
+			}
+			// A cluster without any problem has no findings.
+			if got := check.Run(&bundle.Cluster{}); len(got) != 0 {
+				t.Errorf("findings of an empty cluster = %+v", got)
+			}
+		})
+	}
+	for name := range checks {
+		if !tested[name] {
+			t.Errorf("check %s is not tested", name)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	b := &bundle.Bundle{Clusters: []*bundle.Cluster{
+		namespace(bundle.Namespace{Pods: []kubeApiCore.Pod{pod("web", waiting("ErrImagePull", ""))}}),
+		{Name: "staging", Nodes: []kubeApiCore.Node{{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "node-1"}}}},
+	}}
+	b.Clusters[0].Namespaces[0].Events = []kubeApiCore.Event{event("Pod", "web", "Unhealthy", "Liveness probe failed: timeout", 2)}
+	var got []string
+	for _, f := range Analyze(b, Checks()) {
+		got = append(got, string(f.Severity)+" "+f.Cluster+" "+f.Object()+" "+f.Rule)
+	}
+	want := []string{
+		"error prod default/pod/web image-pull",
+		"error staging node/node-1 node-not-ready",
+		"warning prod default/pod/web failing-probe",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,327 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Files written by kubectl cluster-info dump --output=yaml, relative to the cluster or to
+// the directory of a namespace.
+const (
+	NodesFile    = "nodes.yaml"
+	PodsFile     = "pods.yaml"
+	EventsFile   = "events.yaml"
+	ServicesFile = "services.yaml"
+	// EndpointsFile is not part of the dump. It is optional, the endpoints of a namespace are
+	// empty without it.
+	EndpointsFile = "endpoints.yaml"
+	// dumpLogFile holds the logs of a pod, or of a single container in newer kubectl versions.
+	dumpLogFile = "logs.txt"
+)
+
+// Bundle is an extracted bundle loaded from disk.
+type Bundle struct {
+	Dir      string
+	Metadata *Metadata
+	Clusters []*Cluster
+}
+
+// Cluster holds the objects extracted from one cluster.
+type Cluster struct {
+	Name       string
+	Dir        string
+	Metadata   *ClusterMetadata
+	Nodes      []kubeApiCore.Node
+	Namespaces []*Namespace
+}
+
+// Namespace holds the objects of one namespace of a cluster.
+type Namespace struct {
+	Name      string
+	Pods      []kubeApiCore.Pod
+	Events    []kubeApiCore.Event
+	Services  []kubeApiCore.Service
+	Endpoints []kubeApiCore.Endpoints
+}
+
+// Load reads the bundle extracted to dir. dir may also be the directory of a single cluster.
+func Load(dir string) (*Bundle, error) {
+	b := &Bundle{Dir: dir}
+	if isCluster(dir) {
+		c, err := LoadCluster(dir)
+		if err != nil {
+			return nil, err
+		}
+		b.Clusters = append(b.Clusters, c)
+		return b, nil
+	}
+	meta := &Metadata{}
+	switch err := readJSON(filepath.Join(dir, MetadataFile), meta); {
+	case err == nil:
+		b.Metadata = meta
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		sub := filepath.Join(dir, e.Name())
+		if !e.IsDir() || !isCluster(sub) {
+			continue
+		}
+		c, err := LoadCluster(sub)
+		if err != nil {
+			return nil, err
+		}
+		b.Clusters = append(b.Clusters, c)
+	}
+	if len(b.Clusters) == 0 {
+		return nil, fmt.Errorf("no cluster found in %s", dir)
+	}
+	return b, nil
+}
+
+// isCluster reports whether dir holds the files of a cluster.
+func isCluster(dir string) bool {
+	for _, f := range []string{NodesFile, MetadataFile, "pods.out"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			meta := &Metadata{}
+			// The metadata of the run sits at the root of the bundle and lists the clusters.
+			if f == MetadataFile && readJSON(filepath.Join(dir, f), meta) == nil && len(meta.Clusters) > 0 {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// LoadCluster reads the files of the cluster extracted to dir. Missing files are skipped, since
+// the extractors producing them may not have run.
+func LoadCluster(dir string) (*Cluster, error) {
+	c := &Cluster{Name: filepath.Base(dir), Dir: dir}
+	meta := &ClusterMetadata{}
+	switch err := readJSON(filepath.Join(dir, MetadataFile), meta); {
+	case err == nil:
+		c.Metadata = meta
+		if meta.Cluster != "" {
+			c.Name = meta.Cluster
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	nodes := &kubeApiCore.NodeList{}
+	if err := readYAML(filepath.Join(dir, NodesFile), nodes); err != nil {
+		return nil, err
+	}
+	c.Nodes = nodes.Items
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		ns, err := loadNamespace(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if ns != nil {
+			c.Namespaces = append(c.Namespaces, ns)
+		}
+	}
+	return c, nil
+}
+
+// loadNamespace reads the namespace dumped to dir, or returns nil if dir is not a namespace.
+func loadNamespace(dir string) (*Namespace, error) {
+	found := false
+	for _, f := range []string{PodsFile, EventsFile, ServicesFile, EndpointsFile} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	ns := &Namespace{Name: filepath.Base(dir)}
+	pods := &kubeApiCore.PodList{}
+	events := &kubeApiCore.EventList{}
+	services := &kubeApiCore.ServiceList{}
+	endpoints := &kubeApiCore.EndpointsList{}
+	for f, obj := range map[string]interface{}{PodsFile: pods, EventsFile: events, ServicesFile: services, EndpointsFile: endpoints} {
+		if err := readYAML(filepath.Join(dir, f), obj); err != nil {
+			return nil, err
+		}
+	}
+	ns.Pods, ns.Events, ns.Services, ns.Endpoints = pods.Items, events.Items, services.Items, endpoints.Items
+	return ns, nil
+}
+
+// Namespace returns the namespace called name, or nil.
+func (c *Cluster) Namespace(name string) *Namespace {
+	for _, ns := range c.Namespaces {
+		if ns.Name == name {
+			return ns
+		}
+	}
+	return nil
+}
+
+// LogFile is a container log found in a cluster directory.
+type LogFile struct {
+	Path      string
+	Namespace string
+	Pod       string
+	// Container is empty for the per pod logs of older kubectl cluster-info dumps.
+	Container string
+	Previous  bool
+}
+
+// LogFiles returns the container logs of the cluster, both the ones of the logs extractor and
+// the ones of cluster-info dump.
+func (c *Cluster) LogFiles() ([]LogFile, error) {
+	var files []LogFile
+	err := filepath.Walk(c.Dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(c.Dir, p)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		switch {
+		case len(parts) == 4 && parts[0] == "logs" && strings.HasSuffix(parts[3], ".log"):
+			name := strings.TrimSuffix(parts[3], ".log")
+			lf := LogFile{Path: p, Namespace: parts[1], Pod: parts[2], Container: strings.TrimSuffix(name, ".previous")}
+			lf.Previous = lf.Container != name
+			files = append(files, lf)
+		case len(parts) == 3 && parts[2] == dumpLogFile:
+			files = append(files, LogFile{Path: p, Namespace: parts[0], Pod: parts[1]})
+		case len(parts) == 4 && parts[3] == dumpLogFile && parts[0] != "logs":
+			files = append(files, LogFile{Path: p, Namespace: parts[0], Pod: parts[1], Container: parts[2]})
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, err
+}
+
+// Objects returns the objects of the YAML lists of the cluster, i.e. nodes.yaml and the lists
+// in the directories of the namespaces, e.g. deployments.yaml. Events are left out.
+func (c *Cluster) Objects() ([]unstructured.Unstructured, error) {
+	files := []string{filepath.Join(c.Dir, NodesFile)}
+	for _, ns := range c.Namespaces {
+		matches, err := filepath.Glob(filepath.Join(c.Dir, ns.Name, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if filepath.Base(m) != EventsFile {
+				files = append(files, m)
+			}
+		}
+	}
+	var objs []unstructured.Unstructured
+	for _, f := range files {
+		list := map[string]interface{}{}
+		if err := readYAML(f, &list); err != nil {
+			return nil, err
+		}
+		items, _ := list["items"].([]interface{})
+		kind := fileKind(f, list)
+		for _, item := range items {
+			content, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			obj := unstructured.Unstructured{Object: content}
+			// Items of a typed list, e.g. a PodList, do not carry their kind.
+			if obj.GetKind() == "" {
+				obj.SetKind(kind)
+			}
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
+
+// listKinds maps the files of kubectl cluster-info dump to the kind of their items.
+var listKinds = map[string]string{
+	"nodes":                  "Node",
+	"pods":                   "Pod",
+	"services":               "Service",
+	"endpoints":              "Endpoints",
+	"replicationcontrollers": "ReplicationController",
+	"deployments":            "Deployment",
+	"replicasets":            "ReplicaSet",
+	"daemonsets":             "DaemonSet",
+	"statefulsets":           "StatefulSet",
+}
+
+// fileKind returns the kind of the items of the list read from path.
+func fileKind(path string, list map[string]interface{}) string {
+	if kind, _ := list["kind"].(string); kind != "" && kind != "List" {
+		return strings.TrimSuffix(kind, "List")
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if kind, ok := listKinds[name]; ok {
+		return kind
+	}
+	return name
+}
+
+// LineTime returns the timestamp kubectl logs --timestamps prefixes a line with, and the rest of
+// the line.
+func LineTime(line string) (time.Time, string, bool) {
+	i := strings.IndexByte(line, ' ')
+	if i < 20 {
+		return time.Time{}, line, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, line[:i])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return t, line[i+1:], true
+}
+
+func readJSON(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// readYAML decodes the file at path into v. A missing file leaves v untouched.
+func readYAML(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
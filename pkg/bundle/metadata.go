@@ -0,0 +1,57 @@
+// Package bundle describes the layout of the extracted files.
+package bundle
+
+import (
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+)
+
+// MetadataFile is written at the root of a bundle and in the directory of every cluster.
+const MetadataFile = "metadata.json"
+
+// Metadata describes a run of the tool.
+type Metadata struct {
+	ToolVersion string      `json:"toolVersion"`
+	Options     interface{} `json:"options"`
+	Start       time.Time   `json:"start"`
+	End         time.Time   `json:"end"`
+	Clusters    []string    `json:"clusters"`
+	Errors      []string    `json:"errors,omitempty"`
+}
+
+// ClusterMetadata describes what was extracted from a cluster, and how.
+type ClusterMetadata struct {
+	Cluster       string        `json:"cluster"`
+	ToolVersion   string        `json:"toolVersion"`
+	ServerVersion string        `json:"serverVersion,omitempty"`
+	Platform      string        `json:"platform,omitempty"`
+	NodeCount     int           `json:"nodeCount"`
+	APIResources  []string      `json:"apiResources,omitempty"`
+	Identity      kube.Identity `json:"identity"`
+	Options       interface{}   `json:"options"`
+	Start         time.Time     `json:"start"`
+	End           time.Time     `json:"end"`
+	// Incremental is set if the run updated the bundle of a previous run, see the state file.
+	Incremental bool           `json:"incremental,omitempty"`
+	Extractors  []ExtractorRun `json:"extractors"`
+	// Retries lists the calls to the cluster that failed with a transient error and were retried.
+	Retries  []kube.RetryRecord `json:"retries,omitempty"`
+	Warnings []string           `json:"warnings,omitempty"`
+}
+
+// ExtractorRun records the outcome of an extractor on a cluster.
+type ExtractorRun struct {
+	Name    string `json:"name"`
+	Skipped bool   `json:"skipped,omitempty"`
+	// SkipReason tells why the extractor was skipped, e.g. a missing permission or a failed
+	// dependency.
+	SkipReason string `json:"skipReason,omitempty"`
+	// Resumed is set if a previous, interrupted run completed the extractor.
+	Resumed bool `json:"resumed,omitempty"`
+	// Incremental is set if the extractor only extracted what changed since the previous run.
+	Incremental bool          `json:"incremental,omitempty"`
+	Start       time.Time     `json:"start,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Error       string        `json:"error,omitempty"`
+}
@@ -0,0 +1,162 @@
+// Package checkpoint records the progress of an extraction so that an interrupted run can be
+// resumed.
+package checkpoint
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// File is the checkpoint, at the root of the output directory. It is a journal with one JSON
+// entry per line, so that a crash loses at most the entry being written.
+const File = "checkpoint.ndjson"
+
+// Status of a unit of work.
+const (
+	Running = "running"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// entry is a line of the journal. It records either the status of a unit, a cluster or an
+// extractor run against a cluster, or a completed file.
+type entry struct {
+	Time      time.Time `json:"time"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Extractor string    `json:"extractor,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	File      string    `json:"file,omitempty"`
+	// Sum is the SHA-256 of the completed file, hex encoded.
+	Sum string `json:"sha256,omitempty"`
+}
+
+// Checkpoint records the progress of a run. It is safe for concurrent use.
+type Checkpoint struct {
+	mu    sync.Mutex
+	f     *os.File
+	units map[string]entry
+	// files are the SHA-256 of the files completed by the previous runs, keyed by path.
+	files map[string]string
+}
+
+// Open opens the checkpoint of the output directory dir. When resuming, the progress recorded by
+// the previous runs is loaded and kept, otherwise the checkpoint starts over.
+func Open(dir string, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{units: map[string]entry{}, files: map[string]string{}}
+	path := filepath.Join(dir, File)
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		if err := c.load(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c.f = f
+	return c, nil
+}
+
+// load replays the journal at path. A truncated last line, left by a crash, is ignored.
+func (c *Checkpoint) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		if e.File != "" && e.Sum != "" {
+			c.files[e.File] = e.Sum
+		} else if e.File == "" {
+			c.units[unitKey(e.Cluster, e.Extractor)] = e
+		}
+	}
+	return sc.Err()
+}
+
+func unitKey(cluster, extractor string) string {
+	return cluster + "/" + extractor
+}
+
+// Status returns the last recorded status of the run of extractor against cluster, or of the
+// cluster as a whole if extractor is empty. It is empty if the unit was never started.
+func (c *Checkpoint) Status(cluster, extractor string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.units[unitKey(cluster, extractor)].Status
+}
+
+// Start records that the run of extractor against cluster, or the cluster if extractor is
+// empty, started.
+func (c *Checkpoint) Start(cluster, extractor string) error {
+	return c.record(entry{Cluster: cluster, Extractor: extractor, Status: Running})
+}
+
+// Finish records the outcome of a unit started with Start.
+func (c *Checkpoint) Finish(cluster, extractor string, err error) error {
+	e := entry{Cluster: cluster, Extractor: extractor, Status: Done}
+	if err != nil {
+		e.Status, e.Error = Failed, err.Error()
+	}
+	return c.record(e)
+}
+
+// FileDone records that the file at path, whose SHA-256 is sum, was written completely.
+func (c *Checkpoint) FileDone(path, sum string) error {
+	return c.record(entry{File: path, Sum: sum})
+}
+
+// Completed reports whether a previous run completed the file at path. Files recorded without
+// their checksum, by older versions, are not complete, since the manifest could not list them.
+func (c *Checkpoint) Completed(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.files[path] != ""
+}
+
+// Files returns the SHA-256 of the files completed by the previous runs, keyed by path.
+func (c *Checkpoint) Files() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files := make(map[string]string, len(c.files))
+	for name, sum := range c.files {
+		files[name] = sum
+	}
+	return files
+}
+
+func (c *Checkpoint) record(e entry) error {
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.File == "" {
+		c.units[unitKey(e.Cluster, e.Extractor)] = e
+	}
+	_, err = c.f.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the journal.
+func (c *Checkpoint) Close() error {
+	return c.f.Close()
+}
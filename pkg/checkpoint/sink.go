@@ -0,0 +1,73 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+)
+
+// Sink records in c the files written to next, and skips the files a previous run completed.
+// Files named one of rewritten, at the root of the bundle or of a cluster, describe the run
+// itself: they are written by every run and not recorded.
+//
+// The files are recorded with their checksum. If next is a sink.Checksummer, it is given the
+// checksums of the files completed by the previous runs, which are skipped and never reach it, so
+// that the manifest of a resumed run still lists them.
+func Sink(next sink.Sink, c *Checkpoint, rewritten ...string) sink.Sink {
+	r := map[string]bool{}
+	for _, name := range rewritten {
+		r[name] = true
+	}
+	if cs, ok := next.(sink.Checksummer); ok {
+		for name, sum := range c.Files() {
+			cs.RecordChecksum(name, sum)
+		}
+	}
+	return &checkpointSink{next: next, c: c, rewritten: r}
+}
+
+type checkpointSink struct {
+	next      sink.Sink
+	c         *Checkpoint
+	rewritten map[string]bool
+}
+
+func (s *checkpointSink) isRewritten(name string) bool {
+	return strings.Count(name, "/") <= 1 && s.rewritten[path.Base(name)]
+}
+
+func (s *checkpointSink) Write(name string, data []byte) error {
+	name, err := sink.Clean(name)
+	if err != nil {
+		return err
+	}
+	if s.isRewritten(name) {
+		return s.next.Write(name, data)
+	}
+	if s.c.Completed(name) {
+		return nil
+	}
+	if err := s.next.Write(name, data); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	return s.c.FileDone(name, hex.EncodeToString(sum[:]))
+}
+
+// Append appends to next. Appended files are not recorded, they are complete after every
+// append.
+func (s *checkpointSink) Append(name string, data []byte) error {
+	return sink.Append(s.next, name, data)
+}
+
+func (s *checkpointSink) Completed(name string) bool {
+	name, err := sink.Clean(name)
+	return err == nil && !s.isRewritten(name) && s.c.Completed(name)
+}
+
+func (s *checkpointSink) Close() error {
+	return s.next.Close()
+}
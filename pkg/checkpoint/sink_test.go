@@ -0,0 +1,100 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+)
+
+func newSink(t *testing.T, dir string, resume bool) (sink.Sink, *Checkpoint) {
+	c, err := Open(dir, resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Sink(sink.NewChecksumSink(sink.NewFileSink(dir)), c, "metadata.json"), c
+}
+
+// A run resumed after a crash skips the files completed before it, and still lists them in the
+// manifest.
+func TestResumeAfterCrash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out, c := newSink(t, dir, false)
+	for name, data := range map[string]string{
+		"metadata.json":                   "{}",
+		"prod/pods.out":                   "web-1",
+		"prod/logs/default/web-1/app.log": "started\n",
+	} {
+		if err := out.Write(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The run crashes: the journal is left behind, the manifest is never written.
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, c = newSink(t, dir, true)
+	defer c.Close()
+	if !sink.Completed(out, "prod/logs/default/web-1/app.log") {
+		t.Fatal("completed log not reported as completed")
+	}
+	for name, data := range map[string]string{
+		"metadata.json":  `{"resumed":true}`,
+		"prod/pods.out":  "changed",
+		"prod/nodes.out": "node-1",
+	} {
+		if err := out.Write(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := sink.Verify(dir, File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.OK() || v.Checked != 4 || len(v.Unlisted) > 0 {
+		t.Errorf("Verify() = %+v, want the 4 files of the bundle intact", v)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "prod", "pods.out"))
+	if err != nil || string(data) != "web-1" {
+		t.Errorf("completed file replaced by the resumed run: %q, %v", data, err)
+	}
+}
+
+// Files recorded without their checksum cannot be listed in the manifest, they are written again.
+func TestFilesWithoutChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journal := `{"file":"prod/pods.out"}
+{"file":"prod/nodes.out","sha256":"abc"}
+{"file":"prod/trunc`
+	if err := ioutil.WriteFile(filepath.Join(dir, File), []byte(journal), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Open(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Completed("prod/pods.out") || !c.Completed("prod/nodes.out") {
+		t.Errorf("Completed() = %v, %v, want false, true", c.Completed("prod/pods.out"), c.Completed("prod/nodes.out"))
+	}
+	if want := map[string]string{"prod/nodes.out": "abc"}; !reflect.DeepEqual(c.Files(), want) {
+		t.Errorf("Files() = %v, want %v", c.Files(), want)
+	}
+}
@@ -0,0 +1,305 @@
+// Package compare reports the differences between the objects of two bundles.
+package compare
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Result holds the differences between bundle A and bundle B.
+type Result struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	// OnlyA and OnlyB list the clusters found in a single bundle.
+	OnlyA    []string      `json:"onlyA,omitempty"`
+	OnlyB    []string      `json:"onlyB,omitempty"`
+	Clusters []ClusterDiff `json:"clusters"`
+}
+
+// ClusterDiff holds the differences between the objects of a cluster in both bundles.
+type ClusterDiff struct {
+	Cluster string       `json:"cluster"`
+	OnlyA   []Object     `json:"onlyA,omitempty"`
+	OnlyB   []Object     `json:"onlyB,omitempty"`
+	Changed []ObjectDiff `json:"changed,omitempty"`
+}
+
+// Object identifies an object of a cluster.
+type Object struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+func (o Object) String() string {
+	s := strings.ToLower(o.Kind) + "/" + o.Name
+	if o.Namespace != "" {
+		s = o.Namespace + "/" + s
+	}
+	return s
+}
+
+// ObjectDiff lists the fields of an object that differ.
+type ObjectDiff struct {
+	Object
+	Changes []Change `json:"changes"`
+}
+
+// Change is a field with different values in A and B. A missing field has a nil value.
+type Change struct {
+	Path string      `json:"path"`
+	A    interface{} `json:"a"`
+	B    interface{} `json:"b"`
+}
+
+// IgnoredFields differ between two instances of the same object, change on every write or
+// status update, or are assigned by the cluster, and say nothing about the object. In a path,
+// [] stands for any element of a list.
+var IgnoredFields = []string{
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.managedFields",
+	"metadata.selfLink",
+	"metadata.ownerReferences[].uid",
+	"spec.nodeName",
+	"status.hostIP",
+	"status.podIP",
+	"status.podIPs",
+	"status.containerStatuses[].containerID",
+	"status.containerStatuses[].imageID",
+	"status.initContainerStatuses[].containerID",
+	"status.initContainerStatuses[].imageID",
+}
+
+// listElement matches the index or the name of a list element in a path.
+var listElement = regexp.MustCompile(`\[[^\]]*\]`)
+
+// Bundles compares the clusters of a and b. Clusters are paired by name, or with each other if
+// both bundles hold a single cluster. The fields in IgnoredFields and ignore are left out.
+func Bundles(a, b *bundle.Bundle, ignore ...string) (*Result, error) {
+	res := &Result{A: a.Dir, B: b.Dir}
+	pairs := map[string][2]*bundle.Cluster{}
+	if len(a.Clusters) == 1 && len(b.Clusters) == 1 {
+		name := a.Clusters[0].Name
+		if b.Clusters[0].Name != name {
+			name += " / " + b.Clusters[0].Name
+		}
+		pairs[name] = [2]*bundle.Cluster{a.Clusters[0], b.Clusters[0]}
+	} else {
+		for _, c := range a.Clusters {
+			p := pairs[c.Name]
+			p[0] = c
+			pairs[c.Name] = p
+		}
+		for _, c := range b.Clusters {
+			p := pairs[c.Name]
+			p[1] = c
+			pairs[c.Name] = p
+		}
+	}
+	var names []string
+	for name := range pairs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := pairs[name]
+		switch {
+		case p[1] == nil:
+			res.OnlyA = append(res.OnlyA, name)
+		case p[0] == nil:
+			res.OnlyB = append(res.OnlyB, name)
+		default:
+			d, err := Clusters(p[0], p[1], ignore...)
+			if err != nil {
+				return nil, err
+			}
+			d.Cluster = name
+			res.Clusters = append(res.Clusters, *d)
+		}
+	}
+	return res, nil
+}
+
+// Clusters compares the objects of two clusters. The fields in IgnoredFields and ignore are
+// left out.
+func Clusters(a, b *bundle.Cluster, ignore ...string) (*ClusterDiff, error) {
+	ignored := ignoredFields(ignore)
+	objsA, err := objects(a)
+	if err != nil {
+		return nil, err
+	}
+	objsB, err := objects(b)
+	if err != nil {
+		return nil, err
+	}
+	d := &ClusterDiff{Cluster: a.Name}
+	for id, oa := range objsA {
+		ob, ok := objsB[id]
+		if !ok {
+			d.OnlyA = append(d.OnlyA, id)
+			continue
+		}
+		var changes []Change
+		diff("", oa.Object, ob.Object, ignored, &changes)
+		if len(changes) > 0 {
+			d.Changed = append(d.Changed, ObjectDiff{Object: id, Changes: changes})
+		}
+	}
+	for id := range objsB {
+		if _, ok := objsA[id]; !ok {
+			d.OnlyB = append(d.OnlyB, id)
+		}
+	}
+	sortObjects(d.OnlyA)
+	sortObjects(d.OnlyB)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].String() < d.Changed[j].String() })
+	return d, nil
+}
+
+func objects(c *bundle.Cluster) (map[Object]unstructured.Unstructured, error) {
+	list, err := c.Objects()
+	if err != nil {
+		return nil, err
+	}
+	objs := map[Object]unstructured.Unstructured{}
+	for _, o := range list {
+		objs[Object{Kind: o.GetKind(), Namespace: o.GetNamespace(), Name: o.GetName()}] = o
+	}
+	return objs, nil
+}
+
+func sortObjects(objs []Object) {
+	sort.Slice(objs, func(i, j int) bool { return objs[i].String() < objs[j].String() })
+}
+
+// diff appends the differences between a and b to changes. Lists of objects with a name, e.g.
+// containers, env or ports, are compared by name, other lists by index. The fields of ignored,
+// see isIgnored, are left out.
+func diff(path string, a, b interface{}, ignored map[string]bool, changes *[]Change) {
+	if isIgnored(path, ignored) {
+		return
+	}
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, k := range keys(va, vb) {
+			diff(join(path, k), va[k], vb[k], ignored, changes)
+		}
+		return
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		if na, nb, ok := byName(va, vb); ok {
+			for _, k := range keys(na, nb) {
+				diff(fmt.Sprintf("%s[%s]", path, k), na[k], nb[k], ignored, changes)
+			}
+			return
+		}
+		for i := 0; i < len(va) || i < len(vb); i++ {
+			var ea, eb interface{}
+			if i < len(va) {
+				ea = va[i]
+			}
+			if i < len(vb) {
+				eb = vb[i]
+			}
+			diff(fmt.Sprintf("%s[%d]", path, i), ea, eb, ignored, changes)
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Path: path, A: a, B: b})
+	}
+}
+
+// ignoredFields returns IgnoredFields and ignore, with the list elements written [].
+func ignoredFields(ignore []string) map[string]bool {
+	fields := map[string]bool{}
+	for _, f := range append(append([]string(nil), IgnoredFields...), ignore...) {
+		fields[listElement.ReplaceAllString(f, "[]")] = true
+	}
+	return fields
+}
+
+// isIgnored reports whether the field at path is left out of the comparison: the fields in
+// ignored, where the list elements are written [], and the timestamps of the status, e.g.
+// status.conditions[Ready].lastProbeTime.
+func isIgnored(path string, ignored map[string]bool) bool {
+	if ignored[listElement.ReplaceAllString(path, "[]")] {
+		return true
+	}
+	if !strings.HasPrefix(path, "status.") {
+		return false
+	}
+	field := path[strings.LastIndex(path, ".")+1:]
+	return strings.HasSuffix(field, "Time") || strings.HasSuffix(field, "Timestamp") ||
+		field == "startedAt" || field == "finishedAt" || field == "startTime"
+}
+
+// byName indexes the elements of a and b by their name, or by their type for conditions. It
+// reports false if an element has neither or if names repeat.
+func byName(a, b []interface{}) (map[string]interface{}, map[string]interface{}, bool) {
+	index := func(list []interface{}) (map[string]interface{}, bool) {
+		m := map[string]interface{}{}
+		for _, e := range list {
+			obj, ok := e.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			name, _ := obj["name"].(string)
+			if name == "" {
+				name, _ = obj["type"].(string)
+			}
+			if _, dup := m[name]; name == "" || dup {
+				return nil, false
+			}
+			m[name] = e
+		}
+		return m, true
+	}
+	if len(a) == 0 && len(b) == 0 {
+		return nil, nil, false
+	}
+	na, ok := index(a)
+	if !ok {
+		return nil, nil, false
+	}
+	nb, ok := index(b)
+	return na, nb, ok
+}
+
+func keys(a, b map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var ks []string
+	for _, m := range []map[string]interface{}{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				ks = append(ks, k)
+			}
+		}
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
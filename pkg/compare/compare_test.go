@@ -0,0 +1,113 @@
+package compare
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+const podA = `
+metadata:
+  name: api-1
+  uid: 1111
+  resourceVersion: "10"
+  generation: 1
+  creationTimestamp: "2024-03-01T10:00:00Z"
+  labels: {app: api, pod-template-hash: abc}
+  ownerReferences:
+  - {kind: ReplicaSet, name: api-abc, uid: aaaa}
+spec:
+  nodeName: node-1
+  containers:
+  - {name: api, image: "api:1.2"}
+  - {name: proxy, image: "proxy:1.0"}
+status:
+  hostIP: 10.0.0.1
+  podIP: 10.1.0.5
+  podIPs: [{ip: 10.1.0.5}]
+  startTime: "2024-03-01T10:00:00Z"
+  conditions:
+  - {type: Ready, status: "True", lastTransitionTime: "2024-03-01T10:00:00Z"}
+  containerStatuses:
+  - {name: api, containerID: "containerd://1", imageID: "sha256:1", restartCount: 0}
+`
+
+const podB = `
+metadata:
+  name: api-1
+  uid: 2222
+  resourceVersion: "20"
+  generation: 2
+  creationTimestamp: "2024-03-02T10:00:00Z"
+  labels: {app: api, pod-template-hash: def}
+  ownerReferences:
+  - {kind: ReplicaSet, name: api-abc, uid: bbbb}
+spec:
+  nodeName: node-2
+  containers:
+  - {name: proxy, image: "proxy:1.1"}
+  - {name: api, image: "api:1.3"}
+status:
+  hostIP: 10.0.0.2
+  podIP: 10.1.0.6
+  podIPs: [{ip: 10.1.0.6}]
+  startTime: "2024-03-02T10:00:00Z"
+  conditions:
+  - {type: Ready, status: "False", lastTransitionTime: "2024-03-02T10:00:00Z"}
+  containerStatuses:
+  - {name: api, containerID: "containerd://2", imageID: "sha256:2", restartCount: 3}
+`
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		ignore []string
+		want   []string
+	}{
+		{
+			name: "default ignored fields",
+			want: []string{
+				"metadata.labels.pod-template-hash",
+				"spec.containers[api].image",
+				"spec.containers[proxy].image",
+				"status.conditions[Ready].status",
+				"status.containerStatuses[api].restartCount",
+			},
+		},
+		{
+			name:   "extra ignored fields",
+			ignore: []string{"metadata.labels.pod-template-hash", "spec.containers[].image", "status.conditions[Ready]"},
+			want:   []string{"status.containerStatuses[api].restartCount"},
+		},
+		{
+			name:   "a named element stands for any element",
+			ignore: []string{"spec.containers[api].image"},
+			want: []string{
+				"metadata.labels.pod-template-hash",
+				"status.conditions[Ready].status",
+				"status.containerStatuses[api].restartCount",
+			},
+		},
+	}
+	var a, b map[string]interface{}
+	if err := yaml.Unmarshal([]byte(podA), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(podB), &b); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []Change
+			diff("", a, b, ignoredFields(tt.ignore), &changes)
+			var got []string
+			for _, c := range changes {
+				got = append(got, c.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changed paths = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package compare
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// Output formats.
+const (
+	Text = "text"
+	JSON = "json"
+	HTML = "html"
+)
+
+// Write writes res to w in format.
+func Write(w io.Writer, res *Result, format string) error {
+	switch format {
+	case Text:
+		return WriteText(w, res)
+	case JSON:
+		b, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	case HTML:
+		return htmlTemplate.Execute(w, res)
+	}
+	return fmt.Errorf("unknown format %q, expected text, json or html", format)
+}
+
+// WriteText writes res as a diff-like text.
+func WriteText(w io.Writer, res *Result) error {
+	p := &printer{w: w}
+	p.printf("--- %s\n+++ %s\n", res.A, res.B)
+	for _, c := range res.OnlyA {
+		p.printf("\ncluster %s only in A\n", c)
+	}
+	for _, c := range res.OnlyB {
+		p.printf("\ncluster %s only in B\n", c)
+	}
+	for _, c := range res.Clusters {
+		p.printf("\ncluster %s: %d only in A, %d only in B, %d changed\n", c.Cluster, len(c.OnlyA), len(c.OnlyB), len(c.Changed))
+		for _, o := range c.OnlyA {
+			p.printf("- %s\n", o)
+		}
+		for _, o := range c.OnlyB {
+			p.printf("+ %s\n", o)
+		}
+		for _, o := range c.Changed {
+			p.printf("~ %s\n", o)
+			for _, ch := range o.Changes {
+				p.printf("    %s: %s -> %s\n", ch.Path, Value(ch.A), Value(ch.B))
+			}
+		}
+	}
+	return p.err
+}
+
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+// Value formats the value of a field as compact JSON, or <none> for a missing field.
+func Value(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+var htmlTemplate = template.Must(template.New("compare").Funcs(template.FuncMap{"value": Value}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Bundle comparison</title><style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+td.value { font-family: monospace; white-space: pre-wrap; word-break: break-all; }
+.a { color: #b00020; }
+.b { color: #1b7f1b; }
+</style></head><body>
+<h1>Bundle comparison</h1>
+<p>A: <code>{{.A}}</code><br>B: <code>{{.B}}</code></p>
+{{range .OnlyA}}<p class="a">Cluster {{.}} only in A</p>{{end}}
+{{range .OnlyB}}<p class="b">Cluster {{.}} only in B</p>{{end}}
+{{range .Clusters}}
+<h2>{{.Cluster}}</h2>
+<p>{{len .OnlyA}} only in A, {{len .OnlyB}} only in B, {{len .Changed}} changed</p>
+{{if or .OnlyA .OnlyB}}<ul>
+{{range .OnlyA}}<li class="a">only in A: {{.}}</li>{{end}}
+{{range .OnlyB}}<li class="b">only in B: {{.}}</li>{{end}}
+</ul>{{end}}
+{{range .Changed}}<h3>{{.}}</h3>
+<table>
+<tr><th>Field</th><th>A</th><th>B</th></tr>
+{{range .Changes}}<tr><td>{{.Path}}</td><td class="value a">{{value .A}}</td><td class="value b">{{value .B}}</td></tr>{{end}}
+</table>
+{{end}}
+{{end}}
+</body></html>
+`))
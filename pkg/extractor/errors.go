@@ -0,0 +1,53 @@
+package extractor
+
+import (
+	"fmt"
+)
+
+// ErrorsFile lists, in the directory of every cluster, the objects the extractors failed to
+// extract.
+const ErrorsFile = "errors.json"
+
+// ObjectError is the failure to extract a single object.
+type ObjectError struct {
+	Extractor string `json:"extractor,omitempty"`
+	// Object identifies what failed, e.g. "configmap/kube-proxy" or "log/default/web-1/nginx".
+	// It is empty if the whole extractor failed.
+	Object string `json:"object,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ObjectErrors is returned by the extractors that extracted some objects but failed on others.
+type ObjectErrors []ObjectError
+
+func (e ObjectErrors) Error() string {
+	if len(e) == 1 {
+		return fmt.Sprintf("failed to extract %s: %s", e[0].Object, e[0].Error)
+	}
+	return fmt.Sprintf("failed to extract %d objects, first %s: %s", len(e), e[0].Object, e[0].Error)
+}
+
+// objects collects the failures of the objects of an extractor. Unless strict, the extractor
+// goes on with the remaining objects and reports the failures once done.
+type objects struct {
+	strict bool
+	errs   ObjectErrors
+}
+
+// failed records that object failed with err. It returns err in strict mode, telling the
+// extractor to stop, and nil otherwise.
+func (o *objects) failed(object string, err error) error {
+	if o.strict {
+		return fmt.Errorf("%s: %v", object, err)
+	}
+	o.errs = append(o.errs, ObjectError{Object: object, Error: err.Error()})
+	return nil
+}
+
+// err returns the failures recorded, if any.
+func (o *objects) err() error {
+	if len(o.errs) == 0 {
+		return nil
+	}
+	return o.errs
+}
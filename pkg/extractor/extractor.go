@@ -2,9 +2,13 @@ package extractor
 
 import (
 	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	"io/ioutil"
+	kubeApiCore "k8s.io/api/core/v1"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
+	"time"
 )
 
 const (
@@ -13,170 +17,353 @@ const (
 	OUT  = ".out"
 )
 
+// Extractor collects a set of objects from a cluster and writes them to out.
+// Paths given to out are relative to the directory of the cluster.
 type Extractor interface {
-	Extract(acc *kube.Accessor, outputDir string) error
+	Extract(acc kube.Interface, out sink.Sink) error
 }
 
 type PodExtractor struct {
+	// Strict stops the extractor at the first object it fails to extract.
+	Strict bool
 }
 
-func (_ PodExtractor) Extract(acc *kube.Accessor, outputDir string) error {
-	_, err := acc.DumpInfo(outputDir, "all")
+func (e PodExtractor) Configure(opts Options) (Extractor, error) {
+	e.Strict = opts.Strict
+	return e, nil
+}
+
+func (e PodExtractor) Extract(acc kube.Interface, out sink.Sink) error {
+	err := listPods(acc, out)
 	if err != nil {
 		return err
 	}
-	podList, err := acc.GetPods("", "all")
+	objs := &objects{strict: e.Strict}
+	if err := describePods(acc, out, objs); err != nil {
+		return err
+	}
+	return objs.err()
+}
+
+// listPods writes the cluster-info dump and the pod list.
+func listPods(acc kube.Interface, out sink.Sink) error {
+	err := dumpInfo(acc, out)
 	if err != nil {
 		return err
 	}
-	err = writeStringToFile(outputDir, "pods", podList, OUT)
+	podList, err := acc.GetPods("", "all")
 	if err != nil {
 		return err
 	}
+	return writeStringToFile(out, "", "pods", podList, OUT)
+}
+
+func describePods(acc kube.Interface, out sink.Sink, objs *objects) error {
 	podDescribe, err := acc.DescribePod("", "all")
-	if err != nil || podDescribe == "No resources found" || podDescribe == "" {
+	if err != nil {
 		return err
 	}
-	split := strings.Split(podDescribe, "\nName:")
-	for i, pod := range split {
-		name := getName(pod)
-		if i != 0 {
-			pod = "Name:" + pod
-		}
-		//TODO: add namespace as well
-		err = writeStringToFile(filepath.Join(outputDir, "pods-describe"), name, pod, YAML)
-		if err != nil {
-			return err
-		}
-	}
-	return err
+	//TODO: add namespace as well
+	return writeDescriptions(out, "pods-describe", "pod", podDescribe, objs)
 }
 
 type CMExtractor struct {
+	// Strict stops the extractor at the first object it fails to extract.
+	Strict bool
+}
+
+func (e CMExtractor) Configure(opts Options) (Extractor, error) {
+	e.Strict = opts.Strict
+	return e, nil
 }
 
-func (_ CMExtractor) Extract(acc *kube.Accessor, outputDir string) error {
+func (e CMExtractor) Extract(acc kube.Interface, out sink.Sink) error {
 	s, err := acc.DescribeCM("", "all")
-	if err != nil || s == "No resources found" || s == "" {
+	if err != nil {
 		return err
 	}
-	split := strings.Split(s, "\nName:")
-	for i, cm := range split {
-		name := getName(cm)
-		if i != 0 {
-			cm = "Name:" + cm
-		}
-		err = writeStringToFile(filepath.Join(outputDir, "cm"), name, cm, YAML)
-		if err != nil {
-			return err
-		}
+	objs := &objects{strict: e.Strict}
+	if err := writeDescriptions(out, "cm", "configmap", s, objs); err != nil {
+		return err
 	}
-	return err
+	return objs.err()
 }
 
 type SVCExtractor struct {
+	// Strict stops the extractor at the first object it fails to extract.
+	Strict bool
 }
 
-func (_ SVCExtractor) Extract(acc *kube.Accessor, outputDir string) error {
+func (e SVCExtractor) Configure(opts Options) (Extractor, error) {
+	e.Strict = opts.Strict
+	return e, nil
+}
+
+func (e SVCExtractor) Extract(acc kube.Interface, out sink.Sink) error {
 	s, err := acc.DescribeSVC("", "all")
-	if err != nil || s == "No resources found" || s == "" {
+	if err != nil {
 		return err
 	}
-	split := strings.Split(s, "\nName:")
-	for i, svc := range split {
-		name := getName(svc)
-		if i != 0 {
-			svc = "Name:" + svc
-		}
-		err = writeStringToFile(filepath.Join(outputDir, "svc"), name, svc, YAML)
-		if err != nil {
-			return err
-		}
+	objs := &objects{strict: e.Strict}
+	if err := writeDescriptions(out, "svc", "service", s, objs); err != nil {
+		return err
 	}
-	return err
+	return objs.err()
 }
 
 type CRDExtractor struct {
+	// Strict stops the extractor at the first object it fails to extract.
+	Strict bool
 }
 
-func (_ CRDExtractor) Extract(acc *kube.Accessor, outputDir string) error {
+func (e CRDExtractor) Configure(opts Options) (Extractor, error) {
+	e.Strict = opts.Strict
+	return e, nil
+}
+
+func (e CRDExtractor) Extract(acc kube.Interface, out sink.Sink) error {
 	s, err := acc.DescribeCRD("", "all")
 	if err != nil || s == "No resources found" || s == "" {
 		return err
 	}
+	objs := &objects{strict: e.Strict}
 	split := strings.Split(s, "\nName:")
 	for i, crd := range split {
 		name := getName(crd)
 		if i != 0 {
 			crd = "Name:" + crd
 		}
-		dir := filepath.Join(outputDir, "crd", name)
-		err = writeStringToFile(dir, name, crd, YAML)
-		if err != nil {
-			return err
-		}
-		err = CRExtractor{}.Extract(acc, dir, name)
+		err = writeStringToFile(out, path.Join("crd", name), name, crd, YAML)
 		if err != nil {
-			return err
+			if err = objs.failed("crd/"+name, err); err != nil {
+				return err
+			}
 		}
 	}
-	return err
+	return objs.err()
 }
 
+// CRExtractor describes the instances of every CRD in the cluster. They are stored next to
+// the CRD description written by CRDExtractor.
 type CRExtractor struct {
+	// Strict stops the extractor at the first object it fails to extract.
+	Strict bool
 }
 
-func (_ CRExtractor) Extract(acc *kube.Accessor, outputDir, crd string) error {
-	s, err := acc.DescribeCR("", crd, "all")
-	if err != nil || s == "No resources found" || s == "" {
+func (e CRExtractor) Configure(opts Options) (Extractor, error) {
+	e.Strict = opts.Strict
+	return e, nil
+}
+
+func (e CRExtractor) Extract(acc kube.Interface, out sink.Sink) error {
+	crds, err := acc.ListCRDs()
+	if err != nil {
 		return err
 	}
-	split := strings.Split(s, "\nName:")
-	for i, crd := range split {
-		name := getName(crd)
-		if i != 0 {
-			crd = "Name:" + crd
+	objs := &objects{strict: e.Strict}
+	for _, crd := range crds {
+		s, err := acc.DescribeCR("", crd, "all")
+		if err != nil {
+			if err = objs.failed(path.Join("crd", crd, "instances"), err); err != nil {
+				return err
+			}
+			continue
 		}
-		err = writeStringToFile(filepath.Join(outputDir, "instances"), name, crd, YAML)
+		err = writeDescriptions(out, path.Join("crd", crd, "instances"), crd, s, objs)
 		if err != nil {
 			return err
 		}
 	}
-	return err
+	return objs.err()
 }
 
-func createFile(filepath string, logs string) error {
-	f, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+type EventExtractor struct {
+}
+
+func (_ EventExtractor) Extract(acc kube.Interface, out sink.Sink) error {
+	events, err := acc.GetEvents("all")
 	if err != nil {
 		return err
 	}
-	_, err = f.Write([]byte(logs))
+	return out.Write(sink.EventsFile, []byte(events))
+}
+
+// LogExtractor fetches the log of every started container, and the log of the previous
+// instance of containers that were restarted.
+type LogExtractor struct {
+	// Strict stops the extractor at the first log it fails to fetch.
+	Strict bool
+}
+
+func (e LogExtractor) Configure(opts Options) (Extractor, error) {
+	e.Strict = opts.Strict
+	return e, nil
+}
+
+func (e LogExtractor) Extract(acc kube.Interface, out sink.Sink) error {
+	objs := &objects{strict: e.Strict}
+	err := eachLog(acc, func(pod kubeApiCore.Pod, cs kubeApiCore.ContainerStatus, previous bool) error {
+		if err := writeLog(acc, out, pod.Namespace, pod.Name, cs.Name, previous); err != nil {
+			return objs.failed(logObject(pod, cs, previous), err)
+		}
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	err = f.Close()
-	return nil
+	return objs.err()
 }
 
-func writeStringToFile(path, file, str, fileType string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := os.MkdirAll(path, os.ModePerm)
-		if err != nil {
-			return err
+// logObject identifies a container log in ObjectErrors.
+func logObject(pod kubeApiCore.Pod, cs kubeApiCore.ContainerStatus, previous bool) string {
+	object := path.Join("log", pod.Namespace, pod.Name, cs.Name)
+	if previous {
+		object += "/previous"
+	}
+	return object
+}
+
+// eachLog calls f for the log of every started container and the log of the previous instance
+// of restarted containers.
+func eachLog(acc kube.Interface, f func(pod kubeApiCore.Pod, cs kubeApiCore.ContainerStatus, previous bool) error) error {
+	pods, err := acc.ListPods("all")
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			previous := cs.LastTerminationState.Terminated != nil
+			if cs.State.Waiting != nil && !previous {
+				continue
+			}
+			if cs.State.Waiting == nil {
+				err = f(pod, cs, false)
+				if err != nil {
+					return err
+				}
+			}
+			if previous {
+				err = f(pod, cs, true)
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
+	return nil
+}
+
+// writeLog writes a container log in full.
+func writeLog(acc kube.Interface, out sink.Sink, namespace, pod, container string, previous bool) error {
+	if sink.Completed(out, sink.LogPath(namespace, pod, container, previous)) {
+		return nil
+	}
+	lines, err := fetchLog(acc, namespace, pod, container, previous, time.Time{})
+	if err != nil {
+		return err
+	}
+	return out.Write(sink.LogPath(namespace, pod, container, previous), logData(lines))
+}
+
+// fetchLog returns the lines of a container log written since since, or every line if since is
+// zero. The lines are fetched with timestamps, the format the incremental runs append in and
+// the commands reading the bundle take the time of every line from, so that the full and the
+// incremental runs write the same logs.
+func fetchLog(acc kube.Interface, namespace, pod, container string, previous bool, since time.Time) ([]string, error) {
+	logs, err := acc.Logs(namespace, pod, container, kube.LogOptions{Previous: previous, Timestamps: true, SinceTime: since})
+	if err != nil {
+		return nil, err
+	}
+	if logs = strings.TrimRight(logs, "\n"); logs == "" {
+		return nil, nil
+	}
+	return strings.Split(logs, "\n"), nil
+}
+
+// logData returns the content of a log file holding lines.
+func logData(lines []string) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+type NodeExtractor struct {
+	// Strict stops the extractor at the first object it fails to extract.
+	Strict bool
+}
+
+func (e NodeExtractor) Configure(opts Options) (Extractor, error) {
+	e.Strict = opts.Strict
+	return e, nil
+}
 
-	fpath := filepath.Join(path, file)
-	_, err := os.Stat(fpath + fileType)
-	if os.IsNotExist(err) {
-		err = createFile(fpath+fileType, str)
+func (e NodeExtractor) Extract(acc kube.Interface, out sink.Sink) error {
+	nodeList, err := acc.GetNodes("")
+	if err != nil {
+		return err
+	}
+	err = writeStringToFile(out, "", "nodes", nodeList, OUT)
+	if err != nil {
+		return err
+	}
+	objs := &objects{strict: e.Strict}
+	if err := describeNode(acc, out, "", objs); err != nil {
+		return err
+	}
+	return objs.err()
+}
+
+func describeNode(acc kube.Interface, out sink.Sink, node string, objs *objects) error {
+	s, err := acc.DescribeNode(node)
+	if err != nil {
+		return err
+	}
+	return writeDescriptions(out, "nodes-describe", "node", s, objs)
+}
+
+// writeDescriptions splits the output of a describe command into one file per object of kind.
+// The objects that cannot be written are recorded in objs.
+func writeDescriptions(out sink.Sink, dir, kind, s string, objs *objects) error {
+	if s = strings.TrimSpace(s); s == "No resources found" || s == "" {
+		return nil
+	}
+	split := strings.Split(s, "\nName:")
+	for i, obj := range split {
+		name := getName(obj)
+		if i != 0 {
+			obj = "Name:" + obj
+		}
+		err := writeStringToFile(out, dir, name, obj, YAML)
 		if err != nil {
-			return err
+			if err = objs.failed(kind+"/"+name, err); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+func writeStringToFile(out sink.Sink, dir, file, str, fileType string) error {
+	return out.Write(path.Join(dir, file+fileType), []byte(str))
+}
+
+// dumpInfo runs cluster-info dump into a temporary directory and copies the result to out,
+// since kubectl can only write the dump to the local filesystem.
+func dumpInfo(acc kube.Interface, out sink.Sink) error {
+	dir, err := ioutil.TempDir("", "cluster-info-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	_, err = acc.DumpInfo(dir, "all")
+	if err != nil {
+		return err
+	}
+	return sink.WriteDir(out, dir, "")
+}
+
 func getName(manifest string) string {
 	line1 := strings.Split(manifest, "\n")[0]
 	n := strings.TrimPrefix(line1, "Name:")
@@ -0,0 +1,191 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube/fake"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiExt "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// cluster returns a fake cluster with one object of every kind an extractor reads: a pod whose
+// container restarted once, a config map, a service and its endpoints, a node, a CRD with one
+// instance, an event, a Helm release and an ingress.
+func cluster(t *testing.T) *fake.Accessor {
+	pod := &kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "web-1", Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec:       kubeApiCore.PodSpec{NodeName: "node-1", Containers: []kubeApiCore.Container{{Name: "nginx"}}},
+		Status: kubeApiCore.PodStatus{
+			Phase: kubeApiCore.PodRunning,
+			ContainerStatuses: []kubeApiCore.ContainerStatus{{
+				Name:                 "nginx",
+				Ready:                true,
+				RestartCount:         1,
+				State:                kubeApiCore.ContainerState{Running: &kubeApiCore.ContainerStateRunning{}},
+				LastTerminationState: kubeApiCore.ContainerState{Terminated: &kubeApiCore.ContainerStateTerminated{ExitCode: 1}},
+			}},
+		},
+	}
+	objects := []runtime.Object{
+		&kubeApiCore.Namespace{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "default"}},
+		pod,
+		&kubeApiCore.ConfigMap{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "settings", Namespace: "default"}},
+		&kubeApiCore.Service{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       kubeApiCore.ServiceSpec{Type: kubeApiCore.ServiceTypeClusterIP, Selector: map[string]string{"app": "web"}},
+		},
+		&kubeApiCore.Endpoints{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: "web", Namespace: "default"},
+			Subsets: []kubeApiCore.EndpointSubset{{Addresses: []kubeApiCore.EndpointAddress{{
+				IP: "10.1.0.5", TargetRef: &kubeApiCore.ObjectReference{Kind: "Pod", Name: "web-1"},
+			}}}},
+		},
+		&kubeApiCore.Node{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "node-1"}},
+		&kubeApiCore.Event{
+			ObjectMeta:     kubeApiMeta.ObjectMeta{Name: "web-1.1", Namespace: "default"},
+			InvolvedObject: kubeApiCore.ObjectReference{Kind: "Pod", Name: "web-1"},
+			Reason:         "BackOff",
+		},
+		helmSecret(t),
+		&kubeApiExt.CustomResourceDefinition{
+			ObjectMeta: kubeApiMeta.ObjectMeta{Name: "widgets.example.com"},
+			Spec: kubeApiExt.CustomResourceDefinitionSpec{
+				Group:    "example.com",
+				Names:    kubeApiExt.CustomResourceDefinitionNames{Plural: "widgets", Kind: "Widget"},
+				Scope:    kubeApiExt.NamespaceScoped,
+				Versions: []kubeApiExt.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true}},
+			},
+		},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "example.com/v1", "kind": "Widget",
+			"metadata": map[string]interface{}{"name": "gear", "namespace": "default"},
+		}},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1", "kind": "Ingress",
+			"metadata": map[string]interface{}{"name": "web", "namespace": "default"},
+		}},
+	}
+	acc := fake.NewAccessor(objects...)
+	acc.Kube.Resources = []*kubeApiMeta.APIResourceList{
+		{GroupVersion: "v1", APIResources: []kubeApiMeta.APIResource{{Name: "endpoints"}, {Name: "pods"}}},
+		{GroupVersion: "networking.k8s.io/v1", APIResources: []kubeApiMeta.APIResource{{Name: "ingresses"}}},
+	}
+	acc.ContainerLogs[fake.LogKey("default", "web-1", "nginx", false)] = "2024-03-01T10:00:00Z started\n"
+	acc.ContainerLogs[fake.LogKey("default", "web-1", "nginx", true)] = "2024-03-01T09:00:00Z panic: boom\n"
+	return acc
+}
+
+// helmSecret returns the secret the Helm v3 secret driver stores revision 1 of a release in.
+func helmSecret(t *testing.T) *kubeApiCore.Secret {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte(`{"name":"web","namespace":"default","version":1,"info":{"status":"deployed"},` +
+		`"chart":{"metadata":{"name":"nginx","version":"1.0.0"}},"config":{"password":"secret"},` +
+		`"manifest":"apiVersion: v1\nkind: Secret\nmetadata:\n  name: web\ndata:\n  password: c2VjcmV0\n"}`))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &kubeApiCore.Secret{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "sh.helm.release.v1.web.v1", Namespace: "default", Labels: map[string]string{"owner": "helm"}},
+		Type:       "helm.sh/release.v1",
+		Data:       map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))},
+	}
+}
+
+func TestExtractorLayout(t *testing.T) {
+	tests := []struct {
+		extractor string
+		paths     []string
+		// contains maps some of the paths to a string their content has to contain.
+		contains map[string]string
+	}{
+		{
+			extractor: "pods",
+			paths: []string{
+				"default/events.yaml",
+				"default/pods.yaml",
+				"default/services.yaml",
+				"nodes.yaml",
+				"pods-describe/web-1.yaml",
+				"pods.out",
+			},
+		},
+		{extractor: "configmaps", paths: []string{"cm/settings.yaml"}},
+		{extractor: "services", paths: []string{"svc/web.yaml"}},
+		{extractor: "crds", paths: []string{"crd/widgets.example.com/widgets.example.com.yaml"}},
+		{extractor: "crs", paths: []string{"crd/widgets.example.com/instances/gear.yaml"}},
+		{extractor: "events", paths: []string{"events.out"}},
+		{
+			extractor: "logs",
+			paths: []string{
+				"logs/default/web-1/nginx.log",
+				"logs/default/web-1/nginx.previous.log",
+			},
+			contains: map[string]string{"logs/default/web-1/nginx.previous.log": "2024-03-01T09:00:00Z panic: boom"},
+		},
+		{extractor: "timeline", paths: []string{"timeline/default.log"}},
+		{extractor: "nodes", paths: []string{"nodes-describe/node-1.yaml", "nodes.out"}},
+		{
+			extractor: "helm",
+			paths: []string{
+				"helm/default/web/release.yaml",
+				"helm/default/web/revisions/1/manifest.yaml",
+				"helm/default/web/revisions/1/values.yaml",
+			},
+			contains: map[string]string{
+				"helm/default/web/revisions/1/values.yaml":   "password: '***'",
+				"helm/default/web/revisions/1/manifest.yaml": "password: '***'",
+				"helm/default/web/release.yaml":              "chartVersion: 1.0.0",
+			},
+		},
+		{
+			extractor: "networking",
+			paths: []string{
+				"default/endpoints.yaml",
+				"networking/default/ingresses.yaml",
+				"networking/default/services.txt",
+			},
+			contains: map[string]string{"networking/default/services.txt": "ready  10.1.0.5:  pod web-1"},
+		},
+	}
+	tested := map[string]bool{}
+	for _, tt := range tests {
+		tested[tt.extractor] = true
+		t.Run(tt.extractor, func(t *testing.T) {
+			r, ok := Lookup(tt.extractor)
+			if !ok {
+				t.Fatalf("extractor %s is not registered", tt.extractor)
+			}
+			regs, err := Configure([]Registration{r}, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := sink.NewMemorySink()
+			if err := regs[0].Extractor.Extract(cluster(t), out); err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if got := out.Paths(); !reflect.DeepEqual(got, tt.paths) {
+				t.Errorf("paths = %q\nwant %q", got, tt.paths)
+			}
+			for p, want := range tt.contains {
+				if got, _ := out.Get(p); !strings.Contains(string(got), want) {
+					t.Errorf("%s does not contain %q:\n%s", p, want, got)
+				}
+			}
+		})
+	}
+	for _, r := range Registered() {
+		if !tested[r.Name] {
+			t.Errorf("extractor %s has no expected layout", r.Name)
+		}
+	}
+}
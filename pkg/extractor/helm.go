@@ -0,0 +1,271 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	"github.com/astralkn/k8s-logs-extractor/pkg/redact"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	"sigs.k8s.io/yaml"
+)
+
+// HelmDir holds the Helm releases, relative to the cluster.
+const HelmDir = "helm"
+
+// helmSelector selects the secrets, or the config maps with the configmap storage driver, in
+// which Helm v3 stores its releases, one per revision.
+const helmSelector = "owner=helm"
+
+// HelmExtractor decodes the Helm v3 releases stored by the secret and the configmap drivers. For every release it writes a summary of
+// its revisions to helm/<namespace>/<release>/release.yaml and, per revision, the user supplied
+// values, with secrets masked, and the rendered manifest under revisions/<revision>/.
+type HelmExtractor struct {
+	// Namespaces are the namespaces the releases are read from, every namespace if empty.
+	Namespaces []string
+	// Strict stops the extractor at the first release it fails to decode.
+	Strict bool
+}
+
+// Configure sets the namespaces and the strictness of the extractor.
+func (h HelmExtractor) Configure(opts Options) (Extractor, error) {
+	h.Namespaces, h.Strict = opts.HelmNamespaces, opts.Strict
+	return h, nil
+}
+
+// helmRelease holds the fields of a Helm v3 release used in the bundle.
+type helmRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Info      struct {
+		FirstDeployed time.Time `json:"first_deployed"`
+		LastDeployed  time.Time `json:"last_deployed"`
+		Status        string    `json:"status"`
+		Description   string    `json:"description"`
+		Notes         string    `json:"notes"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+	} `json:"chart"`
+	Config   map[string]interface{} `json:"config"`
+	Manifest string                 `json:"manifest"`
+}
+
+// HelmRelease is the summary of a release written to release.yaml.
+type HelmRelease struct {
+	Name         string         `json:"name"`
+	Namespace    string         `json:"namespace"`
+	Chart        string         `json:"chart"`
+	ChartVersion string         `json:"chartVersion"`
+	AppVersion   string         `json:"appVersion,omitempty"`
+	Revision     int            `json:"revision"`
+	Status       string         `json:"status"`
+	History      []HelmRevision `json:"history"`
+}
+
+// HelmRevision is a revision of a release.
+type HelmRevision struct {
+	Revision     int       `json:"revision"`
+	Updated      time.Time `json:"updated"`
+	Status       string    `json:"status"`
+	Chart        string    `json:"chart"`
+	ChartVersion string    `json:"chartVersion"`
+	AppVersion   string    `json:"appVersion,omitempty"`
+	Description  string    `json:"description,omitempty"`
+}
+
+// SelectedNamespaces returns the namespaces the releases are read from.
+func (h HelmExtractor) SelectedNamespaces() []string {
+	return h.Namespaces
+}
+
+func (h HelmExtractor) Extract(acc kube.Interface, out sink.Sink) error {
+	namespaces := h.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{"all"}
+	}
+	objs := &objects{strict: h.Strict}
+	releases := map[string][]*helmRelease{}
+	add := func(object, namespace string, data map[string][]byte) error {
+		rel, err := decodeRelease(namespace, data)
+		if err != nil {
+			return objs.failed(object, err)
+		}
+		key := path.Join(rel.Namespace, rel.Name)
+		releases[key] = append(releases[key], rel)
+		return nil
+	}
+	for _, ns := range namespaces {
+		secrets, err := acc.ListSecrets(ns, helmSelector)
+		if err != nil {
+			return err
+		}
+		for _, s := range secrets {
+			if s.Type != "helm.sh/release.v1" {
+				continue
+			}
+			if err := add(path.Join("secret", s.Namespace, s.Name), s.Namespace, s.Data); err != nil {
+				return err
+			}
+		}
+		// The configmap driver is rarely used, the secret releases are kept if config maps
+		// cannot be listed.
+		cms, err := acc.ListConfigMaps(ns, helmSelector)
+		if err != nil {
+			if err = objs.failed(path.Join("configmaps", ns), err); err != nil {
+				return err
+			}
+		}
+		for _, cm := range cms {
+			data := map[string][]byte{}
+			for k, v := range cm.Data {
+				data[k] = []byte(v)
+			}
+			if err := add(path.Join("configmap", cm.Namespace, cm.Name), cm.Namespace, data); err != nil {
+				return err
+			}
+		}
+	}
+	keys := make([]string, 0, len(releases))
+	for k := range releases {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := writeRelease(out, releases[key]); err != nil {
+			if err = objs.failed(path.Join("release", key), err); err != nil {
+				return err
+			}
+		}
+	}
+	return objs.err()
+}
+
+// decodeRelease decodes the data of a release secret or config map of namespace: its release key
+// holds the release as gzipped JSON, base64 encoded on top of the encoding of the secret data.
+func decodeRelease(namespace string, d map[string][]byte) (*helmRelease, error) {
+	data, ok := d["release"]
+	if !ok {
+		return nil, fmt.Errorf("no release key")
+	}
+	b, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the release: %v", err)
+	}
+	if bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress the release: %v", err)
+		}
+		b, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress the release: %v", err)
+		}
+	}
+	rel := &helmRelease{}
+	if err := json.Unmarshal(b, rel); err != nil {
+		return nil, fmt.Errorf("failed to parse the release: %v", err)
+	}
+	if rel.Namespace == "" {
+		rel.Namespace = namespace
+	}
+	return rel, nil
+}
+
+// writeRelease writes the summary and the revisions of a release.
+func writeRelease(out sink.Sink, revisions []*helmRelease) error {
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Version < revisions[j].Version })
+	last := revisions[len(revisions)-1]
+	dir := path.Join(HelmDir, last.Namespace, last.Name)
+	summary := HelmRelease{
+		Name:         last.Name,
+		Namespace:    last.Namespace,
+		Chart:        last.Chart.Metadata.Name,
+		ChartVersion: last.Chart.Metadata.Version,
+		AppVersion:   last.Chart.Metadata.AppVersion,
+		Revision:     last.Version,
+		Status:       last.Info.Status,
+	}
+	for _, rel := range revisions {
+		summary.History = append(summary.History, HelmRevision{
+			Revision:     rel.Version,
+			Updated:      rel.Info.LastDeployed,
+			Status:       rel.Info.Status,
+			Chart:        rel.Chart.Metadata.Name,
+			ChartVersion: rel.Chart.Metadata.Version,
+			AppVersion:   rel.Chart.Metadata.AppVersion,
+			Description:  rel.Info.Description,
+		})
+		revDir := path.Join(dir, "revisions", strconv.Itoa(rel.Version))
+		values, ok := redact.Value(rel.Config).(map[string]interface{})
+		if !ok || values == nil {
+			values = map[string]interface{}{}
+		}
+		b, err := yaml.Marshal(values)
+		if err != nil {
+			return err
+		}
+		if err := out.Write(path.Join(revDir, "values.yaml"), b); err != nil {
+			return err
+		}
+		if err := out.Write(path.Join(revDir, "manifest.yaml"), []byte(redactManifest(rel.Manifest))); err != nil {
+			return err
+		}
+	}
+	b, err := yaml.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return out.Write(path.Join(dir, "release.yaml"), b)
+}
+
+// manifestSeparator separates the documents of a rendered manifest.
+var manifestSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// redactManifest masks the data of the Secrets of a rendered manifest. The other documents are
+// kept as rendered.
+func redactManifest(manifest string) string {
+	docs := manifestSeparator.Split(manifest, -1)
+	for i, doc := range docs {
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || obj["kind"] != "Secret" {
+			continue
+		}
+		for _, field := range []string{"data", "stringData"} {
+			if data, ok := obj[field].(map[string]interface{}); ok {
+				for k := range data {
+					data[k] = redact.Mask
+				}
+			}
+		}
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			continue
+		}
+		// Keep the comment Helm adds with the template the document comes from.
+		var source string
+		for _, line := range strings.Split(strings.TrimLeft(doc, "\n"), "\n") {
+			if !strings.HasPrefix(line, "#") {
+				break
+			}
+			source += line + "\n"
+		}
+		docs[i] = "\n" + source + string(b)
+	}
+	return strings.Join(docs, "---")
+}
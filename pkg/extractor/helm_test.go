@@ -0,0 +1,89 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube/fake"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeTesting "k8s.io/client-go/testing"
+)
+
+// helmConfigMap returns the config map the Helm v3 configmap driver stores a revision of a
+// release in, release being its JSON.
+func helmConfigMap(t *testing.T, name, release string) *kubeApiCore.ConfigMap {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte(release))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &kubeApiCore.ConfigMap{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: "jobs", Labels: map[string]string{"owner": "helm"}},
+		Data:       map[string]string{"release": base64.StdEncoding.EncodeToString(buf.Bytes())},
+	}
+}
+
+func TestHelmDrivers(t *testing.T) {
+	acc := fake.NewAccessor(
+		helmSecret(t),
+		helmConfigMap(t, "sh.helm.release.v1.cron.v1", `{"name":"cron","version":1,"info":{"status":"superseded"},`+
+			`"chart":{"metadata":{"name":"cron","version":"0.1.0"}},"config":{"schedule":"@daily","token":"abc"}}`),
+		helmConfigMap(t, "sh.helm.release.v1.cron.v2", `{"name":"cron","version":2,"info":{"status":"deployed"},`+
+			`"chart":{"metadata":{"name":"cron","version":"0.2.0"}},"config":null}`),
+		helmConfigMap(t, "sh.helm.release.v1.broken.v1", `{"name":`),
+		&kubeApiCore.ConfigMap{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "settings", Namespace: "jobs"}},
+	)
+	out := sink.NewMemorySink()
+	err := HelmExtractor{}.Extract(acc, out)
+	errs, ok := err.(ObjectErrors)
+	if !ok || len(errs) != 1 || errs[0].Object != "configmap/jobs/sh.helm.release.v1.broken.v1" {
+		t.Fatalf("Extract() error = %v, want the broken release", err)
+	}
+	want := []string{
+		"helm/default/web/release.yaml",
+		"helm/default/web/revisions/1/manifest.yaml",
+		"helm/default/web/revisions/1/values.yaml",
+		"helm/jobs/cron/release.yaml",
+		"helm/jobs/cron/revisions/1/manifest.yaml",
+		"helm/jobs/cron/revisions/1/values.yaml",
+		"helm/jobs/cron/revisions/2/manifest.yaml",
+		"helm/jobs/cron/revisions/2/values.yaml",
+	}
+	if got := out.Paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("paths = %q\nwant %q", got, want)
+	}
+	for p, want := range map[string]string{
+		"helm/jobs/cron/release.yaml":            "chartVersion: 0.2.0",
+		"helm/jobs/cron/revisions/1/values.yaml": "token: '***'",
+		"helm/jobs/cron/revisions/2/values.yaml": "{}",
+	} {
+		if got, _ := out.Get(p); !strings.Contains(string(got), want) {
+			t.Errorf("%s does not contain %q:\n%s", p, want, got)
+		}
+	}
+}
+
+// Releases stored in secrets are extracted when config maps cannot be listed.
+func TestHelmConfigMapsForbidden(t *testing.T) {
+	acc := fake.NewAccessor(helmSecret(t))
+	acc.Kube.PrependReactor("list", "configmaps", func(kubeTesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("configmaps is forbidden")
+	})
+	out := sink.NewMemorySink()
+	err := HelmExtractor{}.Extract(acc, out)
+	if errs, ok := err.(ObjectErrors); !ok || len(errs) != 1 || errs[0].Object != "configmaps/all" {
+		t.Errorf("Extract() error = %v, want config maps not listed", err)
+	}
+	if _, ok := out.Get("helm/default/web/release.yaml"); !ok {
+		t.Errorf("release stored in a secret not extracted: %q", out.Paths())
+	}
+}
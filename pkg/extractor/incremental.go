@@ -0,0 +1,204 @@
+package extractor
+
+import (
+	"strings"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	kubeApiCore "k8s.io/api/core/v1"
+)
+
+// IncrementalExtractor is implemented by extractors able to extract only what changed since the
+// runs recorded in state, adding to the files these runs wrote. Other extractors run in full
+// and replace their files.
+type IncrementalExtractor interface {
+	ExtractIncremental(acc kube.Interface, out sink.Sink, state *State) error
+}
+
+// ExtractIncremental refreshes the cluster-info dump and the pod list, which kubectl only
+// produces in full, and describes the pods whose resourceVersion changed.
+func (e PodExtractor) ExtractIncremental(acc kube.Interface, out sink.Sink, state *State) error {
+	err := listPods(acc, out)
+	if err != nil {
+		return err
+	}
+	pods, err := acc.ListPods("all")
+	if err != nil {
+		return err
+	}
+	versions := map[string]string{}
+	for _, pod := range pods.Items {
+		versions[pod.Namespace+"/"+pod.Name] = pod.ResourceVersion
+	}
+	objs := &objects{strict: e.Strict}
+	if !state.HasObjects("pods") {
+		if err := describePods(acc, out, objs); err != nil {
+			return err
+		}
+	} else {
+		for _, key := range state.Changed("pods", versions) {
+			ns, name := splitKey(key)
+			s, err := acc.DescribePod(name, ns)
+			if err != nil {
+				if err = objs.failed("pod/"+key, err); err != nil {
+					return err
+				}
+				continue
+			}
+			err = writeDescriptions(out, "pods-describe", "pod", s, objs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	state.Record("pods", pods.ResourceVersion, versions, failedKeys(versions, "pod", objs))
+	return objs.err()
+}
+
+// ExtractIncremental refreshes the node list and describes the nodes whose resourceVersion
+// changed.
+func (e NodeExtractor) ExtractIncremental(acc kube.Interface, out sink.Sink, state *State) error {
+	nodeList, err := acc.GetNodes("")
+	if err != nil {
+		return err
+	}
+	err = writeStringToFile(out, "", "nodes", nodeList, OUT)
+	if err != nil {
+		return err
+	}
+	nodes, err := acc.ListNodes()
+	if err != nil {
+		return err
+	}
+	versions := map[string]string{}
+	for _, node := range nodes.Items {
+		versions[node.Name] = node.ResourceVersion
+	}
+	objs := &objects{strict: e.Strict}
+	if !state.HasObjects("nodes") {
+		if err := describeNode(acc, out, "", objs); err != nil {
+			return err
+		}
+	} else {
+		for _, name := range state.Changed("nodes", versions) {
+			err = describeNode(acc, out, name, objs)
+			if err != nil {
+				if err = objs.failed("node/"+name, err); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	state.Record("nodes", nodes.ResourceVersion, versions, failedKeys(versions, "node", objs))
+	return objs.err()
+}
+
+// failedKeys returns the keys of versions whose object of kind objs recorded a failure for. The
+// failures name the objects kind/namespace/name or, when written from a describe output,
+// kind/name.
+func failedKeys(versions map[string]string, kind string, objs *objects) map[string]bool {
+	failed := map[string]bool{}
+	for _, e := range objs.errs {
+		if !strings.HasPrefix(e.Object, kind+"/") {
+			continue
+		}
+		obj := strings.TrimPrefix(e.Object, kind+"/")
+		for key := range versions {
+			if _, name := splitKey(key); key == obj || name == obj {
+				failed[key] = true
+			}
+		}
+	}
+	return failed
+}
+
+// ExtractIncremental appends the lines written since the last extracted one to the log of every
+// container. The logs are fetched with timestamps, which tell where to resume. A container
+// restarted since the previous run starts a new log, fetched in full like the log of its
+// previous instance.
+func (e LogExtractor) ExtractIncremental(acc kube.Interface, out sink.Sink, state *State) error {
+	objs := &objects{strict: e.Strict}
+	err := eachLog(acc, func(pod kubeApiCore.Pod, cs kubeApiCore.ContainerStatus, previous bool) error {
+		if err := appendLog(acc, out, state, pod.Namespace, pod.Name, cs, previous); err != nil {
+			return objs.failed(logObject(pod, cs, previous), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return objs.err()
+}
+
+func appendLog(acc kube.Interface, out sink.Sink, state *State, namespace, pod string, cs kubeApiCore.ContainerStatus, previous bool) error {
+	p := sink.LogPath(namespace, pod, cs.Name, previous)
+	last, ok := state.Log(p)
+	ok = ok && last.RestartCount == cs.RestartCount
+	if ok && previous {
+		// The previous instance is stopped, its log cannot have changed.
+		return nil
+	}
+	var since time.Time
+	if ok {
+		since = last.Time
+	}
+	lines, err := fetchLog(acc, namespace, pod, cs.Name, previous, since)
+	if err != nil {
+		return err
+	}
+	if ok {
+		lines = linesAfter(lines, last.Time)
+	}
+	current := LogState{RestartCount: cs.RestartCount}
+	if ok {
+		current.Time = last.Time
+	}
+	for _, line := range lines {
+		if t, _, hasTime := bundle.LineTime(line); hasTime {
+			current.Time = t
+		}
+	}
+	data := logData(lines)
+	if !ok {
+		err = out.Write(p, data)
+		if err != nil {
+			return err
+		}
+		state.SetLog(p, current, -1)
+		return nil
+	}
+	if len(data) > 0 {
+		err = sink.Append(out, p, data)
+		if err != nil {
+			return err
+		}
+	}
+	state.SetLog(p, current, len(lines))
+	return nil
+}
+
+// linesAfter drops the lines written at or before t, which --since-time returns again, and the
+// lines without a timestamp that continue them.
+func linesAfter(lines []string, t time.Time) []string {
+	var kept []string
+	keep := false
+	for _, line := range lines {
+		if lt, _, ok := bundle.LineTime(line); ok {
+			keep = lt.After(t)
+		}
+		if keep {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+// splitKey splits a namespace/name key of State.Objects.
+func splitKey(key string) (string, string) {
+	if i := strings.IndexByte(key, '/'); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
@@ -0,0 +1,162 @@
+package extractor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube/fake"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fileSink holds the files of a bundle across runs. Writes to the paths in fail fail.
+type fileSink struct {
+	files map[string]string
+	fail  map[string]bool
+}
+
+func newFileSink() *fileSink {
+	return &fileSink{files: map[string]string{}, fail: map[string]bool{}}
+}
+
+func (s *fileSink) Write(name string, data []byte) error {
+	if s.fail[name] {
+		return fmt.Errorf("disk full")
+	}
+	s.files[name] = string(data)
+	return nil
+}
+
+func (s *fileSink) Append(name string, data []byte) error {
+	if s.fail[name] {
+		return fmt.Errorf("disk full")
+	}
+	s.files[name] += string(data)
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	return nil
+}
+
+func loadState(t *testing.T) *State {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	state, err := LoadState(filepath.Join(dir, StateFile), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func versionedPod(name, rv string) *kubeApiCore.Pod {
+	return &kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: "default", ResourceVersion: rv},
+		Spec:       kubeApiCore.PodSpec{Containers: []kubeApiCore.Container{{Name: "app"}}},
+	}
+}
+
+// A pod whose description could not be written keeps the resourceVersion of the previous run,
+// so that the next run describes it again.
+func TestIncrementalPodsRecordedAfterWrite(t *testing.T) {
+	acc := fake.NewAccessor(versionedPod("web-1", "10"), versionedPod("web-2", "11"))
+	state := loadState(t)
+	out := newFileSink()
+	if err := (PodExtractor{}).ExtractIncremental(acc, out, state); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"default/web-1": "10", "default/web-2": "11"}
+	if !reflect.DeepEqual(state.Objects["pods"], want) || state.ResourceVersions["pods"] != "11" {
+		t.Fatalf("state after the first run = %v, %v", state.Objects["pods"], state.ResourceVersions)
+	}
+
+	for _, p := range []*kubeApiCore.Pod{versionedPod("web-1", "20"), versionedPod("web-2", "21")} {
+		if _, err := acc.Kube.CoreV1().Pods("default").Update(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out.fail["pods-describe/web-1.yaml"] = true
+	err := (PodExtractor{}).ExtractIncremental(acc, out, state)
+	if _, ok := err.(ObjectErrors); !ok {
+		t.Fatalf("ExtractIncremental() error = %v, want the failed pod", err)
+	}
+	want = map[string]string{"default/web-1": "10", "default/web-2": "21"}
+	if !reflect.DeepEqual(state.Objects["pods"], want) {
+		t.Fatalf("state after a failed write = %v, want %v", state.Objects["pods"], want)
+	}
+
+	delete(out.fail, "pods-describe/web-1.yaml")
+	delete(out.files, "pods-describe/web-1.yaml")
+	delete(out.files, "pods-describe/web-2.yaml")
+	if err := (PodExtractor{}).ExtractIncremental(acc, out, state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.files["pods-describe/web-1.yaml"]; !ok {
+		t.Errorf("pod not described again after a failed write")
+	}
+	if _, ok := out.files["pods-describe/web-2.yaml"]; ok {
+		t.Errorf("unchanged pod described again")
+	}
+	want = map[string]string{"default/web-1": "20", "default/web-2": "21"}
+	if !reflect.DeepEqual(state.Objects["pods"], want) {
+		t.Errorf("state = %v, want %v", state.Objects["pods"], want)
+	}
+	if run := state.Run(); run.Changed["pods"] != 5 || run.Unchanged["pods"] != 1 {
+		t.Errorf("run = %+v", run)
+	}
+}
+
+// A failed describe leaves the state untouched.
+func TestIncrementalNodesFailed(t *testing.T) {
+	acc := fake.NewAccessor(&kubeApiCore.Node{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "node-1", ResourceVersion: "5"}})
+	state := loadState(t)
+	out := newFileSink()
+	out.fail["nodes.out"] = true
+	if err := (NodeExtractor{}).ExtractIncremental(acc, out, state); err == nil {
+		t.Fatal("ExtractIncremental() succeeded")
+	}
+	if state.HasObjects("nodes") || state.ResourceVersions["nodes"] != "" {
+		t.Errorf("nodes recorded although nothing was written: %v", state.Objects)
+	}
+}
+
+// The full and the incremental runs write the same logs, which the next incremental runs
+// append to.
+func TestIncrementalLogsMatchFull(t *testing.T) {
+	pod := versionedPod("web-1", "1")
+	pod.Status.ContainerStatuses = []kubeApiCore.ContainerStatus{{Name: "app", State: kubeApiCore.ContainerState{Running: &kubeApiCore.ContainerStateRunning{}}}}
+	acc := fake.NewAccessor(pod)
+	key := fake.LogKey("default", "web-1", "app", false)
+	acc.ContainerLogs[key] = "2024-03-01T10:00:00Z started\n\tdetails\n2024-03-01T10:00:01Z ready\n"
+
+	full := newFileSink()
+	if err := (LogExtractor{}).Extract(acc, full); err != nil {
+		t.Fatal(err)
+	}
+	state := loadState(t)
+	incremental := newFileSink()
+	if err := (LogExtractor{}).ExtractIncremental(acc, incremental, state); err != nil {
+		t.Fatal(err)
+	}
+	p := sink.LogPath("default", "web-1", "app", false)
+	if full.files[p] != incremental.files[p] || full.files[p] != acc.ContainerLogs[key] {
+		t.Fatalf("full log %q, incremental log %q", full.files[p], incremental.files[p])
+	}
+
+	acc.ContainerLogs[key] += "2024-03-01T10:00:02Z request\n"
+	if err := (LogExtractor{}).ExtractIncremental(acc, incremental, state); err != nil {
+		t.Fatal(err)
+	}
+	if incremental.files[p] != acc.ContainerLogs[key] {
+		t.Errorf("appended log %q, want %q", incremental.files[p], acc.ContainerLogs[key])
+	}
+}
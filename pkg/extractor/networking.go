@@ -0,0 +1,358 @@
+package extractor
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	kubeApiCore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// NetworkingDir holds the networking objects and the service reports, relative to the cluster.
+const NetworkingDir = "networking"
+
+// ServiceReportFile is the report linking the services of a namespace to their endpoints and
+// pods, in the directory of the namespace under NetworkingDir.
+const ServiceReportFile = "services.txt"
+
+// networkingResource is a resource read by the networking extractor if the cluster serves it.
+type networkingResource struct {
+	Resource string
+	// Groups are the API groups serving the resource, by preference.
+	Groups []string
+}
+
+var networkingResources = []networkingResource{
+	{Resource: "endpointslices", Groups: []string{"discovery.k8s.io"}},
+	{Resource: "ingresses", Groups: []string{"networking.k8s.io", "extensions"}},
+	{Resource: "ingressclasses", Groups: []string{"networking.k8s.io"}},
+	{Resource: "networkpolicies", Groups: []string{"networking.k8s.io"}},
+	{Resource: "gatewayclasses", Groups: []string{"gateway.networking.k8s.io"}},
+	{Resource: "gateways", Groups: []string{"gateway.networking.k8s.io"}},
+	{Resource: "httproutes", Groups: []string{"gateway.networking.k8s.io"}},
+	{Resource: "grpcroutes", Groups: []string{"gateway.networking.k8s.io"}},
+	{Resource: "tlsroutes", Groups: []string{"gateway.networking.k8s.io"}},
+	{Resource: "tcproutes", Groups: []string{"gateway.networking.k8s.io"}},
+	{Resource: "udproutes", Groups: []string{"gateway.networking.k8s.io"}},
+	{Resource: "referencegrants", Groups: []string{"gateway.networking.k8s.io"}},
+}
+
+// networkingPermissions returns the optional permissions to list the networkingResources, in
+// their preferred group.
+func networkingPermissions() []kube.Permission {
+	var perms []kube.Permission
+	for _, r := range networkingResources {
+		perms = append(perms, optional(kube.Permission{Verb: "list", Group: r.Groups[0], Resource: r.Resource}))
+	}
+	return perms
+}
+
+// NetworkingExtractor writes the Endpoints of every namespace to <namespace>/endpoints.yaml,
+// next to the cluster-info dump, and the EndpointSlices, Ingresses, IngressClasses,
+// NetworkPolicies and Gateway API objects the cluster serves to
+// networking/[<namespace>/]<resource>.yaml. For every namespace it also writes a report
+// following each service to the ready and not ready endpoints and the pods behind them.
+type NetworkingExtractor struct {
+	// Strict stops the extractor at the first resource it fails to extract.
+	Strict bool
+}
+
+func (e NetworkingExtractor) Configure(opts Options) (Extractor, error) {
+	e.Strict = opts.Strict
+	return e, nil
+}
+
+func (e NetworkingExtractor) Extract(acc kube.Interface, out sink.Sink) error {
+	objs := &objects{strict: e.Strict}
+	endpoints, err := acc.ListEndpoints("all")
+	if err == nil {
+		err = writeEndpoints(out, endpoints)
+	}
+	if err != nil {
+		if err = objs.failed("endpoints", err); err != nil {
+			return err
+		}
+	}
+	served, err := servedResources(acc)
+	if err != nil {
+		if err = objs.failed("api-resources", err); err != nil {
+			return err
+		}
+	}
+	for _, r := range networkingResources {
+		gvr, ok := r.find(served)
+		if !ok {
+			continue
+		}
+		items, err := acc.ListResource(gvr, "all")
+		if err == nil {
+			err = writeResource(out, r.Resource, items)
+		}
+		if err != nil {
+			if err = objs.failed(gvr.GroupResource().String(), err); err != nil {
+				return err
+			}
+		}
+	}
+	services, err := acc.ListServices("all")
+	if err != nil {
+		if err = objs.failed("services", err); err != nil {
+			return err
+		}
+		return objs.err()
+	}
+	// Without the pods the report still links the services to their endpoints.
+	var pods []kubeApiCore.Pod
+	if list, err := acc.ListPods("all"); err != nil {
+		if err = objs.failed("pods", err); err != nil {
+			return err
+		}
+	} else {
+		pods = list.Items
+	}
+	if err := writeServiceReports(out, services, endpoints, pods); err != nil {
+		if err = objs.failed("services", err); err != nil {
+			return err
+		}
+	}
+	return objs.err()
+}
+
+// servedResources returns the preferred version of every resource served by the cluster.
+func servedResources(acc kube.Interface) (map[schema.GroupResource]schema.GroupVersionResource, error) {
+	names, err := acc.APIResources()
+	if err != nil {
+		return nil, err
+	}
+	served := map[schema.GroupResource]schema.GroupVersionResource{}
+	for _, name := range names {
+		// Names are resource.group/version, or resource.version for the core group.
+		var gvr schema.GroupVersionResource
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			gvr.Version, name = name[i+1:], name[:i]
+			gvr.Resource = name
+			if j := strings.IndexByte(name, '.'); j >= 0 {
+				gvr.Resource, gvr.Group = name[:j], name[j+1:]
+			}
+		} else if j := strings.IndexByte(name, '.'); j >= 0 {
+			gvr.Resource, gvr.Version = name[:j], name[j+1:]
+		}
+		served[gvr.GroupResource()] = gvr
+	}
+	return served, nil
+}
+
+// find returns the version of the resource served by the cluster, if any.
+func (r networkingResource) find(served map[schema.GroupResource]schema.GroupVersionResource) (schema.GroupVersionResource, bool) {
+	for _, g := range r.Groups {
+		if gvr, ok := served[schema.GroupResource{Group: g, Resource: r.Resource}]; ok {
+			return gvr, true
+		}
+	}
+	return schema.GroupVersionResource{}, false
+}
+
+// writeEndpoints writes the endpoints of every namespace as an EndpointsList, the format
+// the bundle package loads.
+func writeEndpoints(out sink.Sink, endpoints []kubeApiCore.Endpoints) error {
+	byNamespace := map[string]*kubeApiCore.EndpointsList{}
+	for _, ep := range endpoints {
+		l, ok := byNamespace[ep.Namespace]
+		if !ok {
+			l = &kubeApiCore.EndpointsList{}
+			l.Kind, l.APIVersion = "EndpointsList", "v1"
+			byNamespace[ep.Namespace] = l
+		}
+		l.Items = append(l.Items, ep)
+	}
+	for ns, l := range byNamespace {
+		b, err := yaml.Marshal(l)
+		if err != nil {
+			return err
+		}
+		if err := out.Write(path.Join(ns, bundle.EndpointsFile), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResource writes the objects of a resource, one list per namespace. Cluster scoped
+// objects are written directly under NetworkingDir.
+func writeResource(out sink.Sink, resource string, items []unstructured.Unstructured) error {
+	byNamespace := map[string][]interface{}{}
+	for _, item := range items {
+		unstructured.RemoveNestedField(item.Object, "metadata", "managedFields")
+		byNamespace[item.GetNamespace()] = append(byNamespace[item.GetNamespace()], item.Object)
+	}
+	for ns, l := range byNamespace {
+		b, err := yaml.Marshal(map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": l})
+		if err != nil {
+			return err
+		}
+		if err := out.Write(path.Join(NetworkingDir, ns, resource+YAML), b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeServiceReports writes the ServiceReportFile of every namespace with services.
+func writeServiceReports(out sink.Sink, services []kubeApiCore.Service, endpoints []kubeApiCore.Endpoints, pods []kubeApiCore.Pod) error {
+	eps := map[string]kubeApiCore.Endpoints{}
+	for _, ep := range endpoints {
+		eps[ep.Namespace+"/"+ep.Name] = ep
+	}
+	podsByNamespace := map[string][]kubeApiCore.Pod{}
+	for _, pod := range pods {
+		podsByNamespace[pod.Namespace] = append(podsByNamespace[pod.Namespace], pod)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Namespace != services[j].Namespace {
+			return services[i].Namespace < services[j].Namespace
+		}
+		return services[i].Name < services[j].Name
+	})
+	reports := map[string]*strings.Builder{}
+	for _, svc := range services {
+		b, ok := reports[svc.Namespace]
+		if !ok {
+			b = &strings.Builder{}
+			reports[svc.Namespace] = b
+		} else {
+			b.WriteString("\n")
+		}
+		ep, hasEndpoints := eps[svc.Namespace+"/"+svc.Name]
+		serviceReport(b, svc, ep, hasEndpoints, podsByNamespace[svc.Namespace])
+	}
+	for ns, b := range reports {
+		if err := out.Write(path.Join(NetworkingDir, ns, ServiceReportFile), []byte(b.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceReport follows svc to its selector, its ready and not ready addresses and the pods
+// behind them, and lists the pods it selects that have no address.
+func serviceReport(b *strings.Builder, svc kubeApiCore.Service, ep kubeApiCore.Endpoints, hasEndpoints bool, pods []kubeApiCore.Pod) {
+	var ports []string
+	for _, p := range svc.Spec.Ports {
+		port := fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+		if p.TargetPort.String() != "" && p.TargetPort.String() != "0" {
+			port += "->" + p.TargetPort.String()
+		}
+		if p.Name != "" {
+			port = p.Name + " " + port
+		}
+		ports = append(ports, port)
+	}
+	fmt.Fprintf(b, "service %s (%s", svc.Name, svc.Spec.Type)
+	if svc.Spec.ClusterIP != "" {
+		fmt.Fprintf(b, " %s", svc.Spec.ClusterIP)
+	}
+	if len(ports) > 0 {
+		fmt.Fprintf(b, ", ports %s", strings.Join(ports, ", "))
+	}
+	b.WriteString(")\n")
+	if svc.Spec.Type == kubeApiCore.ServiceTypeExternalName {
+		fmt.Fprintf(b, "  external name: %s\n", svc.Spec.ExternalName)
+		return
+	}
+	if len(svc.Spec.Selector) == 0 {
+		b.WriteString("  selector: none, the endpoints are managed outside of Kubernetes\n")
+	} else {
+		fmt.Fprintf(b, "  selector: %s\n", labels.SelectorFromSet(svc.Spec.Selector))
+	}
+	if !hasEndpoints {
+		b.WriteString("  endpoints: none\n")
+	}
+	podsByName := map[string]kubeApiCore.Pod{}
+	for _, pod := range pods {
+		podsByName[pod.Name] = pod
+	}
+	var ready, notReady int
+	for _, s := range ep.Subsets {
+		ready += len(s.Addresses)
+		notReady += len(s.NotReadyAddresses)
+	}
+	if hasEndpoints {
+		fmt.Fprintf(b, "  endpoints: %d ready, %d not ready\n", ready, notReady)
+	}
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	withAddress := map[string]bool{}
+	for _, s := range ep.Subsets {
+		var ports []string
+		for _, p := range s.Ports {
+			ports = append(ports, fmt.Sprint(p.Port))
+		}
+		for _, a := range []struct {
+			state     string
+			addresses []kubeApiCore.EndpointAddress
+		}{{"ready", s.Addresses}, {"not ready", s.NotReadyAddresses}} {
+			for _, addr := range a.addresses {
+				target := "-"
+				if ref := addr.TargetRef; ref != nil {
+					target = strings.ToLower(ref.Kind) + " " + ref.Name
+					if pod, ok := podsByName[ref.Name]; ok && ref.Kind == "Pod" {
+						target += "\t" + podState(pod)
+						withAddress[pod.Name] = true
+					}
+				}
+				fmt.Fprintf(w, "    %s\t%s:%s\t%s\n", a.state, addr.IP, strings.Join(ports, ","), target)
+			}
+		}
+	}
+	_ = w.Flush()
+	if len(svc.Spec.Selector) == 0 {
+		return
+	}
+	sel := labels.SelectorFromSet(svc.Spec.Selector)
+	var missing []kubeApiCore.Pod
+	for _, pod := range pods {
+		if sel.Matches(labels.Set(pod.Labels)) && !withAddress[pod.Name] {
+			missing = append(missing, pod)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	b.WriteString("  selected pods without an address:\n")
+	w = tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	for _, pod := range missing {
+		fmt.Fprintf(w, "    pod %s\t%s\n", pod.Name, podState(pod))
+	}
+	_ = w.Flush()
+}
+
+// podState summarizes a pod: its phase, its ready containers, the reason its containers are
+// waiting, if any, and its node.
+func podState(pod kubeApiCore.Pod) string {
+	ready := 0
+	var waiting []string
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Ready {
+			ready++
+		}
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			waiting = append(waiting, cs.Name+": "+cs.State.Waiting.Reason)
+		}
+	}
+	state := fmt.Sprintf("%s %d/%d ready", pod.Status.Phase, ready, len(pod.Spec.Containers))
+	if len(waiting) > 0 {
+		state += " (" + strings.Join(waiting, ", ") + ")"
+	}
+	if pod.Spec.NodeName != "" {
+		state += " on " + pod.Spec.NodeName
+	}
+	return state
+}
@@ -0,0 +1,153 @@
+package extractor
+
+import (
+	"strings"
+	"testing"
+
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func servicePod(name string, ready bool, waiting string) kubeApiCore.Pod {
+	cs := kubeApiCore.ContainerStatus{Name: "app", Ready: ready}
+	if waiting != "" {
+		cs.State.Waiting = &kubeApiCore.ContainerStateWaiting{Reason: waiting}
+	}
+	return kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec:       kubeApiCore.PodSpec{NodeName: "node-1", Containers: []kubeApiCore.Container{{Name: "app"}}},
+		Status:     kubeApiCore.PodStatus{Phase: kubeApiCore.PodRunning, ContainerStatuses: []kubeApiCore.ContainerStatus{cs}},
+	}
+}
+
+func address(ip, pod string) kubeApiCore.EndpointAddress {
+	return kubeApiCore.EndpointAddress{IP: ip, TargetRef: &kubeApiCore.ObjectReference{Kind: "Pod", Name: pod}}
+}
+
+func TestServiceReport(t *testing.T) {
+	web := kubeApiCore.Service{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: kubeApiCore.ServiceSpec{
+			Type: kubeApiCore.ServiceTypeClusterIP, ClusterIP: "10.96.0.10", Selector: map[string]string{"app": "web"},
+			Ports: []kubeApiCore.ServicePort{{Name: "http", Port: 80, Protocol: kubeApiCore.ProtocolTCP, TargetPort: intstr.FromInt(8080)}},
+		},
+	}
+	pods := []kubeApiCore.Pod{servicePod("web-1", true, ""), servicePod("web-2", false, ""), servicePod("web-3", false, "CrashLoopBackOff")}
+	tests := []struct {
+		name         string
+		svc          kubeApiCore.Service
+		ep           kubeApiCore.Endpoints
+		hasEndpoints bool
+		pods         []kubeApiCore.Pod
+		want         string
+	}{
+		{
+			name: "ready and not ready addresses",
+			svc:  web,
+			ep: kubeApiCore.Endpoints{Subsets: []kubeApiCore.EndpointSubset{{
+				Addresses:         []kubeApiCore.EndpointAddress{address("10.1.0.5", "web-1")},
+				NotReadyAddresses: []kubeApiCore.EndpointAddress{address("10.1.0.6", "web-2"), address("10.1.0.7", "web-3")},
+				Ports:             []kubeApiCore.EndpointPort{{Port: 8080}},
+			}}},
+			hasEndpoints: true,
+			pods:         pods,
+			want: "service web (ClusterIP 10.96.0.10, ports http 80/TCP->8080)\n" +
+				"  selector: app=web\n" +
+				"  endpoints: 1 ready, 2 not ready\n" +
+				"    ready      10.1.0.5:8080  pod web-1  Running 1/1 ready on node-1\n" +
+				"    not ready  10.1.0.6:8080  pod web-2  Running 0/1 ready on node-1\n" +
+				"    not ready  10.1.0.7:8080  pod web-3  Running 0/1 ready (app: CrashLoopBackOff) on node-1\n",
+		},
+		{
+			name: "selected pods without an address",
+			svc:  web,
+			ep: kubeApiCore.Endpoints{Subsets: []kubeApiCore.EndpointSubset{{
+				Addresses: []kubeApiCore.EndpointAddress{address("10.1.0.5", "web-1")},
+				Ports:     []kubeApiCore.EndpointPort{{Port: 8080}},
+			}}},
+			hasEndpoints: true,
+			pods:         append(pods, kubeApiCore.Pod{ObjectMeta: kubeApiMeta.ObjectMeta{Name: "db-1", Labels: map[string]string{"app": "db"}}}),
+			want: "service web (ClusterIP 10.96.0.10, ports http 80/TCP->8080)\n" +
+				"  selector: app=web\n" +
+				"  endpoints: 1 ready, 0 not ready\n" +
+				"    ready  10.1.0.5:8080  pod web-1  Running 1/1 ready on node-1\n" +
+				"  selected pods without an address:\n" +
+				"    pod web-2  Running 0/1 ready on node-1\n" +
+				"    pod web-3  Running 0/1 ready (app: CrashLoopBackOff) on node-1\n",
+		},
+		{
+			name: "no endpoints",
+			svc:  web,
+			pods: pods[:1],
+			want: "service web (ClusterIP 10.96.0.10, ports http 80/TCP->8080)\n" +
+				"  selector: app=web\n" +
+				"  endpoints: none\n" +
+				"  selected pods without an address:\n" +
+				"    pod web-1  Running 1/1 ready on node-1\n",
+		},
+		{
+			name: "external name",
+			svc: kubeApiCore.Service{
+				ObjectMeta: kubeApiMeta.ObjectMeta{Name: "db", Namespace: "default"},
+				Spec:       kubeApiCore.ServiceSpec{Type: kubeApiCore.ServiceTypeExternalName, ExternalName: "db.example.com"},
+			},
+			pods: pods,
+			want: "service db (ExternalName)\n" +
+				"  external name: db.example.com\n",
+		},
+		{
+			name: "no selector",
+			svc: kubeApiCore.Service{
+				ObjectMeta: kubeApiMeta.ObjectMeta{Name: "legacy", Namespace: "default"},
+				Spec: kubeApiCore.ServiceSpec{
+					Type: kubeApiCore.ServiceTypeClusterIP, ClusterIP: "10.96.0.20",
+					Ports: []kubeApiCore.ServicePort{{Port: 5432, Protocol: kubeApiCore.ProtocolTCP}},
+				},
+			},
+			ep: kubeApiCore.Endpoints{Subsets: []kubeApiCore.EndpointSubset{{
+				Addresses: []kubeApiCore.EndpointAddress{{IP: "192.168.1.20"}},
+				Ports:     []kubeApiCore.EndpointPort{{Port: 5432}},
+			}}},
+			hasEndpoints: true,
+			pods:         pods,
+			want: "service legacy (ClusterIP 10.96.0.20, ports 5432/TCP)\n" +
+				"  selector: none, the endpoints are managed outside of Kubernetes\n" +
+				"  endpoints: 1 ready, 0 not ready\n" +
+				"    ready  192.168.1.20:5432  -\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			serviceReport(&b, tt.svc, tt.ep, tt.hasEndpoints, tt.pods)
+			if b.String() != tt.want {
+				t.Errorf("serviceReport() =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+// The permissions of the networking extractor cover every resource it reads.
+func TestNetworkingPermissions(t *testing.T) {
+	r, ok := Lookup("networking")
+	if !ok {
+		t.Fatal("networking extractor not registered")
+	}
+	perms := map[string]bool{}
+	for _, p := range r.Permissions {
+		perms[p.String()] = p.Optional
+	}
+	for _, want := range []string{
+		"list ingressclasses.networking.k8s.io", "list gatewayclasses.gateway.networking.k8s.io",
+		"list gateways.gateway.networking.k8s.io", "list httproutes.gateway.networking.k8s.io",
+		"list referencegrants.gateway.networking.k8s.io",
+	} {
+		if optional, ok := perms[want]; !ok || !optional {
+			t.Errorf("%q is not an optional permission of the networking extractor: %v", want, perms)
+		}
+	}
+	if optional, ok := perms["list services"]; !ok || optional {
+		t.Errorf("list services is not a required permission: %v", perms)
+	}
+}
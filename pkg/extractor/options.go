@@ -0,0 +1,39 @@
+package extractor
+
+import (
+	"fmt"
+)
+
+// Options holds the settings of the extractors that take any.
+type Options struct {
+	// TimelineSelector is a label selector. If set, the timeline extractor merges the logs of the
+	// pods it selects into a single timeline instead of writing one per namespace.
+	TimelineSelector string `json:"timelineSelector,omitempty"`
+	// HelmNamespaces are the namespaces the helm extractor reads the releases from, every
+	// namespace if empty.
+	HelmNamespaces []string `json:"helmNamespaces,omitempty"`
+	// Strict stops an extractor at the first object it fails to extract, instead of recording
+	// the failure and going on with the other objects.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// Configurable is implemented by extractors taking Options.
+type Configurable interface {
+	Configure(opts Options) (Extractor, error)
+}
+
+// Configure returns regs with the extractors implementing Configurable set up with opts.
+func Configure(regs []Registration, opts Options) ([]Registration, error) {
+	configured := make([]Registration, len(regs))
+	for i, r := range regs {
+		if c, ok := r.Extractor.(Configurable); ok {
+			e, err := c.Configure(opts)
+			if err != nil {
+				return nil, fmt.Errorf("invalid options for extractor %s: %v", r.Name, err)
+			}
+			r.Extractor = e
+		}
+		configured[i] = r
+	}
+	return configured, nil
+}
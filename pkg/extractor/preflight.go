@@ -0,0 +1,96 @@
+package extractor
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+)
+
+// PermissionCheck is the outcome of the access review of a single permission.
+type PermissionCheck struct {
+	Extractor  string
+	Permission kube.Permission
+	Allowed    bool
+	Reason     string
+}
+
+// PreflightResult holds the permission matrix of a cluster.
+type PreflightResult struct {
+	Checks []PermissionCheck
+}
+
+// NamespacedExtractor is implemented by extractors that can be restricted to some namespaces.
+type NamespacedExtractor interface {
+	// SelectedNamespaces returns the namespaces the extractor reads, every namespace if empty.
+	SelectedNamespaces() []string
+}
+
+// permissions returns the permissions of r, in each of the namespaces its extractor is
+// restricted to, so that namespace scoped roles are enough to run it.
+func (r Registration) permissions() []kube.Permission {
+	n, ok := r.Extractor.(NamespacedExtractor)
+	if !ok || len(n.SelectedNamespaces()) == 0 {
+		return r.Permissions
+	}
+	var perms []kube.Permission
+	for _, p := range r.Permissions {
+		for _, ns := range n.SelectedNamespaces() {
+			p.Namespace = ns
+			perms = append(perms, p)
+		}
+	}
+	return perms
+}
+
+// Preflight reviews every permission needed by regs. A permission shared by several extractors
+// is only reviewed once.
+func Preflight(acc kube.Interface, regs []Registration) (*PreflightResult, error) {
+	type answer struct {
+		allowed bool
+		reason  string
+	}
+	answers := map[string]answer{}
+	res := &PreflightResult{}
+	for _, r := range regs {
+		for _, p := range r.permissions() {
+			a, ok := answers[p.String()]
+			if !ok {
+				allowed, reason, err := acc.CanI(p)
+				if err != nil {
+					return nil, fmt.Errorf("access review of %q failed: %v", p, err)
+				}
+				a = answer{allowed, reason}
+				answers[p.String()] = a
+			}
+			res.Checks = append(res.Checks, PermissionCheck{Extractor: r.Name, Permission: p, Allowed: a.allowed, Reason: a.reason})
+		}
+	}
+	return res, nil
+}
+
+// Missing returns the required and the optional permissions of extractor that were denied.
+func (p *PreflightResult) Missing(extractor string) (required, optional []kube.Permission) {
+	for _, c := range p.Checks {
+		if c.Extractor != extractor || c.Allowed {
+			continue
+		}
+		if c.Permission.Optional {
+			optional = append(optional, c.Permission)
+		} else {
+			required = append(required, c.Permission)
+		}
+	}
+	return required, optional
+}
+
+// WriteMatrix prints the permission matrix as a table.
+func (p *PreflightResult) WriteMatrix(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "EXTRACTOR\tPERMISSION\tREQUIRED\tALLOWED\tREASON")
+	for _, c := range p.Checks {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%t\t%t\t%s\n", c.Extractor, c.Permission, !c.Permission.Optional, c.Allowed, c.Reason)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,147 @@
+package extractor
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube/fake"
+)
+
+// countingAccessor counts the access reviews.
+type countingAccessor struct {
+	*fake.Accessor
+	reviews []string
+}
+
+func (a *countingAccessor) CanI(p kube.Permission) (bool, string, error) {
+	a.reviews = append(a.reviews, p.String())
+	return a.Accessor.CanI(p)
+}
+
+func preflight(t *testing.T, forbidden []string, opts Options, names ...string) (*PreflightResult, *countingAccessor) {
+	acc := &countingAccessor{Accessor: fake.NewAccessor()}
+	for _, p := range forbidden {
+		acc.Forbidden[p] = true
+	}
+	var regs []Registration
+	for _, name := range names {
+		r, ok := Lookup(name)
+		if !ok {
+			t.Fatalf("extractor %s is not registered", name)
+		}
+		regs = append(regs, r)
+	}
+	regs, err := Configure(regs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Preflight(acc, regs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, acc
+}
+
+func permissionStrings(perms []kube.Permission) []string {
+	var s []string
+	for _, p := range perms {
+		s = append(s, p.String())
+	}
+	return s
+}
+
+func TestPreflightMissing(t *testing.T) {
+	tests := []struct {
+		name      string
+		forbidden []string
+		opts      Options
+		extractor string
+		required  []string
+		optional  []string
+	}{
+		{name: "allowed", extractor: "logs"},
+		{
+			name:      "required",
+			forbidden: []string{"get pods/log"},
+			extractor: "logs",
+			required:  []string{"get pods/log"},
+		},
+		{
+			name:      "optional",
+			forbidden: []string{"list pods", "list events"},
+			extractor: "nodes",
+			optional:  []string{"list pods", "list events"},
+		},
+		{
+			name:      "every namespace",
+			forbidden: []string{"list secrets"},
+			extractor: "helm",
+			required:  []string{"list secrets"},
+		},
+		{
+			name:      "selected namespaces",
+			forbidden: []string{"list secrets", "list configmaps in infra"},
+			opts:      Options{HelmNamespaces: []string{"apps", "infra"}},
+			extractor: "helm",
+			optional:  []string{"list configmaps in infra"},
+		},
+		{
+			name:      "denied in a selected namespace",
+			forbidden: []string{"list secrets in infra"},
+			opts:      Options{HelmNamespaces: []string{"apps", "infra"}},
+			extractor: "helm",
+			required:  []string{"list secrets in infra"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _ := preflight(t, tt.forbidden, tt.opts, tt.extractor)
+			required, optional := res.Missing(tt.extractor)
+			if got := permissionStrings(required); !reflect.DeepEqual(got, tt.required) {
+				t.Errorf("required = %q, want %q", got, tt.required)
+			}
+			if got := permissionStrings(optional); !reflect.DeepEqual(got, tt.optional) {
+				t.Errorf("optional = %q, want %q", got, tt.optional)
+			}
+		})
+	}
+}
+
+// A permission shared by several extractors is reviewed once and reported for each of them.
+func TestPreflightShared(t *testing.T) {
+	res, acc := preflight(t, []string{"get pods/log"}, Options{}, "logs", "timeline")
+	if want := []string{"list pods", "get pods/log"}; !reflect.DeepEqual(acc.reviews, want) {
+		t.Errorf("reviews = %q, want %q", acc.reviews, want)
+	}
+	for _, name := range []string{"logs", "timeline"} {
+		if required, _ := res.Missing(name); len(required) != 1 {
+			t.Errorf("%s misses %q, want get pods/log", name, permissionStrings(required))
+		}
+	}
+	if required, optional := res.Missing("pods"); required != nil || optional != nil {
+		t.Errorf("extractor not checked misses %q, %q", required, optional)
+	}
+}
+
+func TestWriteMatrix(t *testing.T) {
+	res, _ := preflight(t, []string{"list secrets in apps"}, Options{HelmNamespaces: []string{"apps"}}, "helm")
+	var buf bytes.Buffer
+	if err := res.WriteMatrix(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		rows = append(rows, strings.Fields(line))
+	}
+	want := [][]string{
+		{"EXTRACTOR", "PERMISSION", "REQUIRED", "ALLOWED", "REASON"},
+		{"helm", "list", "secrets", "in", "apps", "true", "false", "forbidden", "by", "the", "fake", "accessor"},
+		{"helm", "list", "configmaps", "in", "apps", "false", "true"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("matrix:\n%s", buf.String())
+	}
+}
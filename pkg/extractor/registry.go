@@ -0,0 +1,216 @@
+package extractor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+)
+
+// Registration describes an Extractor known to the registry.
+type Registration struct {
+	// Name identifies the extractor, e.g. in --extractors=pods,events.
+	Name string
+	// Description is a one line summary shown when listing extractors.
+	Description string
+	// Default reports whether the extractor runs when none are selected explicitly.
+	Default bool
+	// DependsOn lists extractors that have to finish before this one starts.
+	DependsOn []string
+	// Permissions are checked before extracting. Extractors missing a required permission are skipped.
+	Permissions []kube.Permission
+	Extractor   Extractor
+}
+
+func list(resource string) kube.Permission {
+	return kube.Permission{Verb: "list", Resource: resource}
+}
+
+func optional(p kube.Permission) kube.Permission {
+	p.Optional = true
+	return p
+}
+
+var podLogs = kube.Permission{Verb: "get", Resource: "pods", Subresource: "log"}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Registration{}
+)
+
+func init() {
+	MustRegister(Registration{
+		Name:        "pods",
+		Description: "cluster-info dump, pod list and pod descriptions",
+		Default:     true,
+		Permissions: []kube.Permission{
+			list("pods"), podLogs, list("nodes"), list("events"), list("services"), list("replicationcontrollers"),
+			{Verb: "list", Group: "apps", Resource: "deployments"},
+			{Verb: "list", Group: "apps", Resource: "daemonsets"},
+			{Verb: "list", Group: "apps", Resource: "replicasets"},
+		},
+		Extractor: PodExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "configmaps",
+		Description: "config map descriptions",
+		Default:     true,
+		Permissions: []kube.Permission{list("configmaps"), optional(list("events"))},
+		Extractor:   CMExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "services",
+		Description: "service descriptions",
+		Default:     true,
+		Permissions: []kube.Permission{list("services"), optional(list("endpoints")), optional(list("events"))},
+		Extractor:   SVCExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "crds",
+		Description: "custom resource definition descriptions",
+		Default:     true,
+		Permissions: []kube.Permission{{Verb: "list", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}},
+		Extractor:   CRDExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "crs",
+		Description: "custom resource instance descriptions, grouped by CRD",
+		Default:     true,
+		DependsOn:   []string{"crds"},
+		Permissions: []kube.Permission{{Verb: "list", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}},
+		Extractor:   CRExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "events",
+		Description: "events of all namespaces",
+		Permissions: []kube.Permission{list("events")},
+		Extractor:   EventExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "logs",
+		Description: "container logs, including the previous instance of restarted containers",
+		Permissions: []kube.Permission{list("pods"), podLogs},
+		Extractor:   LogExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "timeline",
+		Description: "container logs with timestamps merged into one timeline per namespace or selector",
+		Permissions: []kube.Permission{list("pods"), podLogs},
+		Extractor:   TimelineExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "nodes",
+		Description: "node list and node descriptions",
+		Permissions: []kube.Permission{list("nodes"), optional(list("pods")), optional(list("events"))},
+		Extractor:   NodeExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "helm",
+		Description: "Helm v3 releases: revision history, redacted values and manifests",
+		Permissions: []kube.Permission{list("secrets"), optional(list("configmaps"))},
+		Extractor:   HelmExtractor{},
+	})
+	MustRegister(Registration{
+		Name:        "networking",
+		Description: "endpoints, ingresses, network policies, Gateway API objects and a report per service",
+		Permissions: append([]kube.Permission{list("endpoints"), list("services"), optional(list("pods"))},
+			networkingPermissions()...),
+		Extractor: NetworkingExtractor{},
+	})
+}
+
+// Register adds an extractor to the registry. Names have to be unique.
+func Register(r Registration) error {
+	if r.Name == "" {
+		return fmt.Errorf("extractor name is required")
+	}
+	if r.Extractor == nil {
+		return fmt.Errorf("extractor %q has no implementation", r.Name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[r.Name]; ok {
+		return fmt.Errorf("extractor %q is already registered", r.Name)
+	}
+	registry[r.Name] = r
+	return nil
+}
+
+// MustRegister is like Register but panics on error. It is meant to be called from init functions.
+func MustRegister(r Registration) {
+	if err := Register(r); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the extractor registered under name.
+func Lookup(name string) (Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Registered returns all registered extractors sorted by name.
+func Registered() []Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	regs := make([]Registration, 0, len(registry))
+	for _, r := range registry {
+		regs = append(regs, r)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Name < regs[j].Name })
+	return regs
+}
+
+// Defaults returns the names of the extractors enabled by default.
+func Defaults() []string {
+	var names []string
+	for _, r := range Registered() {
+		if r.Default {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// Resolve returns the named extractors together with their dependencies,
+// ordered so that every extractor comes after the ones it depends on.
+func Resolve(names []string) ([]Registration, error) {
+	var (
+		ordered []Registration
+		state   = map[string]int{} // 1 - visiting, 2 - done
+		visit   func(name, parent string) error
+	)
+	visit = func(name, parent string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle detected at extractor %q", name)
+		case 2:
+			return nil
+		}
+		r, ok := Lookup(name)
+		if !ok {
+			if parent != "" {
+				return fmt.Errorf("unknown extractor %q required by %q", name, parent)
+			}
+			return fmt.Errorf("unknown extractor %q", name)
+		}
+		state[name] = 1
+		for _, d := range r.DependsOn {
+			if err := visit(d, name); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, r)
+		return nil
+	}
+	for _, n := range names {
+		if err := visit(n, ""); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
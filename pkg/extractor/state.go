@@ -0,0 +1,208 @@
+package extractor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StateFile records, in the directory of every cluster, what incremental runs extracted.
+const StateFile = "state.json"
+
+// State is what an incremental run needs to know about the previous runs against a cluster.
+// It is safe for concurrent use by the extractors.
+type State struct {
+	// ResourceVersions holds the resourceVersion of the last list extracted per resource type,
+	// e.g. "pods", or the highest one of its objects if the list has none.
+	ResourceVersions map[string]string `json:"resourceVersions,omitempty"`
+	// Objects holds the resourceVersion of every extracted object per resource type, keyed by
+	// namespace/name. Objects that failed to be extracted keep the version of the previous run,
+	// so that the next run extracts them again.
+	Objects map[string]map[string]string `json:"objects,omitempty"`
+	// Logs holds the last extracted line of every container log, keyed by sink.LogPath.
+	Logs map[string]LogState `json:"logs,omitempty"`
+	// Runs lists the runs that updated the state, oldest first.
+	Runs []StateRun `json:"runs,omitempty"`
+
+	mu  sync.Mutex
+	run *StateRun
+}
+
+// LogState is where the extraction of a container log stopped.
+type LogState struct {
+	// Time is the timestamp of the last line extracted.
+	Time time.Time `json:"time"`
+	// RestartCount tells apart the instances of the container: a new instance starts a new log.
+	RestartCount int32 `json:"restartCount"`
+}
+
+// StateRun records what a run extracted incrementally.
+type StateRun struct {
+	Start time.Time `json:"start"`
+	// Incremental is false for the run that created the state.
+	Incremental bool `json:"incremental"`
+	// Changed, Unchanged and Removed count the objects per resource type.
+	Changed   map[string]int `json:"changed,omitempty"`
+	Unchanged map[string]int `json:"unchanged,omitempty"`
+	Removed   map[string]int `json:"removed,omitempty"`
+	// AppendedLogs counts the container logs new lines were appended to, and AppendedLines the
+	// lines appended.
+	AppendedLogs  int `json:"appendedLogs,omitempty"`
+	AppendedLines int `json:"appendedLines,omitempty"`
+	// FetchedLogs counts the container logs fetched in full by an incremental run, those of new
+	// or restarted containers.
+	FetchedLogs int `json:"fetchedLogs,omitempty"`
+}
+
+// LoadState reads the state at path, returning an empty state if there is none yet. A run is
+// started at start.
+func LoadState(path string, start time.Time) (*State, error) {
+	s := &State{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, err
+		}
+	}
+	if s.ResourceVersions == nil {
+		s.ResourceVersions = map[string]string{}
+	}
+	if s.Objects == nil {
+		s.Objects = map[string]map[string]string{}
+	}
+	if s.Logs == nil {
+		s.Logs = map[string]LogState{}
+	}
+	s.run = &StateRun{
+		Start:       start,
+		Incremental: len(s.Runs) > 0,
+		Changed:     map[string]int{},
+		Unchanged:   map[string]int{},
+		Removed:     map[string]int{},
+	}
+	return s, nil
+}
+
+// Incremental reports whether a previous run recorded the state.
+func (s *State) Incremental() bool {
+	return s.run.Incremental
+}
+
+// Run returns the record of the current run.
+func (s *State) Run() StateRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.run
+}
+
+// Marshal adds the current run to the runs and encodes the state.
+func (s *State) Marshal() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Runs = append(s.Runs, *s.run)
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// Changed returns the keys of the objects of resource, keyed by namespace/name with their
+// resourceVersion, that changed since the previous run.
+func (s *State) Changed(resource string, objects map[string]string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.Objects[resource]
+	var changed []string
+	for key, rv := range objects {
+		if previous[key] != rv {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Record records the objects of resource extracted from a list with resourceVersion
+// listVersion, once they were written. The objects in failed keep their previous version.
+// Objects that are gone are forgotten.
+func (s *State) Record(resource, listVersion string, objects map[string]string, failed map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.Objects[resource]
+	recorded := make(map[string]string, len(objects))
+	changed, highest := 0, ""
+	for key, rv := range objects {
+		if previous[key] != rv {
+			changed++
+		}
+		if newerVersion(rv, highest) {
+			highest = rv
+		}
+		if !failed[key] {
+			recorded[key] = rv
+		} else if prev, ok := previous[key]; ok {
+			recorded[key] = prev
+		}
+	}
+	removed := 0
+	for key := range previous {
+		if _, ok := objects[key]; !ok {
+			removed++
+		}
+	}
+	if listVersion == "" {
+		listVersion = highest
+	}
+	if listVersion != "" {
+		s.ResourceVersions[resource] = listVersion
+	}
+	s.Objects[resource] = recorded
+	s.run.Changed[resource] += changed
+	s.run.Unchanged[resource] += len(objects) - changed
+	s.run.Removed[resource] += removed
+}
+
+// HasObjects reports whether a previous run recorded objects of resource.
+func (s *State) HasObjects(resource string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.Objects[resource]
+	return ok
+}
+
+// newerVersion compares resourceVersions, which are opaque but in practice etcd revisions.
+func newerVersion(rv, than string) bool {
+	a, errA := strconv.ParseUint(rv, 10, 64)
+	b, errB := strconv.ParseUint(than, 10, 64)
+	if errA != nil || errB != nil {
+		return than == ""
+	}
+	return a > b
+}
+
+// Log returns where the extraction of the container log at path stopped.
+func (s *State) Log(path string) (LogState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.Logs[path]
+	return l, ok
+}
+
+// SetLog records where the extraction of the container log at path stopped. appended is the
+// number of lines added to the log of a previous run, or -1 if the log was fetched in full.
+func (s *State) SetLog(path string, l LogState, appended int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Logs[path] = l
+	switch {
+	case appended > 0:
+		s.run.AppendedLogs++
+		s.run.AppendedLines += appended
+	case appended < 0 && s.run.Incremental:
+		s.run.FetchedLogs++
+	}
+}
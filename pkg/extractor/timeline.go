@@ -0,0 +1,172 @@
+package extractor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	kubeApiCore "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// TimelineDir holds the merged timelines, relative to the cluster.
+const TimelineDir = "timeline"
+
+// TimelineExtractor fetches the container logs with timestamps and merges them into one
+// timeline per namespace, or into a single one for the pods matching a selector. Every line is
+// prefixed with its time and its pod/container.
+type TimelineExtractor struct {
+	Selector labels.Selector
+	// Strict stops the extractor at the first pod whose logs it fails to fetch.
+	Strict bool
+}
+
+// Configure sets the selector of the extractor.
+func (t TimelineExtractor) Configure(opts Options) (Extractor, error) {
+	t.Selector, t.Strict = nil, opts.Strict
+	if opts.TimelineSelector == "" {
+		return t, nil
+	}
+	sel, err := labels.Parse(opts.TimelineSelector)
+	if err != nil {
+		return nil, err
+	}
+	t.Selector = sel
+	return t, nil
+}
+
+func (t TimelineExtractor) Extract(acc kube.Interface, out sink.Sink) error {
+	pods, err := acc.ListPods("all")
+	if err != nil {
+		return err
+	}
+	objs := &objects{strict: t.Strict}
+	timelines := map[string][]timelineEntry{}
+	for _, pod := range pods.Items {
+		name := pod.Namespace
+		if t.Selector != nil {
+			if !t.Selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			name = "selector-" + fileName(t.Selector.String())
+		}
+		entries, err := podTimeline(acc, pod)
+		if err != nil {
+			if err = objs.failed(path.Join("pod", pod.Namespace, pod.Name), err); err != nil {
+				return err
+			}
+			continue
+		}
+		timelines[name] = append(timelines[name], entries...)
+	}
+	for name, entries := range timelines {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].time.Before(entries[j].time) })
+		var buf bytes.Buffer
+		for _, e := range entries {
+			for _, line := range e.lines {
+				fmt.Fprintf(&buf, "%s [%s] %s\n", e.time.UTC().Format(timelineFormat), e.source, line)
+			}
+		}
+		if err := out.Write(path.Join(TimelineDir, name+".log"), buf.Bytes()); err != nil {
+			if err = objs.failed(path.Join(TimelineDir, name), err); err != nil {
+				return err
+			}
+		}
+	}
+	return objs.err()
+}
+
+// timelineFormat has a fixed width, so that the lines of a timeline align.
+const timelineFormat = "2006-01-02T15:04:05.000000000Z"
+
+// timelineEntry is a log entry, made of a line and its continuation lines.
+type timelineEntry struct {
+	time   time.Time
+	source string
+	lines  []string
+}
+
+// podTimeline returns the entries of the logs of the containers of pod, including the ones of
+// the previous instances.
+func podTimeline(acc kube.Interface, pod kubeApiCore.Pod) ([]timelineEntry, error) {
+	var entries []timelineEntry
+	statuses := append(append([]kubeApiCore.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		source := pod.Name + "/" + cs.Name
+		if cs.LastTerminationState.Terminated != nil {
+			logs, err := acc.Logs(pod.Namespace, pod.Name, cs.Name, kube.LogOptions{Previous: true, Timestamps: true})
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, parseTimeline(source+" (previous)", logs)...)
+		}
+		if cs.State.Waiting == nil {
+			logs, err := acc.Logs(pod.Namespace, pod.Name, cs.Name, kube.LogOptions{Timestamps: true})
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, parseTimeline(source, logs)...)
+		}
+	}
+	return entries, nil
+}
+
+// continuation matches the lines continuing the entry before them, e.g. the frames of a Java
+// stack trace.
+var continuation = regexp.MustCompile(`^(\s|Caused by:|\.\.\. \d+ more)`)
+
+// parseTimeline splits logs written with --timestamps into entries. Lines without a timestamp,
+// or whose message continues the previous entry, are kept with that entry, so that merging the
+// timelines of several containers does not break up multi-line entries. The lines without a
+// timestamp before the first entry, e.g. the tail of an entry cut by the log rotation, are kept
+// with the first one rather than sorted at the start of the timeline.
+func parseTimeline(source, logs string) []timelineEntry {
+	var entries []timelineEntry
+	var leading []string
+	s := bufio.NewScanner(strings.NewReader(logs))
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := s.Text()
+		t, msg, ok := bundle.LineTime(line)
+		if !ok {
+			msg = line
+		}
+		n := len(entries)
+		if n > 0 && (!ok || continuation.MatchString(msg)) {
+			entries[n-1].lines = append(entries[n-1].lines, msg)
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		if !ok {
+			leading = append(leading, msg)
+			continue
+		}
+		entries = append(entries, timelineEntry{time: t, source: source, lines: append(leading, msg)})
+		leading = nil
+	}
+	if len(leading) > 0 {
+		// None of the lines has a timestamp.
+		entries = append(entries, timelineEntry{source: source, lines: leading})
+	}
+	return entries
+}
+
+// fileName replaces the characters of s that do not belong in a file name.
+func fileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.=", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
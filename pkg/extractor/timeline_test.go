@@ -0,0 +1,150 @@
+package extractor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube/fake"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseTimeline(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		logs string
+		want []timelineEntry
+	}{
+		{
+			name: "single lines",
+			logs: "2024-03-01T10:00:00Z started\n2024-03-01T10:00:01.5Z ready\n",
+			want: []timelineEntry{
+				{time: t0, source: "web-1/app", lines: []string{"started"}},
+				{time: t0.Add(1500 * time.Millisecond), source: "web-1/app", lines: []string{"ready"}},
+			},
+		},
+		{
+			name: "java stack trace",
+			logs: "2024-03-01T10:00:00Z java.lang.IllegalStateException: boom\n" +
+				"2024-03-01T10:00:00Z \tat com.example.Main.run(Main.java:10)\n" +
+				"2024-03-01T10:00:00Z Caused by: java.io.IOException: closed\n" +
+				"2024-03-01T10:00:00Z \t... 3 more\n" +
+				"2024-03-01T10:00:01Z stopped\n",
+			want: []timelineEntry{
+				{time: t0, source: "web-1/app", lines: []string{
+					"java.lang.IllegalStateException: boom",
+					"\tat com.example.Main.run(Main.java:10)",
+					"Caused by: java.io.IOException: closed",
+					"\t... 3 more",
+				}},
+				{time: t0.Add(time.Second), source: "web-1/app", lines: []string{"stopped"}},
+			},
+		},
+		{
+			name: "lines without a timestamp",
+			logs: "2024-03-01T10:00:00Z panic: boom\ngoroutine 1 [running]:\n\n2024-03-01T10:00:01Z restarted\n",
+			want: []timelineEntry{
+				{time: t0, source: "web-1/app", lines: []string{"panic: boom", "goroutine 1 [running]:", ""}},
+				{time: t0.Add(time.Second), source: "web-1/app", lines: []string{"restarted"}},
+			},
+		},
+		{
+			name: "leading line without a timestamp",
+			logs: "\tat com.example.Main.run(Main.java:10)\n2024-03-01T10:00:00Z started\n",
+			want: []timelineEntry{
+				{time: t0, source: "web-1/app", lines: []string{"\tat com.example.Main.run(Main.java:10)", "started"}},
+			},
+		},
+		{
+			name: "no timestamp",
+			logs: "started\nready\n",
+			want: []timelineEntry{
+				{source: "web-1/app", lines: []string{"started", "ready"}},
+			},
+		},
+		{
+			name: "empty",
+			logs: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseTimeline("web-1/app", tt.logs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTimeline() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func timelinePod(name, app string, restarted bool) *kubeApiCore.Pod {
+	status := kubeApiCore.ContainerStatus{Name: "app", State: kubeApiCore.ContainerState{Running: &kubeApiCore.ContainerStateRunning{}}}
+	if restarted {
+		status.LastTerminationState.Terminated = &kubeApiCore.ContainerStateTerminated{ExitCode: 1}
+	}
+	return &kubeApiCore.Pod{
+		ObjectMeta: kubeApiMeta.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": app}},
+		Spec:       kubeApiCore.PodSpec{Containers: []kubeApiCore.Container{{Name: "app"}}},
+		Status:     kubeApiCore.PodStatus{ContainerStatuses: []kubeApiCore.ContainerStatus{status}},
+	}
+}
+
+func timelineCluster() *fake.Accessor {
+	acc := fake.NewAccessor(timelinePod("web-1", "web", true), timelinePod("web-2", "web", false), timelinePod("db-1", "db", false))
+	acc.ContainerLogs[fake.LogKey("default", "web-1", "app", true)] = "2024-03-01T10:00:00Z panic: boom\ngoroutine 1 [running]:\n"
+	acc.ContainerLogs[fake.LogKey("default", "web-1", "app", false)] = "2024-03-01T10:00:03Z started\n2024-03-01T10:00:05Z ready\n"
+	acc.ContainerLogs[fake.LogKey("default", "web-2", "app", false)] = "2024-03-01T10:00:01Z calling db\n2024-03-01T10:00:04Z retrying\n"
+	acc.ContainerLogs[fake.LogKey("default", "db-1", "app", false)] = "2024-03-01T10:00:02Z shutting down\n"
+	return acc
+}
+
+// The entries of the pods are merged in time order, whatever the order of the pods and of their
+// containers, and the lines of an entry stay together.
+func TestTimelineInterleaved(t *testing.T) {
+	out := sink.NewMemorySink()
+	if err := (TimelineExtractor{}).Extract(timelineCluster(), out); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := out.Get("timeline/default.log")
+	if !ok {
+		t.Fatalf("no timeline written, got %q", out.Paths())
+	}
+	want := "2024-03-01T10:00:00.000000000Z [web-1/app (previous)] panic: boom\n" +
+		"2024-03-01T10:00:00.000000000Z [web-1/app (previous)] goroutine 1 [running]:\n" +
+		"2024-03-01T10:00:01.000000000Z [web-2/app] calling db\n" +
+		"2024-03-01T10:00:02.000000000Z [db-1/app] shutting down\n" +
+		"2024-03-01T10:00:03.000000000Z [web-1/app] started\n" +
+		"2024-03-01T10:00:04.000000000Z [web-2/app] retrying\n" +
+		"2024-03-01T10:00:05.000000000Z [web-1/app] ready\n"
+	if string(b) != want {
+		t.Errorf("timeline =\n%s\nwant\n%s", b, want)
+	}
+}
+
+// A selector merges the matching pods into one timeline named after it.
+func TestTimelineSelector(t *testing.T) {
+	e, err := (TimelineExtractor{}).Configure(Options{TimelineSelector: "app in (web), tier!=db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := sink.NewMemorySink()
+	if err := e.Extract(timelineCluster(), out); err != nil {
+		t.Fatal(err)
+	}
+	name := "timeline/selector-app_in__web__tier_=db.log"
+	if want := []string{name}; !reflect.DeepEqual(out.Paths(), want) {
+		t.Fatalf("paths = %q, want %q", out.Paths(), want)
+	}
+	b, _ := out.Get(name)
+	if strings.Contains(string(b), "db-1") || strings.Count(string(b), "\n") != 6 {
+		t.Errorf("timeline of the selected pods =\n%s", b)
+	}
+
+	if _, err := (TimelineExtractor{}).Configure(Options{TimelineSelector: "app in ("}); err == nil {
+		t.Error("Configure() with an invalid selector succeeded")
+	}
+}
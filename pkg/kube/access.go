@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"strings"
+
+	kubeApiAuth "k8s.io/api/authorization/v1"
+)
+
+// Permission is a verb on a resource that an extractor needs.
+type Permission struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	// Namespace is the namespace the permission is needed in, every namespace if empty.
+	Namespace string
+	// Optional permissions only degrade the output of an extractor when they are missing.
+	Optional bool
+}
+
+func (p Permission) String() string {
+	r := p.Resource
+	if p.Subresource != "" {
+		r += "/" + p.Subresource
+	}
+	if p.Group != "" {
+		r += "." + p.Group
+	}
+	if p.Namespace != "" {
+		r += " in " + p.Namespace
+	}
+	return p.Verb + " " + r
+}
+
+// CanI asks the API server whether the current identity has p in its namespace, or in every
+// namespace if it has none, the same way kubectl auth can-i does. It returns the reason given by the authorizer.
+func (a *Accessor) CanI(p Permission) (bool, string, error) {
+	review := &kubeApiAuth.SelfSubjectAccessReview{
+		Spec: kubeApiAuth.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &kubeApiAuth.ResourceAttributes{
+				Namespace:   p.Namespace,
+				Verb:        p.Verb,
+				Group:       p.Group,
+				Resource:    p.Resource,
+				Subresource: p.Subresource,
+			},
+		},
+	}
+	r, err := a.set.AuthorizationV1().SelfSubjectAccessReviews().Create(review)
+	if err != nil {
+		return false, "", err
+	}
+	reason := strings.TrimSpace(r.Status.Reason)
+	if r.Status.EvaluationError != "" {
+		reason = strings.TrimSpace(reason + " " + r.Status.EvaluationError)
+	}
+	return r.Status.Allowed, reason, nil
+}
@@ -19,14 +19,70 @@ import (
 	kubeApiCore "k8s.io/api/core/v1"
 	kubeExtClient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/dynamic"
 	kubeClient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth" // Needed for auth
 	"k8s.io/client-go/rest"
+	"sort"
+	"time"
 )
 
+// LogOptions selects the log returned by Interface.Logs.
+type LogOptions struct {
+	// Previous returns the log of the previous instance of the container.
+	Previous bool
+	// Timestamps prefixes every line with the RFC3339 time it was written at.
+	Timestamps bool
+	// SinceTime, if set, only returns the lines written at or after it.
+	SinceTime time.Time
+}
+
+// Interface is the set of operations the extractors use to read a cluster. It is implemented
+// by Accessor and, backed by fake clientsets, by the accessor in pkg/kube/fake.
+type Interface interface {
+	GetPods(pod, ns string) (string, error)
+	// Logs calls the logs command for the specified pod, with -c, if container is specified.
+	Logs(namespace string, pod string, container string, opts LogOptions) (string, error)
+	DumpInfo(outputDir, ns string) (string, error)
+	GetNamespaces() ([]kubeApiCore.Namespace, error)
+	// ListPods returns the pods of ns, or of every namespace for "all", in a list carrying its
+	// resourceVersion.
+	ListPods(ns string) (*kubeApiCore.PodList, error)
+	ListCRDs() ([]string, error)
+	GetEvents(ns string) (string, error)
+	GetNodes(node string) (string, error)
+	DescribeNode(node string) (string, error)
+	DescribePod(pod, ns string) (string, error)
+	DescribeCM(cm, ns string) (string, error)
+	DescribeSVC(svc, ns string) (string, error)
+	DescribeCRD(crd, ns string) (string, error)
+	DescribeCR(cr, crd, ns string) (string, error)
+	// CanI reports whether the current identity has a permission in every namespace.
+	CanI(p Permission) (bool, string, error)
+	// Identity returns who the cluster is accessed as.
+	Identity() Identity
+	ServerVersion() (string, string, error)
+	APIResources() ([]string, error)
+	ListNodes() (*kubeApiCore.NodeList, error)
+	// ListSecrets returns the secrets of ns, or of every namespace for "all", matching the label
+	// selector.
+	ListSecrets(ns, selector string) ([]kubeApiCore.Secret, error)
+	// ListConfigMaps returns the config maps of ns, or of every namespace for "all", matching
+	// the label selector.
+	ListConfigMaps(ns, selector string) ([]kubeApiCore.ConfigMap, error)
+	ListServices(ns string) ([]kubeApiCore.Service, error)
+	ListEndpoints(ns string) ([]kubeApiCore.Endpoints, error)
+	// ListResource returns the objects of any resource served by the cluster, in ns or in every
+	// namespace for "all". ns is ignored for cluster scoped resources.
+	ListResource(resource schema.GroupVersionResource, ns string) ([]unstructured.Unstructured, error)
+}
+
+var _ Interface = &Accessor{}
+
 // Accessor is a helper for accessing Kubernetes programmatically. It bundles some of the high-level
 // operations that is frequently used by the test framework.
 type Accessor struct {
@@ -35,14 +91,38 @@ type Accessor struct {
 	set        *kubeClient.Clientset
 	extSet     *kubeExtClient.Clientset
 	dynClient  dynamic.Interface
+	identity   Identity
+}
+
+// Options customizes how an Accessor reaches the cluster.
+type Options struct {
+	// CLI is the kubectl compatible tool used for describe, logs and cluster-info dump.
+	CLI CLI
+	// Impersonate makes every request, including the CLI calls, act as another user.
+	Impersonate Impersonation
+	// Credentials replace the credentials of the kubeconfig.
+	Credentials Credentials
 }
 
 // NewAccessor returns a new instance of an accessor.
-func NewAccessor(kubeConfig string, baseWorkDir string) (*Accessor, error) {
+func NewAccessor(kubeConfig string, baseWorkDir string, opts Options) (*Accessor, error) {
+	if err := opts.Impersonate.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Credentials.validate(); err != nil {
+		return nil, err
+	}
 	restConfig, err := BuildClientConfig(kubeConfig, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create rest config. %v", err)
 	}
+	opts.apply(restConfig)
+	credentials, err := opts.credentialsKubeconfig(kubeConfig, restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the kubeconfig of the credentials: %v", err)
+	}
+	cli := opts.CLI
+	cli.Args = append(append([]string(nil), cli.Args...), opts.cliArgs()...)
 	restConfig.APIPath = "/api"
 	restConfig.GroupVersion = &kubeApiCore.SchemeGroupVersion
 	restConfig.NegotiatedSerializer = serializer.WithoutConversionCodecFactory{CodecFactory: scheme.Codecs}
@@ -65,22 +145,45 @@ func NewAccessor(kubeConfig string, baseWorkDir string) (*Accessor, error) {
 	return &Accessor{
 		restConfig: restConfig,
 		ctl: &kubectl{
-			kubeConfig: kubeConfig,
-			baseDir:    baseWorkDir,
+			cli:         cli,
+			kubeConfig:  kubeConfig,
+			credentials: credentials,
+			baseDir:     baseWorkDir,
 		},
 		set:       set,
 		extSet:    extSet,
 		dynClient: dynClient,
+		identity:  newIdentity(kubeConfig, opts),
 	}, nil
 }
 
+func newIdentity(kubeConfig string, opts Options) Identity {
+	id := Identity{Kubeconfig: kubeConfig, Credentials: opts.Credentials.describe()}
+	if raw, err := BuildClientCmd(kubeConfig, "").RawConfig(); err == nil {
+		id.Context = raw.CurrentContext
+		if ctx, ok := raw.Contexts[raw.CurrentContext]; ok {
+			id.User = ctx.AuthInfo
+		}
+	}
+	if !opts.Impersonate.empty() {
+		imp := opts.Impersonate
+		id.Impersonate = &imp
+	}
+	return id
+}
+
+// Identity returns who the accessor talks to the cluster as.
+func (a *Accessor) Identity() Identity {
+	return a.identity
+}
+
 func (a *Accessor) GetPods(pod, ns string) (string, error) {
 	return a.ctl.pods(pod, ns)
 }
 
 // Logs calls the logs command for the specified pod, with -c, if container is specified.
-func (a *Accessor) Logs(namespace string, pod string, container string, previousLog bool) (string, error) {
-	return a.ctl.logs(namespace, pod, container, previousLog)
+func (a *Accessor) Logs(namespace string, pod string, container string, opts LogOptions) (string, error) {
+	return a.ctl.logs(namespace, pod, container, opts)
 }
 
 func (a *Accessor) DumpInfo(outputDir, ns string) (string, error) {
@@ -96,6 +199,41 @@ func (a *Accessor) GetNamespaces() ([]kubeApiCore.Namespace, error) {
 	return n.Items, nil
 }
 
+// ListPods returns the pods of ns, or of every namespace if ns is "all".
+func (a *Accessor) ListPods(ns string) (*kubeApiCore.PodList, error) {
+	var opts kubeApiMeta.ListOptions
+	if ns == "all" {
+		ns = ""
+	}
+	return a.set.CoreV1().Pods(ns).List(opts)
+}
+
+// ListCRDs returns the names of all custom resource definitions in the cluster.
+func (a *Accessor) ListCRDs() ([]string, error) {
+	var opts kubeApiMeta.ListOptions
+	l, err := a.extSet.ApiextensionsV1().CustomResourceDefinitions().List(opts)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(l.Items))
+	for _, crd := range l.Items {
+		names = append(names, crd.Name)
+	}
+	return names, nil
+}
+
+func (a *Accessor) GetEvents(ns string) (string, error) {
+	return a.ctl.events(ns)
+}
+
+func (a *Accessor) GetNodes(node string) (string, error) {
+	return a.ctl.nodes(node)
+}
+
+func (a *Accessor) DescribeNode(node string) (string, error) {
+	return a.ctl.describeNode(node)
+}
+
 func (a *Accessor) DescribePod(pod, ns string) (string, error) {
 	return a.ctl.describePod(pod, ns)
 }
@@ -115,3 +253,101 @@ func (a *Accessor) DescribeCRD(crd, ns string) (string, error) {
 func (a *Accessor) DescribeCR(cr, crd, ns string) (string, error) {
 	return a.ctl.describeCR(cr, crd, ns)
 }
+
+// ServerVersion returns the version of the API server and its platform.
+func (a *Accessor) ServerVersion() (string, string, error) {
+	v, err := a.set.Discovery().ServerVersion()
+	if err != nil {
+		return "", "", err
+	}
+	return v.GitVersion, v.Platform, nil
+}
+
+// APIResources returns the preferred version of every resource served by the cluster, in the
+// form resource.group/version. Resources of API groups that failed discovery are left out.
+func (a *Accessor) APIResources() ([]string, error) {
+	lists, err := a.set.Discovery().ServerPreferredResources()
+	if len(lists) == 0 && err != nil {
+		return nil, err
+	}
+	return resourceNames(lists), nil
+}
+
+func resourceNames(lists []*kubeApiMeta.APIResourceList) []string {
+	var names []string
+	for _, l := range lists {
+		for _, r := range l.APIResources {
+			names = append(names, r.Name+"."+l.GroupVersion)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *Accessor) ListSecrets(ns, selector string) ([]kubeApiCore.Secret, error) {
+	if ns == "all" {
+		ns = ""
+	}
+	l, err := a.set.CoreV1().Secrets(ns).List(kubeApiMeta.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+func (a *Accessor) ListConfigMaps(ns, selector string) ([]kubeApiCore.ConfigMap, error) {
+	if ns == "all" {
+		ns = ""
+	}
+	l, err := a.set.CoreV1().ConfigMaps(ns).List(kubeApiMeta.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+// ListNodes returns every node of the cluster.
+func (a *Accessor) ListNodes() (*kubeApiCore.NodeList, error) {
+	var opts kubeApiMeta.ListOptions
+	return a.set.CoreV1().Nodes().List(opts)
+}
+
+// ListServices returns the services of ns, or of every namespace if ns is "all".
+func (a *Accessor) ListServices(ns string) ([]kubeApiCore.Service, error) {
+	var opts kubeApiMeta.ListOptions
+	if ns == "all" {
+		ns = ""
+	}
+	l, err := a.set.CoreV1().Services(ns).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+// ListEndpoints returns the endpoints of ns, or of every namespace if ns is "all".
+func (a *Accessor) ListEndpoints(ns string) ([]kubeApiCore.Endpoints, error) {
+	var opts kubeApiMeta.ListOptions
+	if ns == "all" {
+		ns = ""
+	}
+	l, err := a.set.CoreV1().Endpoints(ns).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+// ListResource lists resource with the dynamic client, so that APIs the clientset does not know,
+// e.g. the Gateway API, can be read when the cluster serves them.
+func (a *Accessor) ListResource(resource schema.GroupVersionResource, ns string) ([]unstructured.Unstructured, error) {
+	var opts kubeApiMeta.ListOptions
+	if ns == "all" {
+		ns = ""
+	}
+	l, err := a.dynClient.Resource(resource).Namespace(ns).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
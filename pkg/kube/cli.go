@@ -0,0 +1,106 @@
+package kube
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/shell"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultCLIBinary is the tool used when CLI.Binary is empty.
+	DefaultCLIBinary = "kubectl"
+
+	minCLIMajor = 1
+	minCLIMinor = 16
+)
+
+// CLI describes the command line tool used for the operations not done through client-go.
+// Any kubectl compatible binary works, e.g. oc on OpenShift or a pinned kubectl outside of PATH.
+type CLI struct {
+	// Binary is the name or path of the tool.
+	Binary string
+	// Args are passed to every invocation, e.g. --request-timeout=30s.
+	Args []string
+}
+
+func (c CLI) binary() string {
+	if c.Binary == "" {
+		return DefaultCLIBinary
+	}
+	return c.Binary
+}
+
+// command returns a command running the tool with the global args followed by args.
+func (c CLI) command(args ...string) *shell.Command {
+	return shell.NewCommand(c.binary()).Arg(c.Args...).Arg(args...)
+}
+
+// CheckCLI makes sure the tool can be run and is recent enough, and returns its version. The
+// global args are passed to the check as well. When the version cannot be determined, e.g. for
+// a development build, the check only warns.
+func CheckCLI(c CLI) (string, error) {
+	if _, err := exec.LookPath(c.binary()); err != nil {
+		return "", fmt.Errorf("%s was not found: install it or set its path with --cli: %v", c.binary(), err)
+	}
+	out, err := c.command("version", "--client", "--output=json").Execute(false)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("failed to get the version of %s, is it kubectl compatible? %v", c.binary(), err)
+	}
+	var v struct {
+		ClientVersion struct {
+			Major      string `json:"major"`
+			Minor      string `json:"minor"`
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+	}
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		return "", fmt.Errorf("unexpected version output of %s: %v", c.binary(), err)
+	}
+	version := v.ClientVersion.GitVersion
+	major, minor, ok := parseCLIVersion(v.ClientVersion.Major, v.ClientVersion.Minor, version)
+	if !ok {
+		if version == "" {
+			version = "unknown version"
+		}
+		logrus.Warnf("Could not determine the version of %s (%s), version %d.%d or newer is required",
+			c.binary(), version, minCLIMajor, minCLIMinor)
+		return version, nil
+	}
+	if major < minCLIMajor || major == minCLIMajor && minor < minCLIMinor {
+		return "", fmt.Errorf("%s %s is not supported, version %d.%d or newer is required",
+			c.binary(), version, minCLIMajor, minCLIMinor)
+	}
+	return version, nil
+}
+
+var gitVersion = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// parseCLIVersion returns the version of the tool from the major and minor fields of kubectl
+// version, or from gitVersion, e.g. v1.27.3+a1b2c3d, when they are empty as with oc. The
+// v0.0.0 of development builds is not a version.
+func parseCLIVersion(major, minor, git string) (int, int, bool) {
+	// Minor versions of some distributions carry a suffix, e.g. "18+".
+	maj, err1 := strconv.Atoi(strings.TrimRight(major, "+"))
+	min, err2 := strconv.Atoi(strings.TrimRight(minor, "+"))
+	if err1 == nil && err2 == nil {
+		return maj, min, true
+	}
+	m := gitVersion.FindStringSubmatch(git)
+	if m == nil {
+		return 0, 0, false
+	}
+	maj, _ = strconv.Atoi(m[1])
+	min, _ = strconv.Atoi(m[2])
+	return maj, min, maj > 0 || min > 0
+}
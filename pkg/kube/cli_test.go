@@ -0,0 +1,30 @@
+package kube
+
+import "testing"
+
+func TestParseCLIVersion(t *testing.T) {
+	tests := []struct {
+		name                 string
+		major, minor, git    string
+		wantMajor, wantMinor int
+		ok                   bool
+	}{
+		{name: "kubectl", major: "1", minor: "18", git: "v1.18.2", wantMajor: 1, wantMinor: 18, ok: true},
+		{name: "minor with suffix", major: "1", minor: "27+", git: "v1.27.3-eks-a5565ad", wantMajor: 1, wantMinor: 27, ok: true},
+		{name: "oc without major and minor", git: "v4.14.0-202310201027.p0.g0c63f9d.assembly.stream-0c63f9d", wantMajor: 4, wantMinor: 14, ok: true},
+		{name: "git version with build metadata", git: "v1.27.3+a1b2c3d", wantMajor: 1, wantMinor: 27, ok: true},
+		{name: "unparsable minor falls back to git version", major: "1", minor: "x", git: "v1.20.0", wantMajor: 1, wantMinor: 20, ok: true},
+		{name: "development build", git: "v0.0.0-master+$Format:%H$", ok: false},
+		{name: "unknown", git: "", ok: false},
+		{name: "not a version", git: "devel", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			major, minor, ok := parseCLIVersion(tt.major, tt.minor, tt.git)
+			if ok != tt.ok || major != tt.wantMajor || minor != tt.wantMinor {
+				t.Errorf("parseCLIVersion(%q, %q, %q) = %d, %d, %v, want %d, %d, %v",
+					tt.major, tt.minor, tt.git, major, minor, ok, tt.wantMajor, tt.wantMinor, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,479 @@
+// Package fake provides a kube.Interface backed by the fake clientsets of client-go, so
+// extractors can run without a cluster or a kubectl binary.
+package fake
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/kube"
+	kubeApiCore "k8s.io/api/core/v1"
+	kubeApiExt "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	kubeExtFake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	kubeApiMeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	kubeFake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// Accessor implements kube.Interface on top of fake clientsets. The output of the describe and
+// get methods mimics kubectl closely enough for the extractors to split it per object.
+type Accessor struct {
+	Kube    *kubeFake.Clientset
+	Ext     *kubeExtFake.Clientset
+	Dynamic *dynamicFake.FakeDynamicClient
+	// ContainerLogs holds the container logs, keyed by LogKey, the way kubectl logs --timestamps
+	// prints them. The timestamps are stripped unless requested.
+	ContainerLogs map[string]string
+	// Forbidden lists the permissions CanI denies, keyed by kube.Permission.String.
+	// Everything else is allowed.
+	Forbidden map[string]bool
+}
+
+var _ kube.Interface = &Accessor{}
+
+// NewAccessor returns an accessor serving objects. CRDs are served by the apiextensions
+// clientset, unstructured objects by the dynamic client and everything else by the kubernetes
+// clientset.
+func NewAccessor(objects ...runtime.Object) *Accessor {
+	var core, ext, dyn []runtime.Object
+	for _, o := range objects {
+		switch o.(type) {
+		case *kubeApiExt.CustomResourceDefinition:
+			ext = append(ext, o)
+		case *unstructured.Unstructured:
+			dyn = append(dyn, o)
+		default:
+			core = append(core, o)
+		}
+	}
+	return &Accessor{
+		Kube:          kubeFake.NewSimpleClientset(core...),
+		Ext:           kubeExtFake.NewSimpleClientset(ext...),
+		Dynamic:       dynamicFake.NewSimpleDynamicClient(runtime.NewScheme(), dyn...),
+		ContainerLogs: map[string]string{},
+		Forbidden:     map[string]bool{},
+	}
+}
+
+// LogKey returns the key of a container log in Accessor.ContainerLogs.
+func LogKey(namespace, pod, container string, previous bool) string {
+	key := namespace + "/" + pod + "/" + container
+	if previous {
+		key += "/previous"
+	}
+	return key
+}
+
+func (a *Accessor) GetPods(pod, ns string) (string, error) {
+	pods, err := a.pods(pod, ns)
+	if err != nil {
+		return "", err
+	}
+	rows := [][]string{{"NAMESPACE", "NAME", "READY", "STATUS", "RESTARTS"}}
+	for _, p := range pods {
+		ready, restarts := 0, int32(0)
+		for _, cs := range p.Status.ContainerStatuses {
+			if cs.Ready {
+				ready++
+			}
+			restarts += cs.RestartCount
+		}
+		rows = append(rows, []string{p.Namespace, p.Name, fmt.Sprintf("%d/%d", ready, len(p.Spec.Containers)),
+			string(p.Status.Phase), fmt.Sprint(restarts)})
+	}
+	return table(rows), nil
+}
+
+func (a *Accessor) Logs(namespace string, pod string, container string, opts kube.LogOptions) (string, error) {
+	l, ok := a.ContainerLogs[LogKey(namespace, pod, container, opts.Previous)]
+	if !ok {
+		return "", fmt.Errorf("container %q in pod %q is not available", container, pod)
+	}
+	var lines []string
+	for _, line := range strings.Split(l, "\n") {
+		if j := strings.IndexByte(line, ' '); j > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, line[:j]); err == nil {
+				if t.Before(opts.SinceTime) {
+					continue
+				}
+				if !opts.Timestamps {
+					line = line[j+1:]
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// DumpInfo writes the nodes and, per namespace, the pods, services and events the same way
+// kubectl cluster-info dump --output=yaml does.
+func (a *Accessor) DumpInfo(outputDir, ns string) (string, error) {
+	nodes, err := a.Kube.CoreV1().Nodes().List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	if err := writeYAML(filepath.Join(outputDir, "nodes.yaml"), nodes); err != nil {
+		return "", err
+	}
+	namespaces, err := a.namespaces(ns)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range namespaces {
+		dir := filepath.Join(outputDir, n)
+		pods, err := a.Kube.CoreV1().Pods(n).List(kubeApiMeta.ListOptions{})
+		if err != nil {
+			return "", err
+		}
+		if err := writeYAML(filepath.Join(dir, "pods.yaml"), pods); err != nil {
+			return "", err
+		}
+		svcs, err := a.Kube.CoreV1().Services(n).List(kubeApiMeta.ListOptions{})
+		if err != nil {
+			return "", err
+		}
+		if err := writeYAML(filepath.Join(dir, "services.yaml"), svcs); err != nil {
+			return "", err
+		}
+		events, err := a.Kube.CoreV1().Events(n).List(kubeApiMeta.ListOptions{})
+		if err != nil {
+			return "", err
+		}
+		if err := writeYAML(filepath.Join(dir, "events.yaml"), events); err != nil {
+			return "", err
+		}
+	}
+	return "Cluster info dumped to " + outputDir, nil
+}
+
+func (a *Accessor) GetNamespaces() ([]kubeApiCore.Namespace, error) {
+	n, err := a.Kube.CoreV1().Namespaces().List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return n.Items, nil
+}
+
+func (a *Accessor) ListPods(ns string) (*kubeApiCore.PodList, error) {
+	return a.Kube.CoreV1().Pods(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+}
+
+func (a *Accessor) ListCRDs() ([]string, error) {
+	l, err := a.Ext.ApiextensionsV1().CustomResourceDefinitions().List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, crd := range l.Items {
+		names = append(names, crd.Name)
+	}
+	return names, nil
+}
+
+func (a *Accessor) GetEvents(ns string) (string, error) {
+	l, err := a.Kube.CoreV1().Events(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	rows := [][]string{{"NAMESPACE", "TYPE", "REASON", "OBJECT", "MESSAGE"}}
+	for _, e := range l.Items {
+		rows = append(rows, []string{e.Namespace, e.Type, e.Reason,
+			strings.ToLower(e.InvolvedObject.Kind) + "/" + e.InvolvedObject.Name, e.Message})
+	}
+	return table(rows), nil
+}
+
+func (a *Accessor) GetNodes(node string) (string, error) {
+	nodes, err := a.nodes(node)
+	if err != nil {
+		return "", err
+	}
+	rows := [][]string{{"NAME", "STATUS"}}
+	for _, n := range nodes {
+		status := "NotReady"
+		for _, c := range n.Status.Conditions {
+			if c.Type == kubeApiCore.NodeReady && c.Status == kubeApiCore.ConditionTrue {
+				status = "Ready"
+			}
+		}
+		rows = append(rows, []string{n.Name, status})
+	}
+	return table(rows), nil
+}
+
+func (a *Accessor) DescribeNode(node string) (string, error) {
+	nodes, err := a.nodes(node)
+	if err != nil {
+		return "", err
+	}
+	var objs []kubeApiMeta.Object
+	for i := range nodes {
+		objs = append(objs, &nodes[i])
+	}
+	return describe(objs), nil
+}
+
+func (a *Accessor) DescribePod(pod, ns string) (string, error) {
+	pods, err := a.pods(pod, ns)
+	if err != nil {
+		return "", err
+	}
+	var objs []kubeApiMeta.Object
+	for i := range pods {
+		objs = append(objs, &pods[i])
+	}
+	return describe(objs), nil
+}
+
+func (a *Accessor) DescribeCM(cm, ns string) (string, error) {
+	l, err := a.Kube.CoreV1().ConfigMaps(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	var objs []kubeApiMeta.Object
+	for i := range l.Items {
+		if cm == "" || l.Items[i].Name == cm {
+			objs = append(objs, &l.Items[i])
+		}
+	}
+	return describe(objs), nil
+}
+
+func (a *Accessor) DescribeSVC(svc, ns string) (string, error) {
+	l, err := a.Kube.CoreV1().Services(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	var objs []kubeApiMeta.Object
+	for i := range l.Items {
+		if svc == "" || l.Items[i].Name == svc {
+			objs = append(objs, &l.Items[i])
+		}
+	}
+	return describe(objs), nil
+}
+
+func (a *Accessor) DescribeCRD(crd, _ string) (string, error) {
+	l, err := a.Ext.ApiextensionsV1().CustomResourceDefinitions().List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	var objs []kubeApiMeta.Object
+	for i := range l.Items {
+		if crd == "" || l.Items[i].Name == crd {
+			objs = append(objs, &l.Items[i])
+		}
+	}
+	return describe(objs), nil
+}
+
+func (a *Accessor) DescribeCR(cr, crd, ns string) (string, error) {
+	def, err := a.Ext.ApiextensionsV1().CustomResourceDefinitions().Get(crd, kubeApiMeta.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if len(def.Spec.Versions) == 0 {
+		return "", fmt.Errorf("crd %s has no versions", crd)
+	}
+	gvr := schema.GroupVersionResource{Group: def.Spec.Group, Version: def.Spec.Versions[0].Name, Resource: def.Spec.Names.Plural}
+	l, err := a.Dynamic.Resource(gvr).Namespace(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	var objs []kubeApiMeta.Object
+	for i := range l.Items {
+		if cr == "" || l.Items[i].GetName() == cr {
+			objs = append(objs, &l.Items[i])
+		}
+	}
+	return describe(objs), nil
+}
+
+func (a *Accessor) CanI(p kube.Permission) (bool, string, error) {
+	if a.Forbidden[p.String()] {
+		return false, "forbidden by the fake accessor", nil
+	}
+	return true, "", nil
+}
+
+func (a *Accessor) pods(pod, ns string) ([]kubeApiCore.Pod, error) {
+	l, err := a.Kube.CoreV1().Pods(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var pods []kubeApiCore.Pod
+	for _, p := range l.Items {
+		if pod == "" || p.Name == pod {
+			pods = append(pods, p)
+		}
+	}
+	return pods, nil
+}
+
+func (a *Accessor) nodes(node string) ([]kubeApiCore.Node, error) {
+	l, err := a.Kube.CoreV1().Nodes().List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var nodes []kubeApiCore.Node
+	for _, n := range l.Items {
+		if node == "" || n.Name == node {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+func (a *Accessor) namespaces(ns string) ([]string, error) {
+	if ns != "all" && ns != "" {
+		return []string{ns}, nil
+	}
+	l, err := a.GetNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, n := range l {
+		names = append(names, n.Name)
+	}
+	return names, nil
+}
+
+// allNamespaces translates the "all" namespace of the kubectl based accessor to the empty
+// namespace of client-go.
+func allNamespaces(ns string) string {
+	if ns == "all" {
+		return ""
+	}
+	return ns
+}
+
+// describe renders the objects the way kubectl describe separates them, one "Name:" block each.
+func describe(objs []kubeApiMeta.Object) string {
+	if len(objs) == 0 {
+		return "No resources found"
+	}
+	var blocks []string
+	for _, o := range objs {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Name:         %s\n", o.GetName())
+		if o.GetNamespace() != "" {
+			fmt.Fprintf(&b, "Namespace:    %s\n", o.GetNamespace())
+		}
+		fmt.Fprintf(&b, "Labels:       %s\n", keyValues(o.GetLabels()))
+		fmt.Fprintf(&b, "Annotations:  %s\n", keyValues(o.GetAnnotations()))
+		blocks = append(blocks, b.String())
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+func keyValues(m map[string]string) string {
+	if len(m) == 0 {
+		return "<none>"
+	}
+	var kv []string
+	for k, v := range m {
+		kv = append(kv, k+"="+v)
+	}
+	sort.Strings(kv)
+	return strings.Join(kv, "\n              ")
+}
+
+func table(rows [][]string) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 3, ' ', 0)
+	for _, r := range rows {
+		_, _ = fmt.Fprintln(w, strings.Join(r, "\t"))
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+func writeYAML(path string, obj interface{}) error {
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+func (a *Accessor) Identity() kube.Identity {
+	return kube.Identity{Kubeconfig: "fake", Credentials: "kubeconfig"}
+}
+
+func (a *Accessor) ServerVersion() (string, string, error) {
+	v, err := a.Kube.Discovery().ServerVersion()
+	if err != nil {
+		return "", "", err
+	}
+	return v.GitVersion, v.Platform, nil
+}
+
+func (a *Accessor) APIResources() ([]string, error) {
+	var names []string
+	for _, l := range a.Kube.Resources {
+		for _, r := range l.APIResources {
+			names = append(names, r.Name+"."+l.GroupVersion)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (a *Accessor) ListNodes() (*kubeApiCore.NodeList, error) {
+	return a.Kube.CoreV1().Nodes().List(kubeApiMeta.ListOptions{})
+}
+
+func (a *Accessor) ListSecrets(ns, selector string) ([]kubeApiCore.Secret, error) {
+	l, err := a.Kube.CoreV1().Secrets(allNamespaces(ns)).List(kubeApiMeta.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+func (a *Accessor) ListConfigMaps(ns, selector string) ([]kubeApiCore.ConfigMap, error) {
+	l, err := a.Kube.CoreV1().ConfigMaps(allNamespaces(ns)).List(kubeApiMeta.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+func (a *Accessor) ListServices(ns string) ([]kubeApiCore.Service, error) {
+	l, err := a.Kube.CoreV1().Services(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+func (a *Accessor) ListEndpoints(ns string) ([]kubeApiCore.Endpoints, error) {
+	l, err := a.Kube.CoreV1().Endpoints(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
+
+func (a *Accessor) ListResource(resource schema.GroupVersionResource, ns string) ([]unstructured.Unstructured, error) {
+	l, err := a.Dynamic.Resource(resource).Namespace(allNamespaces(ns)).List(kubeApiMeta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return l.Items, nil
+}
@@ -0,0 +1,172 @@
+package kube
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"k8s.io/client-go/rest"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// impersonateUIDHeader is sent for Impersonation.UID, which the rest.ImpersonationConfig of
+// this client-go version does not support.
+const impersonateUIDHeader = "Impersonate-Uid"
+
+// Impersonation makes every request act as another user, like kubectl --as.
+type Impersonation struct {
+	User   string   `json:"user,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	UID    string   `json:"uid,omitempty"`
+}
+
+func (i Impersonation) empty() bool {
+	return i.User == "" && len(i.Groups) == 0 && i.UID == ""
+}
+
+// Credentials replace the credentials of the kubeconfig.
+type Credentials struct {
+	Token             string `json:"token,omitempty"`
+	TokenFile         string `json:"tokenFile,omitempty"`
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	ClientKey         string `json:"clientKey,omitempty"`
+}
+
+func (c Credentials) empty() bool {
+	return c.Token == "" && c.TokenFile == "" && c.ClientCertificate == "" && c.ClientKey == ""
+}
+
+// describe returns which kind of credentials are used, without revealing them.
+func (c Credentials) describe() string {
+	switch {
+	case c.Token != "":
+		return "token"
+	case c.TokenFile != "":
+		return "token file " + c.TokenFile
+	case c.ClientCertificate != "":
+		return "client certificate " + c.ClientCertificate
+	}
+	return "kubeconfig"
+}
+
+// Identity records who an Accessor talks to the cluster as.
+type Identity struct {
+	Kubeconfig  string         `json:"kubeconfig"`
+	Context     string         `json:"context,omitempty"`
+	User        string         `json:"user,omitempty"`
+	Credentials string         `json:"credentials"`
+	Impersonate *Impersonation `json:"impersonate,omitempty"`
+}
+
+func (i Impersonation) validate() error {
+	if i.User == "" && (len(i.Groups) > 0 || i.UID != "") {
+		return fmt.Errorf("impersonating groups or a uid requires a user")
+	}
+	return nil
+}
+
+func (c Credentials) validate() error {
+	if (c.ClientCertificate == "") != (c.ClientKey == "") {
+		return fmt.Errorf("client certificate and client key have to be set together")
+	}
+	if c.Token != "" && c.TokenFile != "" {
+		return fmt.Errorf("only one of token and token file can be set")
+	}
+	return nil
+}
+
+// apply sets the credentials and the impersonation on restConfig.
+func (o Options) apply(restConfig *rest.Config) {
+	if !o.Credentials.empty() {
+		restConfig.BearerToken = o.Credentials.Token
+		restConfig.BearerTokenFile = o.Credentials.TokenFile
+		restConfig.Username, restConfig.Password = "", ""
+		restConfig.AuthProvider, restConfig.ExecProvider = nil, nil
+		// The client certificate of the kubeconfig would authenticate its own user, it is
+		// replaced or dropped.
+		restConfig.TLSClientConfig.CertFile = o.Credentials.ClientCertificate
+		restConfig.TLSClientConfig.KeyFile = o.Credentials.ClientKey
+		restConfig.TLSClientConfig.CertData, restConfig.TLSClientConfig.KeyData = nil, nil
+	}
+	if o.Impersonate.User != "" {
+		restConfig.Impersonate = rest.ImpersonationConfig{
+			UserName: o.Impersonate.User,
+			Groups:   o.Impersonate.Groups,
+		}
+	}
+	if uid := o.Impersonate.UID; uid != "" {
+		restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req = req.Clone(req.Context())
+				req.Header.Set(impersonateUIDHeader, uid)
+				return rt.RoundTrip(req)
+			})
+		})
+	}
+}
+
+// cliArgs returns the CLI arguments for the impersonation. The credentials are passed in a
+// kubeconfig instead, see credentialsKubeconfig.
+func (o Options) cliArgs() []string {
+	var args []string
+	if o.Impersonate.User != "" {
+		args = append(args, "--as="+o.Impersonate.User)
+	}
+	for _, g := range o.Impersonate.Groups {
+		args = append(args, "--as-group="+g)
+	}
+	if o.Impersonate.UID != "" {
+		args = append(args, "--as-uid="+o.Impersonate.UID)
+	}
+	return args
+}
+
+// credentialsKubeconfig returns a kubeconfig reaching the cluster of restConfig, in the default
+// namespace of kubeConfig, with the credentials, or nil if the credentials are not replaced.
+// Passing it to the CLI keeps a token off its command line, which every user of the host can
+// read.
+func (o Options) credentialsKubeconfig(kubeConfig string, restConfig *rest.Config) ([]byte, error) {
+	if o.Credentials.empty() {
+		return nil, nil
+	}
+	user := clientcmdv1.AuthInfo{Token: o.Credentials.Token}
+	// The kubeconfig is written to another directory, relative paths would not resolve.
+	for _, f := range []struct{ from, to *string }{
+		{&o.Credentials.TokenFile, &user.TokenFile},
+		{&o.Credentials.ClientCertificate, &user.ClientCertificate},
+		{&o.Credentials.ClientKey, &user.ClientKey},
+	} {
+		if *f.from == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*f.from)
+		if err != nil {
+			return nil, err
+		}
+		*f.to = abs
+	}
+	context := clientcmdv1.Context{Cluster: "cluster", AuthInfo: "user"}
+	if ns, _, err := BuildClientCmd(kubeConfig, "").Namespace(); err == nil {
+		context.Namespace = ns
+	}
+	return yaml.Marshal(clientcmdv1.Config{
+		Kind:       "Config",
+		APIVersion: "v1",
+		Clusters: []clientcmdv1.NamedCluster{{Name: "cluster", Cluster: clientcmdv1.Cluster{
+			Server:                   restConfig.Host,
+			InsecureSkipTLSVerify:    restConfig.Insecure,
+			CertificateAuthority:     restConfig.CAFile,
+			CertificateAuthorityData: restConfig.CAData,
+		}}},
+		AuthInfos:      []clientcmdv1.NamedAuthInfo{{Name: "user", AuthInfo: user}},
+		Contexts:       []clientcmdv1.NamedContext{{Name: "cluster", Context: context}},
+		CurrentContext: "cluster",
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
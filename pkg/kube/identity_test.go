@@ -0,0 +1,221 @@
+package kube
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestCredentialsKubeconfig(t *testing.T) {
+	restConfig := &rest.Config{Host: "https://10.0.0.1:6443"}
+	restConfig.CAFile = "/etc/ca.crt"
+	tests := []struct {
+		name  string
+		creds Credentials
+		check func(t *testing.T, token, tokenFile, cert, key string)
+	}{
+		{
+			name:  "token",
+			creds: Credentials{Token: "s3cr3t"},
+			check: func(t *testing.T, token, tokenFile, cert, key string) {
+				if token != "s3cr3t" || tokenFile != "" || cert != "" {
+					t.Errorf("user = %q, %q, %q", token, tokenFile, cert)
+				}
+			},
+		},
+		{
+			name:  "relative files made absolute",
+			creds: Credentials{TokenFile: "token", ClientCertificate: "tls.crt", ClientKey: "tls.key"},
+			check: func(t *testing.T, token, tokenFile, cert, key string) {
+				for _, f := range []string{tokenFile, cert, key} {
+					if !filepath.IsAbs(f) {
+						t.Errorf("path %q is not absolute", f)
+					}
+				}
+				if token != "" || filepath.Base(cert) != "tls.crt" || filepath.Base(key) != "tls.key" {
+					t.Errorf("user = %q, %q, %q", token, cert, key)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Options{Credentials: tt.creds}.credentialsKubeconfig("", restConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := clientcmd.Load(data)
+			if err != nil {
+				t.Fatalf("invalid kubeconfig %s: %v", data, err)
+			}
+			ctx := config.Contexts[config.CurrentContext]
+			if ctx == nil {
+				t.Fatalf("no current context in %s", data)
+			}
+			cluster, user := config.Clusters[ctx.Cluster], config.AuthInfos[ctx.AuthInfo]
+			if cluster.Server != restConfig.Host || cluster.CertificateAuthority != restConfig.CAFile {
+				t.Errorf("cluster = %+v", cluster)
+			}
+			tt.check(t, user.Token, user.TokenFile, user.ClientCertificate, user.ClientKey)
+		})
+	}
+
+	if data, err := (Options{}).credentialsKubeconfig("", restConfig); data != nil || err != nil {
+		t.Errorf("kubeconfig written without credentials: %s, %v", data, err)
+	}
+}
+
+// The token reaches the CLI in a private kubeconfig, which is removed afterwards, and never on
+// its command line.
+func TestKubectlCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The fake CLI prints its arguments, then the mode, the path and the content of the kubeconfig.
+	script := filepath.Join(dir, "kubectl")
+	if err := ioutil.WriteFile(script, []byte(`#!/bin/sh
+echo "$@"
+for a in "$@"; do
+	case "$a" in --kubeconfig=*) f="${a#--kubeconfig=}"; ls -l "$f" 2>/dev/null | cut -c1-10; echo "$f"; cat "$f" 2>/dev/null;; esac
+done
+exit 0
+`), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Credentials: Credentials{Token: "s3cr3t"}, Impersonate: Impersonation{User: "jane"}}
+	credentials, err := opts.credentialsKubeconfig("", &rest.Config{Host: "https://10.0.0.1:6443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctl := &kubectl{cli: CLI{Binary: script, Args: opts.cliArgs()}, kubeConfig: "/home/user/.kube/config", credentials: credentials}
+	out, err := ctl.events("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(out, "\n", 4)
+	if len(lines) < 4 {
+		t.Fatalf("unexpected output %q", out)
+	}
+	args, mode, path, content := lines[0], lines[1], lines[2], lines[3]
+	if strings.Contains(args, "s3cr3t") || !strings.Contains(args, "--as=jane") || strings.Contains(args, "/home/user/.kube/config") {
+		t.Errorf("args = %s", args)
+	}
+	if mode != "-rw-------" {
+		t.Errorf("kubeconfig mode = %s, want -rw-------", mode)
+	}
+	if !strings.Contains(content, "token: s3cr3t") {
+		t.Errorf("kubeconfig without the token:\n%s", content)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("kubeconfig %s not removed: %v", path, err)
+	}
+
+	ctl.credentials = nil
+	if out, err = ctl.events("default"); err != nil || !strings.Contains(out, "--kubeconfig=/home/user/.kube/config") {
+		t.Errorf("without credentials: %s, %v", out, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	kubeconfig := func() *rest.Config {
+		c := &rest.Config{
+			Host:         "https://10.0.0.1:6443",
+			BearerToken:  "kubeconfig-token",
+			Username:     "admin",
+			Password:     "admin-password",
+			AuthProvider: &clientcmdapi.AuthProviderConfig{Name: "oidc"},
+			ExecProvider: &clientcmdapi.ExecConfig{Command: "aws"},
+		}
+		c.CAFile = "/etc/ca.crt"
+		c.CertFile, c.KeyFile = "/home/admin/admin.crt", "/home/admin/admin.key"
+		c.CertData, c.KeyData = []byte("cert"), []byte("key")
+		return c
+	}
+	tests := []struct {
+		name string
+		opts Options
+		// token, tokenFile, certFile and keyFile are the credentials expected on the config.
+		token, tokenFile, certFile, keyFile string
+		// kubeconfig is set if the credentials of the kubeconfig are kept.
+		kubeconfig bool
+	}{
+		{
+			name:       "kubeconfig",
+			token:      "kubeconfig-token",
+			certFile:   "/home/admin/admin.crt",
+			keyFile:    "/home/admin/admin.key",
+			kubeconfig: true,
+		},
+		{
+			name:  "token drops the client certificate",
+			opts:  Options{Credentials: Credentials{Token: "s3cr3t"}},
+			token: "s3cr3t",
+		},
+		{
+			name:      "token file drops the client certificate",
+			opts:      Options{Credentials: Credentials{TokenFile: "/var/run/token"}},
+			tokenFile: "/var/run/token",
+		},
+		{
+			name:     "client certificate",
+			opts:     Options{Credentials: Credentials{ClientCertificate: "/tmp/tls.crt", ClientKey: "/tmp/tls.key"}},
+			certFile: "/tmp/tls.crt",
+			keyFile:  "/tmp/tls.key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := kubeconfig()
+			tt.opts.apply(c)
+			if c.BearerToken != tt.token || c.BearerTokenFile != tt.tokenFile {
+				t.Errorf("token = %q, token file = %q, want %q, %q", c.BearerToken, c.BearerTokenFile, tt.token, tt.tokenFile)
+			}
+			if c.CertFile != tt.certFile || c.KeyFile != tt.keyFile {
+				t.Errorf("client certificate = %q, %q, want %q, %q", c.CertFile, c.KeyFile, tt.certFile, tt.keyFile)
+			}
+			kept := c.Username != "" || c.Password != "" || c.AuthProvider != nil || c.ExecProvider != nil ||
+				c.CertData != nil || c.KeyData != nil
+			if kept != tt.kubeconfig {
+				t.Errorf("credentials of the kubeconfig kept = %v, want %v: %+v", kept, tt.kubeconfig, c)
+			}
+			if c.CAFile != "/etc/ca.crt" {
+				t.Errorf("CA = %q, the cluster has to be kept", c.CAFile)
+			}
+		})
+	}
+}
+
+func TestApplyImpersonation(t *testing.T) {
+	c := &rest.Config{}
+	Options{Impersonate: Impersonation{User: "jane", Groups: []string{"dev"}, UID: "42"}}.apply(c)
+	if c.Impersonate.UserName != "jane" || len(c.Impersonate.Groups) != 1 || c.Impersonate.Groups[0] != "dev" {
+		t.Errorf("impersonation = %+v", c.Impersonate)
+	}
+	if c.WrapTransport == nil {
+		t.Fatal("the uid is not sent")
+	}
+	var header string
+	rt := c.WrapTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header.Get(impersonateUIDHeader)
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+	req, err := http.NewRequest(http.MethodGet, "https://10.0.0.1:6443/api", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if header != "42" || req.Header.Get(impersonateUIDHeader) != "" {
+		t.Errorf("%s = %q, the request has to be copied", impersonateUIDHeader, header)
+	}
+}
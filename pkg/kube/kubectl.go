@@ -17,22 +17,41 @@ package kube
 import (
 	"fmt"
 	"github.com/astralkn/k8s-logs-extractor/pkg/shell"
+	"io/ioutil"
+	"os"
 	"sync"
+	"time"
 )
 
 type kubectl struct {
-	kubeConfig   string
+	cli        CLI
+	kubeConfig string
+	// credentials is the kubeconfig replacing kubeConfig when the credentials are overridden.
+	credentials  []byte
 	baseDir      string
 	workDir      string
 	workDirMutex sync.Mutex
 }
 
-// logs calls the logs command for the specified pod, with -c, if container is specified.
-func (c *kubectl) logs(namespace string, pod string, container string, previousLog bool) (string, error) {
-	cmd := fmt.Sprintf("kubectl logs %s %s %s %s %s",
-		c.configArg(), namespaceArg(namespace), pod, containerArg(container), previousLogArg(previousLog))
+// command returns a command running the CLI with args. execute points it at the cluster.
+func (c *kubectl) command(args ...string) *shell.Command {
+	return c.cli.command(args...)
+}
 
-	s, err := shell.Execute(true, cmd)
+// execute runs cmd against the kubeconfig of the cluster and adds its output to the error, if
+// it fails. Overridden credentials are written to a temporary kubeconfig, only readable by the
+// current user, which is removed once cmd is done.
+func (c *kubectl) execute(cmd *shell.Command) (string, error) {
+	kubeConfig := c.kubeConfig
+	if c.credentials != nil {
+		f, err := writeKubeconfig(c.credentials)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(f)
+		kubeConfig = f
+	}
+	s, err := cmd.Flag("--kubeconfig", kubeConfig).Execute(true)
 
 	if err == nil {
 		return s, nil
@@ -41,140 +60,93 @@ func (c *kubectl) logs(namespace string, pod string, container string, previousL
 	return "", fmt.Errorf("%v: %s", err, s)
 }
 
-func (c *kubectl) dumpInfo(outputDir, ns string) (string, error) {
-	cmd := fmt.Sprintf("kubectl %s cluster-info dump %s --output=yaml --output-directory=%s",
-		c.configArg(), namespaceArg(ns), outputDir)
-
-	s, err := shell.Execute(true, cmd)
-
-	if err != nil {
-		return "", fmt.Errorf("%v: %s", err, s)
+// logs calls the logs command for the specified pod, with -c, if container is specified.
+func (c *kubectl) logs(namespace string, pod string, container string, opts LogOptions) (string, error) {
+	cmd := c.command("logs", pod).
+		Arg(namespaceArgs(namespace)...).
+		Flag("--container", container).
+		BoolFlag("--previous", opts.Previous).
+		BoolFlag("--timestamps", opts.Timestamps)
+	if !opts.SinceTime.IsZero() {
+		cmd = cmd.Flag("--since-time", opts.SinceTime.UTC().Format(time.RFC3339Nano))
 	}
-	return s, nil
+	return c.execute(cmd)
 }
 
-func (c *kubectl) crd(crd string) (string, error) {
-	cmd := fmt.Sprintf("kubectl get crd %s %s",
-		c.configArg(), crd)
-
-	s, err := shell.Execute(true, cmd)
-
-	if err == nil {
-		return s, nil
-	}
-
-	return "", fmt.Errorf("%v: %s", err, s)
+func (c *kubectl) dumpInfo(outputDir, ns string) (string, error) {
+	cmd := c.command("cluster-info", "dump").
+		Arg(namespaceArgs(ns)...).
+		Flag("--output", "yaml").
+		Flag("--output-directory", outputDir)
+	return c.execute(cmd)
 }
 
-func (c *kubectl) configArg() string {
-	return configArg(c.kubeConfig)
+func (c *kubectl) crd(crd string) (string, error) {
+	return c.execute(c.command("get", "crd", crd))
 }
 
 func (c *kubectl) describePod(pod, ns string) (string, error) {
-	cmd := fmt.Sprintf("kubectl describe pod %s %s %s",
-		c.configArg(), pod, namespaceArg(ns))
-
-	s, err := shell.Execute(true, cmd)
-
-	if err == nil {
-		return s, nil
-	}
-
-	return "", fmt.Errorf("%v: %s", err, s)
+	return c.execute(c.command("describe", "pod", pod).Arg(namespaceArgs(ns)...))
 }
 
 func (c *kubectl) describeCm(cm, ns string) (string, error) {
-	cmd := fmt.Sprintf("kubectl describe cm %s %s %s",
-		c.configArg(), cm, namespaceArg(ns))
-
-	s, err := shell.Execute(true, cmd)
-
-	if err == nil {
-		return s, nil
-	}
-
-	return "", fmt.Errorf("%v: %s", err, s)
+	return c.execute(c.command("describe", "cm", cm).Arg(namespaceArgs(ns)...))
 }
 
 func (c *kubectl) describeSVC(svc, ns string) (string, error) {
-	cmd := fmt.Sprintf("kubectl describe svc %s %s %s",
-		c.configArg(), svc, namespaceArg(ns))
-
-	s, err := shell.Execute(true, cmd)
-
-	if err == nil {
-		return s, nil
-	}
-
-	return "", fmt.Errorf("%v: %s", err, s)
+	return c.execute(c.command("describe", "svc", svc).Arg(namespaceArgs(ns)...))
 }
 
 func (c *kubectl) describeCRD(crd, ns string) (string, error) {
-	cmd := fmt.Sprintf("kubectl describe crd %s %s %s",
-		c.configArg(), crd, namespaceArg(ns))
-
-	s, err := shell.Execute(true, cmd)
-
-	if err == nil {
-		return s, nil
-	}
-
-	return "", fmt.Errorf("%v: %s", err, s)
+	return c.execute(c.command("describe", "crd", crd).Arg(namespaceArgs(ns)...))
 }
 
 func (c *kubectl) describeCR(cr, crd, ns string) (string, error) {
-	cmd := fmt.Sprintf("kubectl describe %s %s %s %s",
-		crd, cr, c.configArg(), namespaceArg(ns))
-
-	s, err := shell.Execute(true, cmd)
-
-	if err == nil {
-		return s, nil
-	}
-
-	return "", fmt.Errorf("%v: %s", err, s)
+	return c.execute(c.command("describe", crd, cr).Arg(namespaceArgs(ns)...))
 }
 
 func (c *kubectl) pods(pod string, ns string) (string, error) {
-	cmd := fmt.Sprintf("kubectl get pods %s %s %s -o wide",
-		pod, c.configArg(), namespaceArg(ns))
-
-	s, err := shell.Execute(true, cmd)
+	return c.execute(c.command("get", "pods", pod).Arg(namespaceArgs(ns)...).Flag("--output", "wide"))
+}
 
-	if err == nil {
-		return s, nil
-	}
+func (c *kubectl) events(ns string) (string, error) {
+	return c.execute(c.command("get", "events").Arg(namespaceArgs(ns)...).Flag("--sort-by", ".lastTimestamp"))
+}
 
-	return "", fmt.Errorf("%v: %s", err, s)
+func (c *kubectl) nodes(node string) (string, error) {
+	return c.execute(c.command("get", "nodes", node).Flag("--output", "wide"))
 }
 
-func configArg(kubeConfig string) string {
-	if kubeConfig != "" {
-		return fmt.Sprintf("--kubeconfig=%s", kubeConfig)
-	}
-	return ""
+func (c *kubectl) describeNode(node string) (string, error) {
+	return c.execute(c.command("describe", "node", node))
 }
 
-func namespaceArg(namespace string) string {
-	if namespace == "all" {
-		return "--all-namespaces"
+// writeKubeconfig writes data to a new temporary file with mode 0600 and returns its path.
+func writeKubeconfig(data []byte) (string, error) {
+	f, err := ioutil.TempFile("", "kubeconfig-")
+	if err != nil {
+		return "", fmt.Errorf("failed to write the kubeconfig of the credentials: %v", err)
 	}
-	if namespace != "" {
-		return fmt.Sprintf("-n %s", namespace)
+	if _, err = f.Write(data); err == nil {
+		err = f.Chmod(0600)
 	}
-	return ""
-}
-
-func containerArg(container string) string {
-	if container != "" {
-		return fmt.Sprintf("-c %s", container)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write the kubeconfig of the credentials: %v", err)
 	}
-	return ""
+	return f.Name(), nil
 }
 
-func previousLogArg(previous bool) string {
-	if previous {
-		return "-p"
+// namespaceArgs returns the arguments selecting namespace, where "all" selects every namespace.
+func namespaceArgs(namespace string) []string {
+	if namespace == "all" {
+		return []string{"--all-namespaces"}
+	}
+	if namespace != "" {
+		return []string{"--namespace=" + namespace}
 	}
-	return ""
+	return nil
 }
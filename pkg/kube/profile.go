@@ -0,0 +1,59 @@
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Profile holds settings that differ per cluster. Clusters are identified by the file name of
+// their kubeconfig, e.g.
+//
+//	clusters:
+//	  prod.kubeconfig:
+//	    tokenFile: /secrets/prod-token
+//	    as: jane
+//	    asGroups: [developers]
+type Profile struct {
+	Clusters map[string]ClusterProfile `json:"clusters"`
+}
+
+// ClusterProfile overrides the credentials and the impersonation of a single cluster.
+type ClusterProfile struct {
+	Credentials `json:",inline"`
+	As          string   `json:"as,omitempty"`
+	AsGroups    []string `json:"asGroups,omitempty"`
+	AsUID       string   `json:"asUID,omitempty"`
+}
+
+// LoadProfile reads a YAML or JSON profile.
+func LoadProfile(path string) (*Profile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Options returns base with the overrides of cluster applied.
+func (p *Profile) Options(cluster string, base Options) Options {
+	if p == nil {
+		return base
+	}
+	cp, ok := p.Clusters[cluster]
+	if !ok {
+		return base
+	}
+	if !cp.Credentials.empty() {
+		base.Credentials = cp.Credentials
+	}
+	if cp.As != "" || len(cp.AsGroups) > 0 || cp.AsUID != "" {
+		base.Impersonate = Impersonation{User: cp.As, Groups: cp.AsGroups, UID: cp.AsUID}
+	}
+	return base
+}
@@ -0,0 +1,340 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	kubeApiCore "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// RetryPolicy configures how Retrying retries the calls failing with a transient error.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a call is made, 1 disables retries.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles with every attempt, up to
+	// MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter randomly spreads every delay by up to this fraction of it, e.g. 0.2 for ±20%, so
+	// that the extractions of many clusters do not retry in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy retries a call twice, after about one and two seconds.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 30 * time.Second, Jitter: 0.2}
+
+// delay returns the delay before the retry following attempt, counted from 1.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// RetryRecord describes a call that was retried.
+type RetryRecord struct {
+	Call     string `json:"call"`
+	Attempts int    `json:"attempts"`
+	// Error is the error of the last attempt, empty if the call eventually succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// Retrying is an Interface retrying the calls of another one that fail with a retryable error,
+// see IsRetryable. It records the calls it retried.
+type Retrying struct {
+	acc    Interface
+	policy RetryPolicy
+
+	mu      sync.Mutex
+	records []RetryRecord
+}
+
+var _ Interface = &Retrying{}
+
+// NewRetrying returns an Interface retrying the calls to acc according to policy.
+func NewRetrying(acc Interface, policy RetryPolicy) *Retrying {
+	return &Retrying{acc: acc, policy: policy}
+}
+
+// Records returns the calls retried so far.
+func (r *Retrying) Records() []RetryRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RetryRecord(nil), r.records...)
+}
+
+func (r *Retrying) do(call string, f func() error) error {
+	attempt := 1
+	for {
+		err := f()
+		if err == nil || attempt >= r.policy.MaxAttempts || !IsRetryable(err) {
+			if attempt > 1 {
+				rec := RetryRecord{Call: call, Attempts: attempt}
+				if err != nil {
+					rec.Error = err.Error()
+				}
+				r.mu.Lock()
+				r.records = append(r.records, rec)
+				r.mu.Unlock()
+			}
+			return err
+		}
+		d := r.policy.delay(attempt)
+		logrus.Warnf("%s failed (attempt %d of %d), retrying in %s: %v", call, attempt, r.policy.MaxAttempts, d.Round(time.Millisecond), err)
+		time.Sleep(d)
+		attempt++
+	}
+}
+
+var (
+	// fatalMessages mark the kubectl errors that retrying cannot fix, e.g. 403 and 404.
+	fatalMessages = []string{"(forbidden)", "(notfound)", "(unauthorized)", "(badrequest)", "(invalid)", " is forbidden", " not found"}
+	// retryableMessages mark the kubectl and transport errors that are usually transient.
+	retryableMessages = []string{
+		"timeout", "timed out", "connection refused", "connection reset", "tls handshake",
+		"(internalerror)", "(serviceunavailable)", "(toomanyrequests)", "too many requests",
+		"the server is currently unable to handle the request", "unexpected eof", "server sent goaway",
+	}
+)
+
+// IsRetryable reports whether err is likely transient: a timeout, a 429 or 5xx response, or a
+// failed connection or TLS handshake. Errors such as 403 and 404, and unknown ones, are fatal.
+// Both API errors and the output of failed kubectl commands are classified.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch {
+	case apierrors.IsForbidden(err), apierrors.IsNotFound(err), apierrors.IsUnauthorized(err),
+		apierrors.IsBadRequest(err), apierrors.IsInvalid(err):
+		return false
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err), apierrors.IsTooManyRequests(err),
+		apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return true
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		code := status.Status().Code
+		return code == 429 || code >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range fatalMessages {
+		if strings.Contains(msg, m) {
+			return false
+		}
+	}
+	for _, m := range retryableMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Retrying) GetPods(pod, ns string) (s string, err error) {
+	err = r.do(fmt.Sprintf("get pods %s %s", pod, ns), func() error {
+		s, err = r.acc.GetPods(pod, ns)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) Logs(namespace string, pod string, container string, opts LogOptions) (s string, err error) {
+	err = r.do(fmt.Sprintf("logs %s/%s/%s", namespace, pod, container), func() error {
+		s, err = r.acc.Logs(namespace, pod, container, opts)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) DumpInfo(outputDir, ns string) (s string, err error) {
+	err = r.do("cluster-info dump "+ns, func() error {
+		s, err = r.acc.DumpInfo(outputDir, ns)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) GetNamespaces() (nss []kubeApiCore.Namespace, err error) {
+	err = r.do("list namespaces", func() error {
+		nss, err = r.acc.GetNamespaces()
+		return err
+	})
+	return nss, err
+}
+
+func (r *Retrying) ListPods(ns string) (pods *kubeApiCore.PodList, err error) {
+	err = r.do("list pods "+ns, func() error {
+		pods, err = r.acc.ListPods(ns)
+		return err
+	})
+	return pods, err
+}
+
+func (r *Retrying) ListCRDs() (crds []string, err error) {
+	err = r.do("list crds", func() error {
+		crds, err = r.acc.ListCRDs()
+		return err
+	})
+	return crds, err
+}
+
+func (r *Retrying) GetEvents(ns string) (s string, err error) {
+	err = r.do("get events "+ns, func() error {
+		s, err = r.acc.GetEvents(ns)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) GetNodes(node string) (s string, err error) {
+	err = r.do("get nodes "+node, func() error {
+		s, err = r.acc.GetNodes(node)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) DescribeNode(node string) (s string, err error) {
+	err = r.do("describe node "+node, func() error {
+		s, err = r.acc.DescribeNode(node)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) DescribePod(pod, ns string) (s string, err error) {
+	err = r.do(fmt.Sprintf("describe pod %s %s", pod, ns), func() error {
+		s, err = r.acc.DescribePod(pod, ns)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) DescribeCM(cm, ns string) (s string, err error) {
+	err = r.do(fmt.Sprintf("describe cm %s %s", cm, ns), func() error {
+		s, err = r.acc.DescribeCM(cm, ns)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) DescribeSVC(svc, ns string) (s string, err error) {
+	err = r.do(fmt.Sprintf("describe svc %s %s", svc, ns), func() error {
+		s, err = r.acc.DescribeSVC(svc, ns)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) DescribeCRD(crd, ns string) (s string, err error) {
+	err = r.do(fmt.Sprintf("describe crd %s %s", crd, ns), func() error {
+		s, err = r.acc.DescribeCRD(crd, ns)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) DescribeCR(cr, crd, ns string) (s string, err error) {
+	err = r.do(fmt.Sprintf("describe %s %s %s", crd, cr, ns), func() error {
+		s, err = r.acc.DescribeCR(cr, crd, ns)
+		return err
+	})
+	return s, err
+}
+
+func (r *Retrying) CanI(p Permission) (allowed bool, reason string, err error) {
+	err = r.do("can-i "+p.String(), func() error {
+		allowed, reason, err = r.acc.CanI(p)
+		return err
+	})
+	return allowed, reason, err
+}
+
+func (r *Retrying) Identity() Identity {
+	return r.acc.Identity()
+}
+
+func (r *Retrying) ServerVersion() (version, platform string, err error) {
+	err = r.do("version", func() error {
+		version, platform, err = r.acc.ServerVersion()
+		return err
+	})
+	return version, platform, err
+}
+
+func (r *Retrying) APIResources() (resources []string, err error) {
+	err = r.do("api-resources", func() error {
+		resources, err = r.acc.APIResources()
+		return err
+	})
+	return resources, err
+}
+
+func (r *Retrying) ListNodes() (nodes *kubeApiCore.NodeList, err error) {
+	err = r.do("list nodes", func() error {
+		nodes, err = r.acc.ListNodes()
+		return err
+	})
+	return nodes, err
+}
+
+func (r *Retrying) ListSecrets(ns, selector string) (secrets []kubeApiCore.Secret, err error) {
+	err = r.do(fmt.Sprintf("list secrets %s %s", ns, selector), func() error {
+		secrets, err = r.acc.ListSecrets(ns, selector)
+		return err
+	})
+	return secrets, err
+}
+
+func (r *Retrying) ListConfigMaps(ns, selector string) (cms []kubeApiCore.ConfigMap, err error) {
+	err = r.do(fmt.Sprintf("list config maps %s %s", ns, selector), func() error {
+		cms, err = r.acc.ListConfigMaps(ns, selector)
+		return err
+	})
+	return cms, err
+}
+
+func (r *Retrying) ListServices(ns string) (svcs []kubeApiCore.Service, err error) {
+	err = r.do("list services "+ns, func() error {
+		svcs, err = r.acc.ListServices(ns)
+		return err
+	})
+	return svcs, err
+}
+
+func (r *Retrying) ListEndpoints(ns string) (eps []kubeApiCore.Endpoints, err error) {
+	err = r.do("list endpoints "+ns, func() error {
+		eps, err = r.acc.ListEndpoints(ns)
+		return err
+	})
+	return eps, err
+}
+
+func (r *Retrying) ListResource(resource schema.GroupVersionResource, ns string) (objs []unstructured.Unstructured, err error) {
+	err = r.do(fmt.Sprintf("list %s %s", resource.GroupResource(), ns), func() error {
+		objs, err = r.acc.ListResource(resource, ns)
+		return err
+	})
+	return objs, err
+}
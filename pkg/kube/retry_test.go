@@ -0,0 +1,144 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// timeoutError is a net.Error timing out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o deadline reached" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"api 403", apierrors.NewForbidden(pods, "web-1", errors.New("rbac")), false},
+		{"api 404", apierrors.NewNotFound(pods, "web-1"), false},
+		{"api 401", apierrors.NewUnauthorized("expired token"), false},
+		{"api 429", apierrors.NewTooManyRequests("slow down", 1), true},
+		{"api 503", apierrors.NewServiceUnavailable("apiserver restarting"), true},
+		{"api 500", apierrors.NewInternalError(errors.New("boom")), true},
+		{"api 504", apierrors.NewTimeoutError("list pods", 1), true},
+		{"api 502", apierrors.NewGenericServerResponse(502, "get", pods, "web-1", "bad gateway", 0, false), true},
+		{"wrapped api 404", fmt.Errorf("describe: %w", apierrors.NewNotFound(pods, "web-1")), false},
+		{"kubectl forbidden", errors.New(`exit status 1: Error from server (Forbidden): pods is forbidden: User "jane" cannot list resource "pods"`), false},
+		{"kubectl not found", errors.New(`exit status 1: Error from server (NotFound): pods "web-1" not found`), false},
+		{"kubectl forbidden timing out", errors.New(`exit status 1: Error from server (Forbidden): request timed out`), false},
+		{"etcd timeout", errors.New("exit status 1: Error from server: etcdserver: request timed out"), true},
+		{"connection refused", errors.New("exit status 1: The connection to the server 10.0.0.1:6443 was refused - did you specify the right host or port?: dial tcp 10.0.0.1:6443: connect: connection refused"), true},
+		{"tls handshake", errors.New("exit status 1: Unable to connect to the server: net/http: TLS handshake timeout"), true},
+		{"kubectl 429", errors.New("exit status 1: Error from server (TooManyRequests): the server has received too many requests"), true},
+		{"net timeout", timeoutError{}, true},
+		{"wrapped net timeout", fmt.Errorf("get: %w", timeoutError{}), true},
+		{"unknown", errors.New("exit status 1: error: unknown flag: --foo"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		min, max time.Duration
+	}{
+		{"first", RetryPolicy{Backoff: time.Second}, 1, time.Second, time.Second},
+		{"doubled", RetryPolicy{Backoff: time.Second}, 3, 4 * time.Second, 4 * time.Second},
+		{"uncapped", RetryPolicy{Backoff: time.Second}, 7, 64 * time.Second, 64 * time.Second},
+		{"capped", RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}, 5, 10 * time.Second, 10 * time.Second},
+		{"cap below the backoff", RetryPolicy{Backoff: time.Minute, MaxBackoff: time.Second}, 1, time.Second, time.Second},
+		{"many attempts", RetryPolicy{Backoff: time.Second, MaxBackoff: 30 * time.Second}, 1000, 30 * time.Second, 30 * time.Second},
+		{"jitter", RetryPolicy{Backoff: time.Second, Jitter: 0.2}, 2, 1600 * time.Millisecond, 2400 * time.Millisecond},
+		{"jitter of the cap", RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second, Jitter: 0.5}, 10, 2500 * time.Millisecond, 7500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := tt.policy.delay(tt.attempt); d < tt.min || d > tt.max {
+					t.Fatalf("delay(%d) = %s, want within [%s, %s]", tt.attempt, d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryingDo(t *testing.T) {
+	transient := errors.New("dial tcp 10.0.0.1:6443: connect: connection refused")
+	fatal := errors.New("Error from server (NotFound): pods \"web-1\" not found")
+	tests := []struct {
+		name        string
+		maxAttempts int
+		// errs are returned by the successive attempts, the ones after them succeed.
+		errs     []error
+		attempts int
+		err      error
+		records  []RetryRecord
+	}{
+		{name: "success", maxAttempts: 3, attempts: 1},
+		{
+			name:        "recovered",
+			maxAttempts: 3,
+			errs:        []error{transient, transient},
+			attempts:    3,
+			records:     []RetryRecord{{Call: "list pods", Attempts: 3}},
+		},
+		{
+			name:        "exhausted",
+			maxAttempts: 3,
+			errs:        []error{transient, transient, transient, transient},
+			attempts:    3,
+			err:         transient,
+			records:     []RetryRecord{{Call: "list pods", Attempts: 3, Error: transient.Error()}},
+		},
+		{
+			name:        "fatal after a retry",
+			maxAttempts: 3,
+			errs:        []error{transient, fatal},
+			attempts:    2,
+			err:         fatal,
+			records:     []RetryRecord{{Call: "list pods", Attempts: 2, Error: fatal.Error()}},
+		},
+		{name: "fatal", maxAttempts: 3, errs: []error{fatal}, attempts: 1, err: fatal},
+		{name: "one attempt", maxAttempts: 1, errs: []error{transient}, attempts: 1, err: transient},
+		{name: "no attempts set", maxAttempts: 0, errs: []error{transient}, attempts: 1, err: transient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRetrying(nil, RetryPolicy{MaxAttempts: tt.maxAttempts, Backoff: time.Nanosecond})
+			attempts := 0
+			err := r.do("list pods", func() error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			if err != tt.err || attempts != tt.attempts {
+				t.Errorf("do() = %v after %d attempts, want %v after %d", err, attempts, tt.err, tt.attempts)
+			}
+			if got := r.Records(); !reflect.DeepEqual(got, tt.records) {
+				t.Errorf("records = %+v, want %+v", got, tt.records)
+			}
+		})
+	}
+}
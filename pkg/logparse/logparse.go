@@ -0,0 +1,295 @@
+// Package logparse detects the format of container logs and parses structured lines.
+package logparse
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+)
+
+// Formats of a log.
+const (
+	Plain  = "plain"
+	JSON   = "json"
+	Logfmt = "logfmt"
+)
+
+const (
+	// sampleSize is the number of lines Detect looks at.
+	sampleSize = 50
+	// threshold is the share of sampled lines that have to parse for a format to be detected.
+	threshold = 0.8
+)
+
+// Detect returns the format of the lines of a log, sampling the first non-empty ones. The
+// timestamps added by kubectl logs --timestamps are ignored.
+func Detect(lines []string) string {
+	var sampled, jsonLines, logfmtLines int
+	for _, line := range lines {
+		if sampled == sampleSize {
+			break
+		}
+		_, msg, _ := bundle.LineTime(line)
+		if strings.TrimSpace(msg) == "" {
+			continue
+		}
+		sampled++
+		if _, err := parseJSON(msg); err == nil {
+			jsonLines++
+		} else if fields, err := parseLogfmt(msg); err == nil && pairs(fields) >= 2 {
+			logfmtLines++
+		}
+	}
+	switch {
+	case sampled == 0:
+		return Plain
+	case float64(jsonLines) >= threshold*float64(sampled):
+		return JSON
+	case float64(logfmtLines) >= threshold*float64(sampled):
+		return Logfmt
+	}
+	return Plain
+}
+
+// pairs counts the fields of a logfmt line that have a value, so that prose is not taken for
+// logfmt made of keys only.
+func pairs(fields map[string]interface{}) int {
+	n := 0
+	for _, v := range fields {
+		if _, ok := v.(string); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Record is a normalized log line.
+type Record struct {
+	Timestamp string                 `json:"timestamp,omitempty"`
+	Level     string                 `json:"level,omitempty"`
+	Message   string                 `json:"message"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	// Unparsed is set for the lines of a structured log that did not parse.
+	Unparsed bool `json:"unparsed,omitempty"`
+}
+
+var (
+	timeKeys    = []string{"time", "ts", "timestamp", "@timestamp", "t", "date"}
+	levelKeys   = []string{"level", "lvl", "severity", "log.level", "loglevel"}
+	messageKeys = []string{"msg", "message", "log", "event"}
+)
+
+// Parse normalizes a line of a log of format. The time of the record is taken from the fields of
+// the line, or from the timestamp of kubectl logs --timestamps.
+func Parse(format, line string) Record {
+	ts, msg, hasTs := bundle.LineTime(line)
+	r := Record{Message: msg}
+	if hasTs {
+		r.Timestamp = ts.UTC().Format(time.RFC3339Nano)
+	}
+	var (
+		fields map[string]interface{}
+		err    error
+	)
+	switch format {
+	case JSON:
+		fields, err = parseJSON(msg)
+	case Logfmt:
+		fields, err = parseLogfmt(msg)
+	default:
+		return r
+	}
+	if err != nil {
+		r.Unparsed = true
+		return r
+	}
+	r.Fields = fields
+	if v, ok := lookup(fields, timeKeys); ok {
+		if t, ok := parseTime(v); ok {
+			r.Timestamp = t.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	if v, ok := lookup(fields, levelKeys); ok {
+		r.Level = Level(v)
+	}
+	r.Message = ""
+	for _, k := range messageKeys {
+		// Some loggers nest the level in a log object, e.g. {"log":{"level":"info"}}.
+		if v, ok := fields[k]; ok && v != nil {
+			if _, nested := v.(map[string]interface{}); !nested {
+				r.Message = fmt.Sprint(v)
+				break
+			}
+		}
+	}
+	return r
+}
+
+// lookup returns the value of the first of keys present in fields, looking into nested objects
+// for dotted keys.
+func lookup(fields map[string]interface{}, keys []string) (interface{}, bool) {
+	for _, k := range keys {
+		if v, ok := fields[k]; ok && v != nil {
+			return v, true
+		}
+		if i := strings.IndexByte(k, '.'); i > 0 {
+			if nested, ok := fields[k[:i]].(map[string]interface{}); ok {
+				if v, ok := nested[k[i+1:]]; ok && v != nil {
+					return v, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// Level normalizes a level to trace, debug, info, warn, error or fatal. Numeric levels follow
+// the convention of bunyan and pino, e.g. 30 for info. Unknown levels are returned lower cased.
+func Level(v interface{}) string {
+	if n, ok := v.(float64); ok {
+		switch {
+		case n >= 60:
+			return "fatal"
+		case n >= 50:
+			return "error"
+		case n >= 40:
+			return "warn"
+		case n >= 30:
+			return "info"
+		case n >= 20:
+			return "debug"
+		}
+		return "trace"
+	}
+	l := strings.ToLower(strings.TrimSpace(fmt.Sprint(v)))
+	switch l {
+	case "warning":
+		return "warn"
+	case "err", "eror":
+		return "error"
+	case "crit", "critical", "panic", "dpanic", "emerg", "alert":
+		return "fatal"
+	case "dbg":
+		return "debug"
+	case "information", "notice":
+		return "info"
+	}
+	return l
+}
+
+// parseTime parses RFC3339 strings and Unix times in seconds, milliseconds or nanoseconds.
+func parseTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999"} {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, true
+			}
+		}
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return unixTime(f), true
+		}
+	case float64:
+		return unixTime(t), true
+	}
+	return time.Time{}, false
+}
+
+func unixTime(f float64) time.Time {
+	switch {
+	case f > 1e17:
+		return time.Unix(0, int64(f))
+	case f > 1e11:
+		ms := int64(f)
+		return time.Unix(0, ms*int64(time.Millisecond)+int64((f-float64(ms))*1e6))
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+func parseJSON(s string) (map[string]interface{}, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// parseLogfmt parses key=value pairs separated by spaces. Values may be double quoted with Go
+// escapes, keys without a value are set to true.
+func parseLogfmt(s string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	s = strings.TrimSpace(s)
+	for len(s) > 0 {
+		end := strings.IndexAny(s, "= ")
+		if end == 0 {
+			return nil, fmt.Errorf("empty key")
+		}
+		if end < 0 || s[end] == ' ' {
+			if end < 0 {
+				end = len(s)
+			}
+			key := s[:end]
+			if strings.ContainsAny(key, `"`) {
+				return nil, fmt.Errorf("invalid key %q", key)
+			}
+			fields[key] = true
+			s = strings.TrimLeft(s[end:], " ")
+			continue
+		}
+		key := s[:end]
+		if strings.ContainsAny(key, `"`) {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		s = s[end+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			i := closingQuote(s)
+			if i < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			unquoted, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return nil, err
+			}
+			value, s = unquoted, s[i+1:]
+		} else {
+			i := strings.IndexByte(s, ' ')
+			if i < 0 {
+				i = len(s)
+			}
+			value, s = s[:i], s[i:]
+		}
+		if len(s) > 0 && s[0] != ' ' {
+			return nil, fmt.Errorf("missing space after %s", key)
+		}
+		fields[key] = value
+		s = strings.TrimLeft(s, " ")
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no field")
+	}
+	return fields, nil
+}
+
+// closingQuote returns the index of the quote closing the one at the start of s, or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,246 @@
+package logparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func repeat(line string, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = line
+	}
+	return lines
+}
+
+func TestDetect(t *testing.T) {
+	const (
+		jsonLine   = `{"level":"info","msg":"ready"}`
+		logfmtLine = `level=info msg="server ready" port=8080`
+		prose      = "Starting the server on port 8080"
+	)
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"empty", nil, Plain},
+		{"blank lines", []string{"", "  "}, Plain},
+		{"json", repeat(jsonLine, 5), JSON},
+		{"json at the threshold", append(repeat(jsonLine, 4), prose), JSON},
+		{"json below the threshold", append(repeat(jsonLine, 3), prose, prose), Plain},
+		{"blank lines not sampled", append(repeat(jsonLine, 4), "", "", prose), JSON},
+		{"json array", repeat(`["a","b"]`, 5), Plain},
+		{"logfmt", repeat(logfmtLine, 5), Logfmt},
+		{"logfmt at the threshold", append(repeat(logfmtLine, 8), prose, prose), Logfmt},
+		{"logfmt with a single pair", repeat("level=info ready now", 5), Plain},
+		{"prose", repeat(prose, 5), Plain},
+		{"prose with a bare equal sign", repeat("retrying with backoff = 2s", 5), Plain},
+		{"mixed json and logfmt", append(repeat(jsonLine, 3), repeat(logfmtLine, 2)...), Plain},
+		{"kubectl timestamps", repeat("2024-03-01T10:00:00.123456789Z "+jsonLine, 5), JSON},
+		{"only the first lines sampled", append(repeat(jsonLine, sampleSize), repeat(prose, 100)...), JSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.lines); got != tt.want {
+				t.Errorf("Detect() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		line string
+		want map[string]interface{}
+	}{
+		{`level=info msg=ready`, map[string]interface{}{"level": "info", "msg": "ready"}},
+		{`msg="server \"api\" ready" port=8080`, map[string]interface{}{"msg": `server "api" ready`, "port": "8080"}},
+		{`msg="tab\there"`, map[string]interface{}{"msg": "tab\there"}},
+		{`msg="" level=warn`, map[string]interface{}{"msg": "", "level": "warn"}},
+		{`  level=info   debug  `, map[string]interface{}{"level": "info", "debug": true}},
+		{`key=`, map[string]interface{}{"key": ""}},
+		{`Starting the server`, map[string]interface{}{"Starting": true, "the": true, "server": true}},
+		{`msg="unterminated`, nil},
+		{`=value`, nil},
+		{`msg="quoted"trailing`, nil},
+		{`say "hello"`, nil},
+		{`msg="bad \q escape"`, nil},
+		{``, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := parseLogfmt(tt.line)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("parseLogfmt() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLogfmt() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevel(t *testing.T) {
+	tests := []struct {
+		level interface{}
+		want  string
+	}{
+		{float64(10), "trace"},
+		{float64(20), "debug"},
+		{float64(30), "info"},
+		{float64(35), "info"},
+		{float64(40), "warn"},
+		{float64(50), "error"},
+		{float64(60), "fatal"},
+		{float64(0), "trace"},
+		{"WARNING", "warn"},
+		{" Info ", "info"},
+		{"eror", "error"},
+		{"dpanic", "fatal"},
+		{"CRITICAL", "fatal"},
+		{"dbg", "debug"},
+		{"notice", "info"},
+		{"verbose", "verbose"},
+	}
+	for _, tt := range tests {
+		if got := Level(tt.level); got != tt.want {
+			t.Errorf("Level(%v) = %s, want %s", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	at := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		v    interface{}
+		want time.Time
+		// precision is the error tolerated, since float64 cannot hold every nanosecond.
+		precision time.Duration
+	}{
+		{"rfc3339", "2024-03-01T10:00:00.5Z", at.Add(500 * time.Millisecond), 0},
+		{"rfc3339 with offset", "2024-03-01T11:00:00+01:00", at, 0},
+		{"space separated", "2024-03-01 10:00:00.25Z", at.Add(250 * time.Millisecond), 0},
+		{"without zone", "2024-03-01T10:00:00", at, 0},
+		{"seconds", float64(at.Unix()), at, 0},
+		{"fractional seconds", float64(at.Unix()) + 0.5, at.Add(500 * time.Millisecond), time.Microsecond},
+		{"seconds as a string", "1709287200.25", at.Add(250 * time.Millisecond), time.Microsecond},
+		{"milliseconds", float64(at.Unix()*1000 + 123), at.Add(123 * time.Millisecond), 0},
+		{"fractional milliseconds", float64(at.Unix()*1000) + 123.5, at.Add(123500 * time.Microsecond), time.Microsecond},
+		{"nanoseconds", float64(at.UnixNano() + 123456789), at.Add(123456789), time.Microsecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseTime(tt.v)
+			if d := got.Sub(tt.want); !ok || d > tt.precision || d < -tt.precision {
+				t.Errorf("parseTime(%v) = %s, %v, want %s", tt.v, got.UTC(), ok, tt.want)
+			}
+		})
+	}
+	for _, v := range []interface{}{"yesterday", true, nil} {
+		if got, ok := parseTime(v); ok {
+			t.Errorf("parseTime(%v) = %s, want no time", v, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		line   string
+		want   Record
+	}{
+		{
+			name:   "plain",
+			format: Plain,
+			line:   "2024-03-01T10:00:00Z starting",
+			want:   Record{Timestamp: "2024-03-01T10:00:00Z", Message: "starting"},
+		},
+		{
+			name:   "json",
+			format: JSON,
+			line:   `{"ts":1709287200,"severity":"WARNING","message":"slow","ms":120}`,
+			want: Record{
+				Timestamp: "2024-03-01T10:00:00Z",
+				Level:     "warn",
+				Message:   "slow",
+				Fields:    map[string]interface{}{"ts": float64(1709287200), "severity": "WARNING", "message": "slow", "ms": float64(120)},
+			},
+		},
+		{
+			name:   "numeric level",
+			format: JSON,
+			line:   `{"level":50,"msg":"failed"}`,
+			want:   Record{Level: "error", Message: "failed", Fields: map[string]interface{}{"level": float64(50), "msg": "failed"}},
+		},
+		{
+			name:   "nested log object",
+			format: JSON,
+			line:   `{"@timestamp":"2024-03-01T10:00:00Z","log":{"level":"info"},"message":"ready"}`,
+			want: Record{
+				Timestamp: "2024-03-01T10:00:00Z",
+				Level:     "info",
+				Message:   "ready",
+				Fields: map[string]interface{}{
+					"@timestamp": "2024-03-01T10:00:00Z",
+					"log":        map[string]interface{}{"level": "info"},
+					"message":    "ready",
+				},
+			},
+		},
+		{
+			name:   "log message",
+			format: JSON,
+			line:   `{"log":"ready\n","stream":"stdout"}`,
+			want:   Record{Message: "ready\n", Fields: map[string]interface{}{"log": "ready\n", "stream": "stdout"}},
+		},
+		{
+			name:   "kubectl timestamp kept without a time field",
+			format: Logfmt,
+			line:   `2024-03-01T10:00:00Z lvl=err msg="disk full"`,
+			want: Record{
+				Timestamp: "2024-03-01T10:00:00Z",
+				Level:     "error",
+				Message:   "disk full",
+				Fields:    map[string]interface{}{"lvl": "err", "msg": "disk full"},
+			},
+		},
+		{
+			name:   "time field replaces the kubectl timestamp",
+			format: Logfmt,
+			line:   `2024-03-01T10:00:05Z time=2024-03-01T10:00:00Z msg=queued`,
+			want: Record{
+				Timestamp: "2024-03-01T10:00:00Z",
+				Message:   "queued",
+				Fields:    map[string]interface{}{"time": "2024-03-01T10:00:00Z", "msg": "queued"},
+			},
+		},
+		{
+			name:   "unparsed line of a structured log",
+			format: JSON,
+			line:   "2024-03-01T10:00:00Z panic: boom",
+			want:   Record{Timestamp: "2024-03-01T10:00:00Z", Message: "panic: boom", Unparsed: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.format, tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNoMessage(t *testing.T) {
+	r := Parse(Logfmt, "level=info user=jane")
+	if r.Message != "" || r.Level != "info" || !strings.Contains(r.Fields["user"].(string), "jane") {
+		t.Errorf("Parse() = %+v", r)
+	}
+}
@@ -0,0 +1,89 @@
+// Package redact masks secrets before they are written to a bundle.
+package redact
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces every redacted value.
+const Mask = "***"
+
+var sensitiveKey = regexp.MustCompile(`(?i)(password|passwd|secret|token|api[-_]?key|private[-_]?key|credential|authorization|auth)`)
+
+// IsSensitiveKey reports whether a key, flag or header name suggests its value is a secret.
+func IsSensitiveKey(key string) bool {
+	return sensitiveKey.MatchString(key)
+}
+
+// Arg masks the value of a --flag=value argument if the flag is sensitive.
+func Arg(arg string) string {
+	i := strings.IndexByte(arg, '=')
+	if !strings.HasPrefix(arg, "-") || i < 0 || !IsSensitiveKey(arg[:i]) {
+		return arg
+	}
+	return arg[:i+1] + Mask
+}
+
+// Args returns a copy of args with the values of sensitive flags masked.
+func Args(args []string) []string {
+	if args == nil {
+		return nil
+	}
+	masked := make([]string, len(args))
+	for i, a := range args {
+		masked[i] = Arg(a)
+	}
+	return masked
+}
+
+// StringMap returns a copy of m with the values of sensitive keys masked.
+func StringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(m))
+	for k, v := range m {
+		if IsSensitiveKey(k) {
+			v = Mask
+		}
+		masked[k] = v
+	}
+	return masked
+}
+
+// Value masks, in place, the values of sensitive keys found anywhere in v, a tree of
+// map[string]interface{} and []interface{} as produced by encoding/json, and returns v.
+func Value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if _, nested := e.(map[string]interface{}); !nested && IsSensitiveKey(k) && e != nil {
+				t[k] = Mask
+			} else {
+				t[k] = Value(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = Value(e)
+		}
+	}
+	return v
+}
+
+// URL masks the password of the user info of a URL.
+func URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); !ok {
+		return raw
+	}
+	// The mask is inserted after encoding, url.URL would escape it. The escaped user name holds
+	// no colon, the first one followed by @ ends it.
+	u.User = url.UserPassword(u.User.Username(), "")
+	return strings.Replace(u.String(), ":@", ":"+Mask+"@", 1)
+}
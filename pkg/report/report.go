@@ -0,0 +1,248 @@
+// Package report renders an extracted bundle as a static HTML site that works offline.
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	kubeApiCore "k8s.io/api/core/v1"
+)
+
+const (
+	maxWarnings = 50
+	maxRestarts = 20
+)
+
+// Generate writes the report of b to dir.
+func Generate(b *bundle.Bundle, dir string) error {
+	var clusters []*clusterPage
+	for _, c := range b.Clusters {
+		page := newClusterPage(c, filepath.Join(dir, c.Name))
+		clusters = append(clusters, page)
+		if err := render(filepath.Join(dir, c.Name, "index.html"), clusterTemplate, page); err != nil {
+			return err
+		}
+		for _, ns := range page.Namespaces {
+			if err := render(filepath.Join(dir, c.Name, ns.File), namespaceTemplate, ns); err != nil {
+				return err
+			}
+		}
+	}
+	return render(filepath.Join(dir, "index.html"), indexTemplate, struct {
+		Generated time.Time
+		Metadata  *bundle.Metadata
+		Clusters  []*clusterPage
+	}{time.Now(), b.Metadata, clusters})
+}
+
+type clusterPage struct {
+	Cluster    *bundle.Cluster
+	Nodes      []nodeRow
+	ReadyNodes int
+	PodCount   int
+	Unhealthy  []podRow
+	Restarts   []podRow
+	Warnings   []eventRow
+	Namespaces []*namespacePage
+}
+
+type namespacePage struct {
+	Cluster   string
+	Name      string
+	File      string
+	Pods      []podRow
+	Unhealthy int
+	Events    []eventRow
+	Services  []kubeApiCore.Service
+}
+
+type nodeRow struct {
+	Name     string
+	Ready    bool
+	Version  string
+	Describe string
+}
+
+type podRow struct {
+	Namespace string
+	Name      string
+	Phase     string
+	Ready     string
+	Reason    string
+	Restarts  int32
+	Healthy   bool
+	Describe  string
+	Logs      []link
+}
+
+type eventRow struct {
+	Namespace string
+	Last      time.Time
+	Type      string
+	Reason    string
+	Object    string
+	Message   string
+	Count     int32
+}
+
+type link struct {
+	Name string
+	Href string
+}
+
+func newClusterPage(c *bundle.Cluster, pageDir string) *clusterPage {
+	page := &clusterPage{Cluster: c}
+	for _, n := range c.Nodes {
+		row := nodeRow{Name: n.Name, Version: n.Status.NodeInfo.KubeletVersion,
+			Describe: rawLink(pageDir, filepath.Join(c.Dir, "nodes-describe", n.Name+".yaml"))}
+		for _, cond := range n.Status.Conditions {
+			if cond.Type == kubeApiCore.NodeReady && cond.Status == kubeApiCore.ConditionTrue {
+				row.Ready = true
+				page.ReadyNodes++
+			}
+		}
+		page.Nodes = append(page.Nodes, row)
+	}
+
+	logs := map[string][]link{}
+	if files, err := c.LogFiles(); err == nil {
+		for _, f := range files {
+			name := f.Container
+			if name == "" {
+				name = "logs"
+			}
+			if f.Previous {
+				name += " (previous)"
+			}
+			key := f.Namespace + "/" + f.Pod
+			logs[key] = append(logs[key], link{Name: name, Href: rawLink(pageDir, f.Path)})
+		}
+	}
+
+	for _, ns := range c.Namespaces {
+		nsPage := &namespacePage{Cluster: c.Name, Name: ns.Name, File: "ns-" + ns.Name + ".html", Services: ns.Services}
+		for _, p := range ns.Pods {
+			row := newPodRow(p)
+			row.Describe = rawLink(pageDir, filepath.Join(c.Dir, "pods-describe", p.Name+".yaml"))
+			row.Logs = logs[p.Namespace+"/"+p.Name]
+			nsPage.Pods = append(nsPage.Pods, row)
+			if !row.Healthy {
+				nsPage.Unhealthy++
+				page.Unhealthy = append(page.Unhealthy, row)
+			}
+			if row.Restarts > 0 {
+				page.Restarts = append(page.Restarts, row)
+			}
+		}
+		for _, e := range ns.Events {
+			row := newEventRow(e)
+			nsPage.Events = append(nsPage.Events, row)
+			if e.Type == kubeApiCore.EventTypeWarning {
+				page.Warnings = append(page.Warnings, row)
+			}
+		}
+		sortEvents(nsPage.Events)
+		page.PodCount += len(ns.Pods)
+		page.Namespaces = append(page.Namespaces, nsPage)
+	}
+
+	sort.SliceStable(page.Restarts, func(i, j int) bool { return page.Restarts[i].Restarts > page.Restarts[j].Restarts })
+	if len(page.Restarts) > maxRestarts {
+		page.Restarts = page.Restarts[:maxRestarts]
+	}
+	sortEvents(page.Warnings)
+	if len(page.Warnings) > maxWarnings {
+		page.Warnings = page.Warnings[:maxWarnings]
+	}
+	return page
+}
+
+// newPodRow summarizes the state of a pod. A pod is unhealthy if it failed, is stuck pending,
+// or runs with containers that are not ready.
+func newPodRow(p kubeApiCore.Pod) podRow {
+	row := podRow{Namespace: p.Namespace, Name: p.Name, Phase: string(p.Status.Phase), Reason: p.Status.Reason}
+	ready := 0
+	for _, cs := range p.Status.ContainerStatuses {
+		row.Restarts += cs.RestartCount
+		if cs.Ready {
+			ready++
+		}
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" && row.Reason == "" {
+			row.Reason = cs.State.Waiting.Reason
+		}
+		if cs.State.Terminated != nil && cs.State.Terminated.Reason != "" && row.Reason == "" {
+			row.Reason = cs.State.Terminated.Reason
+		}
+	}
+	for _, c := range p.Status.Conditions {
+		if c.Status == kubeApiCore.ConditionFalse && c.Reason != "" && row.Reason == "" {
+			row.Reason = c.Reason
+		}
+	}
+	row.Ready = fmt.Sprintf("%d/%d", ready, len(p.Spec.Containers))
+	switch p.Status.Phase {
+	case kubeApiCore.PodSucceeded:
+		row.Healthy = true
+	case kubeApiCore.PodRunning:
+		row.Healthy = ready == len(p.Spec.Containers)
+	}
+	return row
+}
+
+func newEventRow(e kubeApiCore.Event) eventRow {
+	last := e.LastTimestamp.Time
+	if last.IsZero() {
+		last = e.EventTime.Time
+	}
+	return eventRow{
+		Namespace: e.Namespace,
+		Last:      last,
+		Type:      e.Type,
+		Reason:    e.Reason,
+		Object:    strings.ToLower(e.InvolvedObject.Kind) + "/" + e.InvolvedObject.Name,
+		Message:   e.Message,
+		Count:     e.Count,
+	}
+}
+
+// sortEvents puts the most recent events first.
+func sortEvents(events []eventRow) {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Last.After(events[j].Last) })
+}
+
+// rawLink returns the path of target relative to the directory of the page, or an empty string
+// if target was not extracted.
+func rawLink(pageDir, target string) string {
+	if _, err := os.Stat(target); err != nil {
+		return ""
+	}
+	absPage, err1 := filepath.Abs(pageDir)
+	absTarget, err2 := filepath.Abs(target)
+	if err1 != nil || err2 != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(absPage, absTarget)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+func render(path string, t *template.Template, data interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Errorf("failed to render %s: %v", path, err)
+	}
+	return sink.WriteFile(path, buf.Bytes())
+}
@@ -0,0 +1,132 @@
+package report
+
+import (
+	"html/template"
+	"time"
+)
+
+// The pages embed their style and do not load anything, so the report can be opened from disk
+// or copied to a machine without network access.
+const style = `<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.bad { color: #b00020; font-weight: bold; }
+.ok { color: #1b7f1b; }
+.muted { color: #777; }
+</style>`
+
+var funcs = template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}
+
+var indexTemplate = template.Must(template.New("index").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Cluster report</title>` + style + `</head><body>
+<h1>Cluster report</h1>
+<p class="muted">Generated {{time .Generated}}{{with .Metadata}}, extracted {{time .Start}} by version {{.ToolVersion}}{{end}}</p>
+<table>
+<tr><th>Cluster</th><th>Server version</th><th>Nodes ready</th><th>Pods</th><th>Unhealthy pods</th><th>Warnings</th></tr>
+{{range .Clusters}}<tr>
+<td><a href="{{.Cluster.Name}}/index.html">{{.Cluster.Name}}</a></td>
+<td>{{with .Cluster.Metadata}}{{.ServerVersion}}{{end}}</td>
+<td{{if lt .ReadyNodes (len .Nodes)}} class="bad"{{end}}>{{.ReadyNodes}}/{{len .Nodes}}</td>
+<td>{{.PodCount}}</td>
+<td{{if .Unhealthy}} class="bad"{{end}}>{{len .Unhealthy}}</td>
+<td>{{len .Warnings}}</td>
+</tr>{{end}}
+</table>
+</body></html>
+`))
+
+var clusterTemplate = template.Must(template.New("cluster").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Cluster.Name}}</title>` + style + `</head><body>
+<p><a href="../index.html">All clusters</a></p>
+<h1>{{.Cluster.Name}}</h1>
+{{with .Cluster.Metadata}}<p class="muted">{{.ServerVersion}} {{.Platform}}, extracted {{time .Start}}</p>{{end}}
+
+<h2>Nodes</h2>
+<table>
+<tr><th>Node</th><th>Ready</th><th>Kubelet</th></tr>
+{{range .Nodes}}<tr>
+<td>{{if .Describe}}<a href="{{.Describe}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td>
+<td>{{if .Ready}}<span class="ok">Ready</span>{{else}}<span class="bad">NotReady</span>{{end}}</td>
+<td>{{.Version}}</td>
+</tr>{{else}}<tr><td colspan="3" class="muted">No nodes extracted</td></tr>{{end}}
+</table>
+
+<h2>Unhealthy pods</h2>
+{{template "pods" .Unhealthy}}
+
+<h2>Restarts</h2>
+{{template "pods" .Restarts}}
+
+<h2>Recent warning events</h2>
+{{template "events" .Warnings}}
+
+<h2>Namespaces</h2>
+<table>
+<tr><th>Namespace</th><th>Pods</th><th>Unhealthy</th><th>Events</th><th>Services</th></tr>
+{{range .Namespaces}}<tr>
+<td><a href="{{.File}}">{{.Name}}</a></td>
+<td>{{len .Pods}}</td>
+<td{{if .Unhealthy}} class="bad"{{end}}>{{.Unhealthy}}</td>
+<td>{{len .Events}}</td>
+<td>{{len .Services}}</td>
+</tr>{{end}}
+</table>
+</body></html>
+{{define "pods"}}<table>
+<tr><th>Namespace</th><th>Pod</th><th>Phase</th><th>Ready</th><th>Reason</th><th>Restarts</th><th>Logs</th></tr>
+{{range .}}<tr>
+<td>{{.Namespace}}</td>
+<td>{{if .Describe}}<a href="{{.Describe}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td>
+<td>{{.Phase}}</td>
+<td>{{.Ready}}</td>
+<td>{{.Reason}}</td>
+<td{{if .Restarts}} class="bad"{{end}}>{{.Restarts}}</td>
+<td>{{range .Logs}}{{if .Href}}<a href="{{.Href}}">{{.Name}}</a> {{end}}{{end}}</td>
+</tr>{{else}}<tr><td colspan="7" class="muted">None</td></tr>{{end}}
+</table>{{end}}
+{{define "events"}}<table>
+<tr><th>Last seen</th><th>Namespace</th><th>Type</th><th>Reason</th><th>Object</th><th>Count</th><th>Message</th></tr>
+{{range .}}<tr>
+<td>{{time .Last}}</td>
+<td>{{.Namespace}}</td>
+<td{{if eq .Type "Warning"}} class="bad"{{end}}>{{.Type}}</td>
+<td>{{.Reason}}</td>
+<td>{{.Object}}</td>
+<td>{{.Count}}</td>
+<td>{{.Message}}</td>
+</tr>{{else}}<tr><td colspan="7" class="muted">None</td></tr>{{end}}
+</table>{{end}}
+`))
+
+var namespaceTemplate = template.Must(template.Must(clusterTemplate.Clone()).New("namespace").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Cluster}}/{{.Name}}</title>` + style + `</head><body>
+<p><a href="../index.html">All clusters</a> / <a href="index.html">{{.Cluster}}</a></p>
+<h1>{{.Name}}</h1>
+
+<h2>Pods</h2>
+{{template "pods" .Pods}}
+
+<h2>Events</h2>
+{{template "events" .Events}}
+
+<h2>Services</h2>
+<table>
+<tr><th>Service</th><th>Type</th><th>Cluster IP</th><th>Selector</th></tr>
+{{range .Services}}<tr>
+<td>{{.Name}}</td>
+<td>{{.Spec.Type}}</td>
+<td>{{.Spec.ClusterIP}}</td>
+<td>{{range $k, $v := .Spec.Selector}}{{$k}}={{$v}} {{end}}</td>
+</tr>{{else}}<tr><td colspan="4" class="muted">None</td></tr>{{end}}
+</table>
+</body></html>
+`))
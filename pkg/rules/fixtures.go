@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/analyze"
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+)
+
+// TestResult is the outcome of a Test.
+type TestResult struct {
+	Rule   string
+	Bundle string
+	// Missing lists the expected objects the rule did not find, Unexpected the ones it found
+	// although they were not expected.
+	Missing    []string
+	Unexpected []string
+	Err        error
+}
+
+// Passed reports whether the rule found exactly the expected objects.
+func (t TestResult) Passed() bool {
+	return t.Err == nil && len(t.Missing) == 0 && len(t.Unexpected) == 0
+}
+
+func (t TestResult) String() string {
+	switch {
+	case t.Err != nil:
+		return fmt.Sprintf("FAIL %s %s: %v", t.Rule, t.Bundle, t.Err)
+	case t.Passed():
+		return fmt.Sprintf("ok   %s %s", t.Rule, t.Bundle)
+	}
+	var problems []string
+	if len(t.Missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(t.Missing, ", "))
+	}
+	if len(t.Unexpected) > 0 {
+		problems = append(problems, "unexpected "+strings.Join(t.Unexpected, ", "))
+	}
+	return fmt.Sprintf("FAIL %s %s: %s", t.Rule, t.Bundle, strings.Join(problems, "; "))
+}
+
+// RunTests runs the tests of every rule, each rule on its own against its fixture bundles.
+func RunTests(rules []*Rule) []TestResult {
+	var results []TestResult
+	bundles := map[string]*bundle.Bundle{}
+	for _, r := range rules {
+		for _, t := range r.Tests {
+			res := TestResult{Rule: r.ID, Bundle: t.Bundle}
+			b, ok := bundles[t.Bundle]
+			if !ok {
+				var err error
+				if b, err = bundle.Load(t.Bundle); err != nil {
+					res.Err = err
+					results = append(results, res)
+					continue
+				}
+				bundles[t.Bundle] = b
+			}
+			res.Missing, res.Unexpected = diff(t.Expect, objects(analyze.Analyze(b, []analyze.Check{r.Check()})))
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+func objects(findings []analyze.Finding) []string {
+	var objs []string
+	for _, f := range findings {
+		objs = append(objs, f.Object())
+	}
+	return objs
+}
+
+// diff returns the elements only in want and the ones only in got.
+func diff(want, got []string) (missing, unexpected []string) {
+	wanted, found := map[string]bool{}, map[string]bool{}
+	for _, w := range want {
+		wanted[w] = true
+	}
+	for _, g := range got {
+		found[g] = true
+		if !wanted[g] {
+			unexpected = append(unexpected, g)
+		}
+	}
+	for _, w := range want {
+		if !found[w] {
+			missing = append(missing, w)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+	return dedup(missing), dedup(unexpected)
+}
+
+func dedup(s []string) []string {
+	var out []string
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
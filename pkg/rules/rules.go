@@ -0,0 +1,448 @@
+// Package rules evaluates user defined rules against an extracted bundle.
+//
+// A rules file is YAML:
+//
+//	rules:
+//	- id: payments-restarts
+//	  severity: warning
+//	  kind: Pod
+//	  namespace: payments
+//	  expr: "{.status.containerStatuses[*].restartCount} > 3"
+//	- id: panics
+//	  severity: error
+//	  log: "panic:"
+//
+// Object rules match a JSONPath expression, optionally compared to a value, against every
+// object of a kind. Log rules match a regular expression against the lines of container logs.
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/analyze"
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// File is the content of a rules file.
+type File struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// Rule is a user defined check.
+type Rule struct {
+	ID          string           `json:"id"`
+	Description string           `json:"description,omitempty"`
+	Severity    analyze.Severity `json:"severity,omitempty"`
+	// Namespace restricts the rule to the objects or logs of a namespace.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Kind is the kind of object Expr is evaluated against: Pod, Node, Service, Event or Endpoints.
+	Kind string `json:"kind,omitempty"`
+	// Expr is a JSONPath template, e.g. {.spec.replicas}, optionally followed by an operator
+	// (==, !=, >, >=, <, <=, =~) and a value. Without an operator the rule matches when the
+	// path yields a value other than false, 0, null or an empty string, list or map. The rule
+	// matches an object if any of the values yielded by the path satisfies the comparison.
+	Expr string `json:"expr,omitempty"`
+
+	// Log is a regular expression matched against every line of the container logs.
+	Log string `json:"log,omitempty"`
+	// Pod and Container are regular expressions restricting the logs a log rule reads.
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+
+	// Message replaces the generated message of the findings.
+	Message string `json:"message,omitempty"`
+	// Tests run the rule against fixture bundles.
+	Tests []Test `json:"tests,omitempty"`
+
+	expr      *expression
+	log       *regexp.Regexp
+	pod       *regexp.Regexp
+	container *regexp.Regexp
+}
+
+// Test expects a rule to find exactly the listed objects in a bundle.
+type Test struct {
+	// Bundle is the directory of the fixture bundle, relative to the rules file.
+	Bundle string `json:"bundle"`
+	// Expect lists the objects of the findings, in the form of analyze.Finding.Object, e.g.
+	// payments/pod/api-1. An empty list expects no finding.
+	Expect []string `json:"expect"`
+}
+
+// Load reads and compiles the rules file at path.
+func Load(path string) ([]*Rule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	if err := yaml.UnmarshalStrict(b, f); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %v", path, err)
+	}
+	ids := map[string]bool{}
+	for i, r := range f.Rules {
+		if r.ID == "" {
+			return nil, fmt.Errorf("rule %d in %s has no id", i+1, path)
+		}
+		if ids[r.ID] {
+			return nil, fmt.Errorf("duplicate rule %s in %s", r.ID, path)
+		}
+		ids[r.ID] = true
+		if err := r.Compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule %s in %s: %v", r.ID, path, err)
+		}
+		for j := range r.Tests {
+			if !filepath.IsAbs(r.Tests[j].Bundle) {
+				r.Tests[j].Bundle = filepath.Join(filepath.Dir(path), r.Tests[j].Bundle)
+			}
+		}
+	}
+	return f.Rules, nil
+}
+
+// Compile validates the rule and prepares its expressions.
+func (r *Rule) Compile() error {
+	switch r.Severity {
+	case "":
+		r.Severity = analyze.Warning
+	case analyze.Error, analyze.Warning, analyze.Info:
+	default:
+		return fmt.Errorf("unknown severity %q", r.Severity)
+	}
+	if (r.Expr == "") == (r.Log == "") {
+		return fmt.Errorf("exactly one of expr and log has to be set")
+	}
+	var err error
+	if r.Expr != "" {
+		if _, ok := kinds[strings.ToLower(r.Kind)]; !ok {
+			return fmt.Errorf("unknown kind %q, expected one of Pod, Node, Service, Event or Endpoints", r.Kind)
+		}
+		if r.expr, err = parseExpression(r.ID, r.Expr); err != nil {
+			return err
+		}
+		return nil
+	}
+	if r.log, err = regexp.Compile(r.Log); err != nil {
+		return err
+	}
+	if r.Pod != "" {
+		if r.pod, err = regexp.Compile(r.Pod); err != nil {
+			return err
+		}
+	}
+	if r.Container != "" {
+		if r.container, err = regexp.Compile(r.Container); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check returns the rule as an analyze.Check. The rule has to be compiled.
+func (r *Rule) Check() analyze.Check {
+	return analyze.Check{Name: r.ID, Description: r.Description, Run: r.run}
+}
+
+// Checks returns rules as analyze.Checks.
+func Checks(rules []*Rule) []analyze.Check {
+	var checks []analyze.Check
+	for _, r := range rules {
+		checks = append(checks, r.Check())
+	}
+	return checks
+}
+
+func (r *Rule) run(c *bundle.Cluster) []analyze.Finding {
+	if r.log != nil {
+		return r.runLogs(c)
+	}
+	return r.runObjects(c)
+}
+
+// object is an object of a bundle converted for JSONPath.
+type object struct {
+	namespace string
+	kind      string
+	name      string
+	content   map[string]interface{}
+}
+
+// kinds returns the objects of a kind in a cluster, keyed by the lower case kind.
+var kinds = map[string]func(c *bundle.Cluster) []runtime.Object{
+	"pod": func(c *bundle.Cluster) (objs []runtime.Object) {
+		for _, ns := range c.Namespaces {
+			for i := range ns.Pods {
+				objs = append(objs, &ns.Pods[i])
+			}
+		}
+		return objs
+	},
+	"node": func(c *bundle.Cluster) (objs []runtime.Object) {
+		for i := range c.Nodes {
+			objs = append(objs, &c.Nodes[i])
+		}
+		return objs
+	},
+	"service": func(c *bundle.Cluster) (objs []runtime.Object) {
+		for _, ns := range c.Namespaces {
+			for i := range ns.Services {
+				objs = append(objs, &ns.Services[i])
+			}
+		}
+		return objs
+	},
+	"event": func(c *bundle.Cluster) (objs []runtime.Object) {
+		for _, ns := range c.Namespaces {
+			for i := range ns.Events {
+				objs = append(objs, &ns.Events[i])
+			}
+		}
+		return objs
+	},
+	"endpoints": func(c *bundle.Cluster) (objs []runtime.Object) {
+		for _, ns := range c.Namespaces {
+			for i := range ns.Endpoints {
+				objs = append(objs, &ns.Endpoints[i])
+			}
+		}
+		return objs
+	},
+}
+
+func (r *Rule) runObjects(c *bundle.Cluster) []analyze.Finding {
+	var findings []analyze.Finding
+	for _, o := range kinds[strings.ToLower(r.Kind)](c) {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(o)
+		if err != nil {
+			continue
+		}
+		obj := object{kind: r.Kind, content: content}
+		if meta, ok := content["metadata"].(map[string]interface{}); ok {
+			obj.name, _ = meta["name"].(string)
+			obj.namespace, _ = meta["namespace"].(string)
+		}
+		if r.Namespace != "" && obj.namespace != r.Namespace {
+			continue
+		}
+		values, ok := r.expr.match(content)
+		if !ok {
+			continue
+		}
+		msg := r.Message
+		if msg == "" {
+			msg = fmt.Sprintf("%s (found %s)", r.Expr, strings.Join(values, ", "))
+		}
+		findings = append(findings, analyze.Finding{
+			Severity:  r.Severity,
+			Namespace: obj.namespace,
+			Kind:      kindName(r.Kind),
+			Name:      obj.name,
+			Message:   msg,
+		})
+	}
+	return findings
+}
+
+// kindName returns the canonical spelling of a kind.
+func kindName(kind string) string {
+	for _, k := range []string{"Pod", "Node", "Service", "Event", "Endpoints"} {
+		if strings.EqualFold(k, kind) {
+			return k
+		}
+	}
+	return kind
+}
+
+// runLogs reports every container log holding a matching line, once per log file.
+func (r *Rule) runLogs(c *bundle.Cluster) []analyze.Finding {
+	files, err := c.LogFiles()
+	if err != nil {
+		return nil
+	}
+	var findings []analyze.Finding
+	for _, lf := range files {
+		if r.Namespace != "" && lf.Namespace != r.Namespace ||
+			r.pod != nil && !r.pod.MatchString(lf.Pod) ||
+			r.container != nil && !r.container.MatchString(lf.Container) {
+			continue
+		}
+		count, first, err := r.scan(lf.Path)
+		if err != nil || count == 0 {
+			continue
+		}
+		source := "container " + lf.Container
+		if lf.Container == "" {
+			source = "pod"
+		}
+		if lf.Previous {
+			source = "previous instance of " + source
+		}
+		msg := r.Message
+		if msg == "" {
+			msg = fmt.Sprintf("%d lines of the %s logs match %q, first: %s", count, source, r.Log, first)
+		}
+		findings = append(findings, analyze.Finding{
+			Severity:  r.Severity,
+			Namespace: lf.Namespace,
+			Kind:      "Pod",
+			Name:      lf.Pod,
+			Message:   msg,
+		})
+	}
+	return findings
+}
+
+func (r *Rule) scan(path string) (int, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	count, first := 0, ""
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		// The kubectl timestamp is not part of the line, so that patterns may be anchored.
+		_, line, _ := bundle.LineTime(s.Text())
+		if r.log.MatchString(line) {
+			if count == 0 {
+				first = strings.TrimSpace(line)
+			}
+			count++
+		}
+	}
+	return count, first, s.Err()
+}
+
+// expression is a JSONPath template with an optional comparison.
+type expression struct {
+	path  *jsonpath.JSONPath
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+var operators = []string{"==", "!=", ">=", "<=", "=~", ">", "<"}
+
+func parseExpression(name, expr string) (*expression, error) {
+	expr = strings.TrimSpace(expr)
+	end := closingBrace(expr)
+	if !strings.HasPrefix(expr, "{") || end < 0 {
+		return nil, fmt.Errorf("expr %q has to start with a JSONPath template in braces", expr)
+	}
+	e := &expression{path: jsonpath.New(name).AllowMissingKeys(true)}
+	if err := e.path.Parse(expr[:end+1]); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath in %q: %v", expr, err)
+	}
+	rest := strings.TrimSpace(expr[end+1:])
+	if rest == "" {
+		return e, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			e.op = op
+			e.value = unquote(strings.TrimSpace(rest[len(op):]))
+			break
+		}
+	}
+	if e.op == "" {
+		return nil, fmt.Errorf("unknown operator in %q, expected one of %s", expr, strings.Join(operators, " "))
+	}
+	if e.op == "=~" {
+		re, err := regexp.Compile(e.value)
+		if err != nil {
+			return nil, err
+		}
+		e.re = re
+	}
+	return e, nil
+}
+
+// closingBrace returns the index of the brace closing the one at the start of s, or -1.
+func closingBrace(s string) int {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'') {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// match evaluates the expression against obj and returns the values satisfying it.
+func (e *expression) match(obj map[string]interface{}) ([]string, bool) {
+	results, err := e.path.FindResults(obj)
+	if err != nil {
+		return nil, false
+	}
+	var matched []string
+	for _, values := range results {
+		for _, v := range values {
+			s := fmt.Sprint(v.Interface())
+			if e.compare(s) {
+				matched = append(matched, s)
+			}
+		}
+	}
+	return matched, len(matched) > 0
+}
+
+func (e *expression) compare(v string) bool {
+	switch e.op {
+	case "":
+		// Empty lists and maps are printed as [] and map[].
+		return v != "" && v != "false" && v != "0" && v != "<nil>" && v != "[]" && v != "map[]"
+	case "=~":
+		return e.re.MatchString(v)
+	case "==":
+		return v == e.value || numbers(v, e.value, func(a, b float64) bool { return a == b })
+	case "!=":
+		return v != e.value && !numbers(v, e.value, func(a, b float64) bool { return a == b })
+	case ">":
+		return numbers(v, e.value, func(a, b float64) bool { return a > b })
+	case ">=":
+		return numbers(v, e.value, func(a, b float64) bool { return a >= b })
+	case "<":
+		return numbers(v, e.value, func(a, b float64) bool { return a < b })
+	case "<=":
+		return numbers(v, e.value, func(a, b float64) bool { return a <= b })
+	}
+	return false
+}
+
+// numbers compares a and b as numbers, and reports false if either is not a number.
+func numbers(a, b string, cmp func(a, b float64) bool) bool {
+	x, err := strconv.ParseFloat(a, 64)
+	if err != nil {
+		return false
+	}
+	y, err := strconv.ParseFloat(b, 64)
+	if err != nil {
+		return false
+	}
+	return cmp(x, y)
+}
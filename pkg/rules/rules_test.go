@@ -0,0 +1,210 @@
+package rules
+
+import "testing"
+
+// The rules of testdata/rules.yaml find exactly the objects their tests expect in the fixture
+// bundles.
+func TestFixtures(t *testing.T) {
+	rules, err := Load("testdata/rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := 0
+	for _, r := range rules {
+		tests += len(r.Tests)
+	}
+	results := RunTests(rules)
+	if len(results) != tests || tests == 0 {
+		t.Fatalf("got %d results for %d tests", len(results), tests)
+	}
+	for _, res := range results {
+		if !res.Passed() {
+			t.Error(res)
+		}
+	}
+}
+
+// A rule expecting something it does not find fails its test.
+func TestFixturesFailing(t *testing.T) {
+	r := &Rule{ID: "restarts", Kind: "Pod", Expr: "{.status.containerStatuses[*].restartCount} > 1",
+		Tests: []Test{{Bundle: "testdata/bundles/broken", Expect: []string{"payments/pod/api-1", "payments/pod/api-2"}}}}
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	res := RunTests([]*Rule{r})
+	if len(res) != 1 || res[0].Passed() {
+		t.Fatalf("results = %v", res)
+	}
+	if got := res[0].String(); got != "FAIL restarts testdata/bundles/broken: missing payments/pod/api-2; unexpected payments/pod/worker-1" {
+		t.Errorf("result = %s", got)
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		expr  string
+		op    string
+		value string
+		err   bool
+	}{
+		{expr: "{.spec.replicas}"},
+		{expr: "  {.spec.replicas}  ", op: ""},
+		{expr: "{.spec.replicas} > 3", op: ">", value: "3"},
+		{expr: "{.spec.replicas}>=3", op: ">=", value: "3"},
+		{expr: "{.spec.replicas} <= 3", op: "<=", value: "3"},
+		{expr: "{.spec.replicas} < 3", op: "<", value: "3"},
+		{expr: "{.status.phase} == 'Running'", op: "==", value: "Running"},
+		{expr: `{.status.phase} != "Failed"`, op: "!=", value: "Failed"},
+		{expr: "{.spec.containers[*].image} =~ ':latest$'", op: "=~", value: ":latest$"},
+		{expr: `{.status.conditions[?(@.type=="Ready")].status} == True`, op: "==", value: "True"},
+		{expr: "{.metadata.labels} == {}", op: "==", value: "{}"},
+		{expr: ".spec.replicas > 3", err: true},
+		{expr: "{.spec.replicas", err: true},
+		{expr: "{.spec.replicas} ~ 3", err: true},
+		{expr: "{.spec.containers[} == 1", err: true},
+		{expr: "{.metadata.name} =~ '('", err: true},
+	}
+	for _, tt := range tests {
+		e, err := parseExpression("test", tt.expr)
+		if (err != nil) != tt.err {
+			t.Errorf("parseExpression(%q) error = %v, want error %v", tt.expr, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if e.op != tt.op || e.value != tt.value {
+			t.Errorf("parseExpression(%q) = %q %q, want %q %q", tt.expr, e.op, e.value, tt.op, tt.value)
+		}
+		if (e.re != nil) != (tt.op == "=~") {
+			t.Errorf("parseExpression(%q) regex = %v", tt.expr, e.re)
+		}
+	}
+}
+
+func TestClosingBrace(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"{}", 1},
+		{"{.a} > 1", 3},
+		{`{.a[?(@.b=="c")].d} == {x}`, 18},
+		{"{.a{b}c} x", 7},
+		{"{.a", -1},
+		{"{{.a}", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		if got := closingBrace(tt.in); got != tt.want {
+			t.Errorf("closingBrace(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value string
+		want  bool
+	}{
+		// Without an operator, the value has to be set and not empty.
+		{"{.a}", "x", true},
+		{"{.a}", "true", true},
+		{"{.a}", "1", true},
+		{"{.a}", "", false},
+		{"{.a}", "false", false},
+		{"{.a}", "0", false},
+		{"{.a}", "<nil>", false},
+		{"{.a}", "[]", false},
+		{"{.a}", "map[]", false},
+		{"{.a}", "[x]", true},
+		{"{.a}", "map[k:v]", true},
+
+		{"{.a} == 3", "3", true},
+		{"{.a} == 3", "3.0", true},
+		{"{.a} == 3", "03", true},
+		{"{.a} == Running", "Running", true},
+		{"{.a} == Running", "running", false},
+		{"{.a} != 3", "3.0", false},
+		{"{.a} != 3", "4", true},
+		{"{.a} != Running", "Failed", true},
+
+		{"{.a} > 3", "4", true},
+		{"{.a} > 3", "3", false},
+		{"{.a} > 3", "10", true},
+		{"{.a} > 3", "x", false},
+		{"{.a} >= 3", "3", true},
+		{"{.a} < 3", "2.5", true},
+		{"{.a} <= 3", "4", false},
+		// Strings are not ordered.
+		{"{.a} > b", "c", false},
+		{"{.a} < 10", "9", true},
+
+		{"{.a} =~ ^img:.*latest$", "img:latest", true},
+		{"{.a} =~ ^img:.*latest$", "img:1.0", false},
+		{"{.a} =~ 'a b'", "xa by", true},
+	}
+	for _, tt := range tests {
+		e, err := parseExpression("test", tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.compare(tt.value); got != tt.want {
+			t.Errorf("%s compare(%q) = %v, want %v", tt.expr, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	pod := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "api-1", "labels": map[string]interface{}{}},
+		"spec": map[string]interface{}{
+			"volumes": []interface{}{},
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "registry/api:latest"},
+				map[string]interface{}{"name": "proxy", "image": "registry/proxy:2.0"},
+			},
+		},
+		"status": map[string]interface{}{
+			"containerStatuses": []interface{}{
+				map[string]interface{}{"name": "app", "restartCount": int64(7)},
+				map[string]interface{}{"name": "proxy", "restartCount": int64(0)},
+			},
+		},
+	}
+	tests := []struct {
+		expr   string
+		values []string
+	}{
+		{"{.status.containerStatuses[*].restartCount} > 3", []string{"7"}},
+		{"{.status.containerStatuses[*].restartCount} >= 0", []string{"7", "0"}},
+		{"{.spec.containers[*].image} =~ :latest$", []string{"registry/api:latest"}},
+		{`{.spec.containers[?(@.name=="proxy")].image}`, []string{"registry/proxy:2.0"}},
+		{"{.metadata.name} == api-1", []string{"api-1"}},
+		// Missing keys yield nothing, whatever the operator.
+		{"{.spec.replicas}", nil},
+		{"{.spec.replicas} != 1", nil},
+		{"{.spec.replicas} < 1", nil},
+		{"{.metadata.labels.team} == payments", nil},
+		// Empty collections do not match without an operator.
+		{"{.spec.volumes}", nil},
+		{"{.metadata.labels}", nil},
+	}
+	for _, tt := range tests {
+		e, err := parseExpression("test", tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, ok := e.match(pod)
+		if ok != (len(tt.values) > 0) || len(values) != len(tt.values) {
+			t.Errorf("%s matched %q, %v, want %q", tt.expr, values, ok, tt.values)
+			continue
+		}
+		for i := range values {
+			if values[i] != tt.values[i] {
+				t.Errorf("%s matched %q, want %q", tt.expr, values, tt.values)
+			}
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Package search finds lines in the container logs and describe files of a bundle.
+package search
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/sink"
+	"github.com/sirupsen/logrus"
+)
+
+// IndexFile caches the index at the root of the bundle.
+const IndexFile = ".search-index.json"
+
+const indexVersion = 2
+
+// offsetInterval is the number of lines between two LineOffsets of a log.
+const offsetInterval = 1000
+
+// maxLineLength is the length lines are truncated to when they are searched.
+const maxLineLength = 1024 * 1024
+
+// Kinds of sources.
+const (
+	Log      = "log"
+	Describe = "describe"
+)
+
+// describeDirs are the directories of the describe files, relative to the cluster.
+var describeDirs = []string{"pods-describe", "nodes-describe", "cm", "svc"}
+
+// Source is a file that can be searched, with the labels the queries filter on.
+type Source struct {
+	// Path is relative to the root of the bundle.
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace,omitempty"`
+	// Pod is the pod of a log, or the name of the described object.
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	Previous  bool   `json:"previous,omitempty"`
+	// First and Last are the earliest and latest timestamps of the lines of a log.
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+	// Ordered is set if the timestamps of the log never go back in time. Only then can a search
+	// start at one of the Offsets and stop at the first line after its window.
+	Ordered bool `json:"ordered,omitempty"`
+	// Offsets locate every offsetInterval-th line of a log.
+	Offsets []LineOffset `json:"offsets,omitempty"`
+	Size    int64        `json:"size"`
+	ModTime time.Time    `json:"modTime"`
+}
+
+// LineOffset is the position of a line in a log, with the timestamp of the lines before it.
+type LineOffset struct {
+	Line   int       `json:"line"`
+	Offset int64     `json:"offset"`
+	Time   time.Time `json:"time"`
+}
+
+// Name identifies the source in the results.
+func (s Source) Name() string {
+	parts := []string{s.Cluster}
+	for _, p := range []string{s.Namespace, s.Pod, s.Container} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	name := strings.Join(parts, "/")
+	if s.Kind == Describe {
+		name += " (describe)"
+	} else if s.Previous {
+		name += " (previous)"
+	}
+	return name
+}
+
+// Index lists the sources of a bundle. It is not a full text index: it records the labels of
+// every source, and the time range and the LineOffsets of the logs, so that a search skips the
+// sources and the parts of the logs outside of its filters and time window. The lines are still
+// read and matched one by one.
+type Index struct {
+	Version int      `json:"version"`
+	Sources []Source `json:"sources"`
+}
+
+// Open returns the index of b, reading the cached one and re-indexing the files that changed
+// since. The updated index is written back to the cache.
+func Open(b *bundle.Bundle) (*Index, error) {
+	cached := map[string]Source{}
+	old := &Index{}
+	if data, err := ioutil.ReadFile(filepath.Join(b.Dir, IndexFile)); err == nil {
+		if json.Unmarshal(data, old) == nil && old.Version == indexVersion {
+			for _, s := range old.Sources {
+				cached[s.Path] = s
+			}
+		}
+	}
+
+	idx := &Index{Version: indexVersion}
+	changed := len(cached) == 0
+	for _, c := range b.Clusters {
+		sources, err := clusterSources(b.Dir, c)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sources {
+			info, err := os.Stat(filepath.Join(b.Dir, s.Path))
+			if err != nil {
+				return nil, err
+			}
+			if prev, ok := cached[s.Path]; ok && prev.Size == info.Size() && prev.ModTime.Equal(info.ModTime()) {
+				idx.Sources = append(idx.Sources, prev)
+				delete(cached, s.Path)
+				continue
+			}
+			s.Size, s.ModTime = info.Size(), info.ModTime()
+			if err := scan(filepath.Join(b.Dir, s.Path), &s); err != nil {
+				return nil, err
+			}
+			idx.Sources = append(idx.Sources, s)
+			changed = true
+		}
+	}
+	if changed || len(cached) > 0 {
+		data, err := json.Marshal(idx)
+		if err != nil {
+			return nil, err
+		}
+		// The index is only a cache, a read-only bundle can still be searched.
+		if err := sink.WriteFile(filepath.Join(b.Dir, IndexFile), data); err != nil {
+			logrus.Warnf("Failed to cache the search index, the logs will be scanned again by the next search: %v", err)
+		}
+	}
+	return idx, nil
+}
+
+// clusterSources lists the logs and describe files of a cluster.
+func clusterSources(root string, c *bundle.Cluster) ([]Source, error) {
+	rel := func(p string) string {
+		r, err := filepath.Rel(root, p)
+		if err != nil {
+			return p
+		}
+		return filepath.ToSlash(r)
+	}
+	var sources []Source
+	files, err := c.LogFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, lf := range files {
+		sources = append(sources, Source{Path: rel(lf.Path), Kind: Log, Cluster: c.Name,
+			Namespace: lf.Namespace, Pod: lf.Pod, Container: lf.Container, Previous: lf.Previous})
+	}
+	for _, d := range describeDirs {
+		matches, err := filepath.Glob(filepath.Join(c.Dir, d, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			sources = append(sources, Source{Path: rel(m), Kind: Describe, Cluster: c.Name,
+				Pod: strings.TrimSuffix(filepath.Base(m), ".yaml")})
+		}
+	}
+	return sources, nil
+}
+
+// scan records the time range and the line offsets of a log, or the namespace of a describe
+// file.
+func scan(path string, s *Source) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := newLineReader(f, 0)
+	var last time.Time
+	s.Ordered = true
+	for n := 1; ; n++ {
+		line, offset, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if s.Kind == Describe {
+			if strings.HasPrefix(line, "Namespace:") {
+				s.Namespace = strings.TrimSpace(strings.TrimPrefix(line, "Namespace:"))
+				break
+			}
+			continue
+		}
+		if n%offsetInterval == 1 && n > 1 {
+			s.Offsets = append(s.Offsets, LineOffset{Line: n, Offset: offset, Time: last})
+		}
+		if t, _, ok := bundle.LineTime(line); ok {
+			if t.Before(last) {
+				s.Ordered = false
+			}
+			last = t
+			if s.First.IsZero() || t.Before(s.First) {
+				s.First = t
+			}
+			if t.After(s.Last) {
+				s.Last = t
+			}
+		}
+	}
+	if s.Kind == Describe || s.First.IsZero() {
+		s.Ordered, s.Offsets = false, nil
+	}
+	return nil
+}
+
+// start returns where a search of the lines timestamped from from on, printing context lines
+// before every match, can start reading s: the last offset after which every line is timestamped
+// before from, moved back by context lines. The zero LineOffset is the start of the file.
+func (s Source) start(from time.Time, context int) LineOffset {
+	if !s.Ordered || from.IsZero() {
+		return LineOffset{}
+	}
+	i := -1
+	for j, o := range s.Offsets {
+		if !o.Time.Before(from) {
+			break
+		}
+		i = j
+	}
+	if i < 0 {
+		return LineOffset{}
+	}
+	first := s.Offsets[i].Line
+	for i >= 0 && s.Offsets[i].Line > first-context {
+		i--
+	}
+	if i < 0 {
+		return LineOffset{}
+	}
+	return s.Offsets[i]
+}
+
+// lineReader reads lines of any length, truncating the ones longer than maxLineLength, and keeps
+// track of their offsets.
+type lineReader struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+// newLineReader returns a reader of the lines of r, which is positioned at offset.
+func newLineReader(r io.Reader, offset int64) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, 64*1024), offset: offset}
+}
+
+// next returns the next line, without its line ending, and its offset. It returns io.EOF once
+// every line was read.
+func (l *lineReader) next() (string, int64, error) {
+	start := l.offset
+	var line []byte
+	for {
+		frag, err := l.r.ReadSlice('\n')
+		l.offset += int64(len(frag))
+		if n := maxLineLength - len(line); n > 0 {
+			if len(frag) > n {
+				frag = frag[:n]
+			}
+			line = append(line, frag...)
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && l.offset > start:
+			err = nil
+		}
+		if err != nil {
+			return "", start, err
+		}
+		return strings.TrimRight(string(line), "\r\n"), start, nil
+	}
+}
@@ -0,0 +1,197 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+)
+
+// Query selects the lines to find. The filters are shell patterns, e.g. --pod='api-*', and
+// match everything when empty.
+type Query struct {
+	Pattern   *regexp.Regexp
+	Cluster   string
+	Namespace string
+	Pod       string
+	Container string
+	// From and To restrict the search to the log lines timestamped in [From, To]. Lines without
+	// a timestamp, e.g. stack traces, take the one of the line before them. Describe files have
+	// no timestamps and are skipped when a window is set.
+	From time.Time
+	To   time.Time
+	// Context is the number of lines printed around every match.
+	Context int
+}
+
+// Result holds the lines of a source matching a query, together with their context.
+type Result struct {
+	Source  Source
+	Lines   []Line
+	Matches int
+}
+
+// Line is a line of a source.
+type Line struct {
+	Number int
+	Text   string
+	Match  bool
+}
+
+// Search runs q against the sources of idx, found in the bundle at dir.
+func Search(dir string, idx *Index, q Query) ([]Result, error) {
+	var results []Result
+	for _, s := range idx.Sources {
+		if !q.selects(s) {
+			continue
+		}
+		res, err := q.searchSource(filepath.Join(dir, s.Path), s)
+		if err != nil {
+			return nil, err
+		}
+		if res.Matches > 0 {
+			results = append(results, res)
+		}
+	}
+	return results, nil
+}
+
+func (q Query) windowed() bool {
+	return !q.From.IsZero() || !q.To.IsZero()
+}
+
+// selects reports whether the query may match a line of s.
+func (q Query) selects(s Source) bool {
+	for _, f := range [][2]string{{q.Cluster, s.Cluster}, {q.Namespace, s.Namespace}, {q.Pod, s.Pod}, {q.Container, s.Container}} {
+		if f[0] == "" {
+			continue
+		}
+		if ok, _ := path.Match(f[0], f[1]); !ok {
+			return false
+		}
+	}
+	if !q.windowed() {
+		return true
+	}
+	if s.Kind != Log || s.First.IsZero() {
+		return false
+	}
+	return (q.To.IsZero() || !s.First.After(q.To)) && (q.From.IsZero() || !s.Last.Before(q.From))
+}
+
+func (q Query) inWindow(t time.Time) bool {
+	if !q.windowed() {
+		return true
+	}
+	return !t.IsZero() && (q.From.IsZero() || !t.Before(q.From)) && (q.To.IsZero() || !t.After(q.To))
+}
+
+// searchSource finds the lines of the source s at p matching q. The lines of an ordered log
+// timestamped before the window of q are skipped using its offsets, and the ones after it are
+// not read.
+func (q Query) searchSource(p string, s Source) (Result, error) {
+	res := Result{Source: s}
+	f, err := os.Open(p)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+
+	start := s.start(q.From, q.Context)
+	if _, err := f.Seek(start.Offset, io.SeekStart); err != nil {
+		return res, err
+	}
+	var (
+		before  []Line
+		after   int
+		last    = start.Time
+		lastOut int
+	)
+	emit := func(l Line) {
+		if l.Number > lastOut {
+			res.Lines = append(res.Lines, l)
+			lastOut = l.Number
+		}
+	}
+	r := newLineReader(f, start.Offset)
+	n := start.Line
+	if n == 0 {
+		n = 1
+	}
+	for ; ; n++ {
+		text, _, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+		line := Line{Number: n, Text: text}
+		if t, _, ok := bundle.LineTime(line.Text); ok {
+			last = t
+		}
+		if s.Ordered && !q.To.IsZero() && last.After(q.To) && after == 0 {
+			break
+		}
+		if q.inWindow(last) && q.Pattern.MatchString(line.Text) {
+			line.Match = true
+			res.Matches++
+			for _, b := range before {
+				emit(b)
+			}
+			before = before[:0]
+			emit(line)
+			after = q.Context
+			continue
+		}
+		if after > 0 {
+			emit(line)
+			after--
+			continue
+		}
+		if q.Context > 0 {
+			if len(before) == q.Context {
+				before = before[1:]
+			}
+			before = append(before, line)
+		}
+	}
+	return res, nil
+}
+
+// Write prints results grouped per source, the way grep does: matching lines are numbered with
+// a colon, context lines with a dash and non-contiguous groups are separated by --.
+func Write(w io.Writer, results []Result) error {
+	for i, r := range results {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "== %s: %d matches (%s)\n", r.Source.Name(), r.Matches, r.Source.Path); err != nil {
+			return err
+		}
+		prev := 0
+		for _, l := range r.Lines {
+			if prev > 0 && l.Number > prev+1 {
+				if _, err := fmt.Fprintln(w, "--"); err != nil {
+					return err
+				}
+			}
+			sep := "-"
+			if l.Match {
+				sep = ":"
+			}
+			if _, err := fmt.Fprintf(w, "%d%s%s\n", l.Number, sep, l.Text); err != nil {
+				return err
+			}
+			prev = l.Number
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package search
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+)
+
+var start = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// testBundle writes a bundle with a single cluster holding the given files and loads it.
+func testBundle(t *testing.T, files map[string]string) *bundle.Bundle {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["prod/nodes.yaml"] = "kind: NodeList\nitems: []\n"
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := bundle.Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// podLog returns a log of n lines one second apart, every tenth line followed by a line without
+// a timestamp.
+func podLog(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%s line %d\n", start.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i)
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "\tat frame %d\n", i)
+		}
+	}
+	return b.String()
+}
+
+func numbers(res []Result) []int {
+	var n []int
+	for _, r := range res {
+		for _, l := range r.Lines {
+			n = append(n, l.Number)
+		}
+	}
+	return n
+}
+
+func TestSearchWindow(t *testing.T) {
+	b := testBundle(t, map[string]string{
+		"prod/logs/default/api-1/app.log": podLog(5000),
+		// Out of order, searched from its start.
+		"prod/logs/default/api-2/app.log": "2024-03-01T01:00:00Z line 2\n2024-03-01T00:00:00Z line 1\n",
+	})
+	defer os.RemoveAll(b.Dir)
+	idx, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]Source{}
+	for _, s := range idx.Sources {
+		sources[s.Pod] = s
+	}
+	if s := sources["api-1"]; !s.Ordered || len(s.Offsets) != 5 || s.Offsets[0].Line != 1001 {
+		t.Fatalf("api-1 indexed as ordered %v with offsets %+v", s.Ordered, s.Offsets)
+	}
+	if s := sources["api-2"]; s.Ordered || len(s.Offsets) != 0 {
+		t.Fatalf("api-2 indexed as ordered %v with offsets %+v", s.Ordered, s.Offsets)
+	}
+
+	tests := []struct {
+		name    string
+		query   Query
+		pod     string
+		numbers []int
+	}{
+		{
+			name:    "window after an offset",
+			query:   Query{Pattern: regexp.MustCompile(`line 300[0-2]$|frame 3000`), From: start.Add(3000 * time.Second), To: start.Add(3002 * time.Second)},
+			pod:     "api-1",
+			numbers: []int{3301, 3302, 3303, 3304},
+		},
+		{
+			name:    "context crossing an offset",
+			query:   Query{Pattern: regexp.MustCompile(`line 1000$`), From: start.Add(1000 * time.Second), To: start.Add(1000 * time.Second), Context: 3},
+			pod:     "api-1",
+			numbers: []int{1098, 1099, 1100, 1101, 1102, 1103, 1104},
+		},
+		{
+			name:    "after context past the window",
+			query:   Query{Pattern: regexp.MustCompile(`line`), From: start.Add(4999 * time.Second), Context: 1},
+			pod:     "api-1",
+			numbers: []int{5499, 5500},
+		},
+		{
+			name:    "unordered log",
+			query:   Query{Pattern: regexp.MustCompile(`line`), From: start, To: start},
+			pod:     "api-2",
+			numbers: []int{2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Pod = tt.pod
+			res, err := Search(b.Dir, idx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := numbers(res); !reflect.DeepEqual(got, tt.numbers) {
+				t.Errorf("line numbers = %v, want %v", got, tt.numbers)
+			}
+			// The offsets only skip lines, reading the whole log finds the same ones.
+			s := sources[tt.pod]
+			s.Offsets, s.Ordered = nil, false
+			full, err := Search(b.Dir, &Index{Sources: []Source{s}}, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(numbers(full), numbers(res)) || len(full) != len(res) || len(res) > 0 && !reflect.DeepEqual(full[0].Lines, res[0].Lines) {
+				t.Errorf("reading the whole log found %v", numbers(full))
+			}
+		})
+	}
+}
+
+func TestSearchLongLine(t *testing.T) {
+	long := "2024-03-01T00:00:01Z " + strings.Repeat("x", 3*1024*1024) + " needle\n"
+	b := testBundle(t, map[string]string{
+		"prod/logs/default/api-1/app.log": "2024-03-01T00:00:00Z first\n" + long + "2024-03-01T00:00:02Z needle\r\n",
+	})
+	defer os.RemoveAll(b.Dir)
+	idx, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := idx.Sources[0]; !s.Last.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("last = %v", s.Last)
+	}
+	res, err := Search(b.Dir, idx, Query{Pattern: regexp.MustCompile(`x+`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || len(res[0].Lines) != 1 || res[0].Lines[0].Number != 2 || len(res[0].Lines[0].Text) != maxLineLength {
+		t.Fatalf("long line not matched: %v", numbers(res))
+	}
+	// The truncated part of the long line is not matched, the lines after it are numbered right.
+	res, err = Search(b.Dir, idx, Query{Pattern: regexp.MustCompile(`needle$`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := numbers(res); !reflect.DeepEqual(got, []int{3}) || res[0].Lines[0].Text != "2024-03-01T00:00:02Z needle" {
+		t.Errorf("line numbers = %v", got)
+	}
+}
+
+func TestIndexCache(t *testing.T) {
+	b := testBundle(t, map[string]string{
+		"prod/logs/default/api-1/app.log":     "2024-03-01T00:00:00Z a\n",
+		"prod/pods-describe/api-1.yaml":       "Name: api-1\nNamespace: payments\n",
+		"prod/logs/default/api-2/app.log":     "2024-03-01T00:00:00Z b\n",
+		"prod/logs/default/api-2/sidecar.log": "no timestamps\n",
+	})
+	defer os.RemoveAll(b.Dir)
+	idx, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Sources) != 4 {
+		t.Fatalf("got %d sources", len(idx.Sources))
+	}
+	for _, s := range idx.Sources {
+		if s.Kind == Describe && s.Namespace != "payments" {
+			t.Errorf("describe file in namespace %q", s.Namespace)
+		}
+		if s.Container == "sidecar" && (s.Ordered || !s.First.IsZero()) {
+			t.Errorf("log without timestamps indexed as %+v", s)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(b.Dir, IndexFile)); err != nil {
+		t.Fatal(err)
+	}
+	// A changed file is re-indexed.
+	p := filepath.Join(b.Dir, "prod/logs/default/api-1/app.log")
+	if err := ioutil.WriteFile(p, []byte("2024-03-01T00:00:00Z a\n2024-03-01T05:00:00Z c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err = Open(b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range idx.Sources {
+		if s.Pod == "api-1" && s.Kind == Log && !s.Last.Equal(start.Add(5*time.Hour)) {
+			t.Errorf("changed log not re-indexed: last = %v", s.Last)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/redact"
+)
+
+// Command builds the argument list of a process. Arguments are passed to the process as they
+// are, without going through a shell, so they may contain spaces, quotes or any other character.
+type Command struct {
+	name string
+	args []string
+}
+
+// NewCommand returns a command running name with args. Empty args are dropped.
+func NewCommand(name string, args ...string) *Command {
+	return (&Command{name: name}).Arg(args...)
+}
+
+// Arg appends the non-empty args.
+func (c *Command) Arg(args ...string) *Command {
+	for _, a := range args {
+		if a != "" {
+			c.args = append(c.args, a)
+		}
+	}
+	return c
+}
+
+// Flag appends flag=value, e.g. --namespace=default, unless value is empty.
+func (c *Command) Flag(flag, value string) *Command {
+	if value != "" {
+		c.args = append(c.args, flag+"="+value)
+	}
+	return c
+}
+
+// BoolFlag appends flag if set.
+func (c *Command) BoolFlag(flag string, set bool) *Command {
+	if set {
+		c.args = append(c.args, flag)
+	}
+	return c
+}
+
+// Name returns the program run by the command.
+func (c *Command) Name() string {
+	return c.name
+}
+
+// Args returns the arguments of the command, without the program.
+func (c *Command) Args() []string {
+	return append([]string(nil), c.args...)
+}
+
+// String returns the command line quoted the way a POSIX shell would need it. The values of
+// flags holding credentials are masked.
+func (c *Command) String() string {
+	parts := []string{Quote(c.name)}
+	for _, a := range c.args {
+		parts = append(parts, Quote(redact.Arg(a)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Execute runs the command and returns its output.
+func (c *Command) Execute(combinedOutput bool) (string, error) {
+	return ExecuteArgs(nil, combinedOutput, c.name, c.args...)
+}
+
+// Quote returns s quoted for a POSIX shell. Strings made only of safe characters are returned
+// unchanged.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Split splits a command line into arguments the way a POSIX shell does for words, honouring
+// single quotes, double quotes and backslash escapes. Quoted empty strings are kept as
+// empty arguments.
+func Split(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				// Inside double quotes a backslash only escapes the characters special there.
+				if i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+					escaped = true
+				} else {
+					cur.WriteRune(r)
+				}
+			default:
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, s)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in %q", s)
+	}
+	if inWord {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,130 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Command
+		want []string
+	}{
+		{
+			name: "empty args dropped",
+			cmd:  NewCommand("kubectl", "get", "", "pods").Arg("", "-o", ""),
+			want: []string{"get", "pods", "-o"},
+		},
+		{
+			name: "empty flag values dropped",
+			cmd:  NewCommand("kubectl", "get").Flag("--namespace", "").Flag("--context", "prod"),
+			want: []string{"get", "--context=prod"},
+		},
+		{
+			name: "values passed as they are",
+			cmd:  NewCommand("kubectl").Flag("--selector", "app in (a, b)").Arg(`it's "$HOME"`),
+			want: []string{"--selector=app in (a, b)", `it's "$HOME"`},
+		},
+		{
+			name: "bool flags",
+			cmd:  NewCommand("kubectl", "logs").BoolFlag("--previous", false).BoolFlag("--timestamps", true),
+			want: []string{"logs", "--timestamps"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cmd.Args(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	cmd := NewCommand("kubectl", "get", "pods").Flag("--token", "secret").Flag("--selector", "app=web, tier")
+	want := "kubectl get pods '--token=***' '--selector=app=web, tier'"
+	if got := cmd.String(); got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "''"},
+		{"pods", "pods"},
+		{"--namespace=kube-system", "--namespace=kube-system"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{`"quoted"`, `'"quoted"'`},
+		{"$HOME", "'$HOME'"},
+		{"a\nb", "'a\nb'"},
+		{"*", "'*'"},
+	}
+	for _, tt := range tests {
+		if got := Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{in: "", want: nil},
+		{in: "  get   pods\t-o wide\n", want: []string{"get", "pods", "-o", "wide"}},
+		{in: `get 'a b' "c d"`, want: []string{"get", "a b", "c d"}},
+		{in: `'' ""`, want: []string{"", ""}},
+		{in: `a\ b \'c`, want: []string{"a b", "'c"}},
+		{in: `"\$HOME \"x\" \n"`, want: []string{`$HOME "x" \n`}},
+		{in: `'$HOME \n'`, want: []string{`$HOME \n`}},
+		{in: `pre'fix'"ed"`, want: []string{"prefixed"}},
+		{in: "'unterminated", err: true},
+		{in: `"unterminated`, err: true},
+		{in: `trailing\`, err: true},
+	}
+	for _, tt := range tests {
+		got, err := Split(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("Split(%q) error = %v, want error %v", tt.in, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// Every argument quoted with Quote is split back into the same argument.
+func TestQuoteSplitRoundTrip(t *testing.T) {
+	tests := [][]string{
+		{"kubectl", "get", "pods"},
+		{"kubectl", "", "--selector=app in (a, b)"},
+		{"echo", "it's", `"double"`, "$HOME", "`id`", `back\slash`},
+		{"echo", "line\nbreak", "tab\there", "  spaces  "},
+		{"echo", "ünïcode", "'", `\`, `"`},
+	}
+	for _, args := range tests {
+		var line string
+		for i, a := range args {
+			if i > 0 {
+				line += " "
+			}
+			line += Quote(a)
+		}
+		got, err := Split(line)
+		if err != nil {
+			t.Errorf("Split(%s) error = %v", line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, args) {
+			t.Errorf("Split(%s) = %q, want %q", line, got, args)
+		}
+	}
+}
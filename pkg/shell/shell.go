@@ -3,36 +3,28 @@ package shell
 import (
 	"fmt"
 	"os/exec"
-	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
-// Execute the given command.
+// Execute the given command. The formatted command line is split into arguments the way a
+// shell would, see Split. Prefer NewCommand when arguments come from user input.
 func Execute(combinedOutput bool, format string, args ...interface{}) (string, error) {
 	s := fmt.Sprintf(format, args...)
-	// TODO: escape handling
-	parts := strings.Split(s, " ")
-
-	var p []string
-	for i := 0; i < len(parts); i++ {
-		if parts[i] != "" {
-			p = append(p, parts[i])
-		}
+	parts, err := Split(s)
+	if err != nil {
+		return "", err
 	}
-
-	var argStrings []string
-	if len(p) > 0 {
-		argStrings = p[1:]
+	if len(parts) == 0 {
+		return "", fmt.Errorf("empty command")
 	}
-	return ExecuteArgs(nil, combinedOutput, parts[0], argStrings...)
+	return ExecuteArgs(nil, combinedOutput, parts[0], parts[1:]...)
 }
 
+// ExecuteArgs runs name with args, passed to the process as they are.
 func ExecuteArgs(env []string, combinedOutput bool, name string, args ...string) (string, error) {
 	if logrus.IsLevelEnabled(logrus.DebugLevel) {
-		cmd := strings.Join(args, " ")
-		cmd = name + " " + cmd
-		logrus.Debugf("Executing command: %s", cmd)
+		logrus.Debugf("Executing command: %s", &Command{name: name, args: args})
 	}
 
 	c := exec.Command(name, args...)
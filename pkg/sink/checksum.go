@@ -0,0 +1,156 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ManifestFile lists the SHA-256 of every file of a bundle, at its root, in the format of
+// sha256sum so that it can also be checked with sha256sum --check.
+const ManifestFile = "checksums.sha256"
+
+// ChecksumSink records the SHA-256 of every file written to the next sink and, when closed,
+// writes them to ManifestFile. If the next sink is a Reader, the files listed by the manifest of
+// a previous run are kept, so that a resumed or incremental run covers the whole bundle.
+type ChecksumSink struct {
+	next    Sink
+	mu      sync.Mutex
+	sums    map[string]string
+	written pathSet
+}
+
+// NewChecksumSink returns a sink recording the checksums of the files written to next.
+func NewChecksumSink(next Sink) *ChecksumSink {
+	return &ChecksumSink{next: next, sums: map[string]string{}}
+}
+
+func (c *ChecksumSink) Write(name string, data []byte) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	if err := c.next.Write(name, data); err != nil {
+		return err
+	}
+	if c.written.add(name) {
+		c.record(name, data)
+	}
+	return nil
+}
+
+// Append appends data to the file at name and records the checksum of the whole file, read back
+// from the next sink.
+func (c *ChecksumSink) Append(name string, data []byte) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	if err := Append(c.next, name, data); err != nil {
+		return err
+	}
+	r, ok := c.next.(Reader)
+	if !ok {
+		return fmt.Errorf("%T cannot read back %s", c.next, name)
+	}
+	all, err := r.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	c.written.add(name)
+	c.record(name, all)
+	return nil
+}
+
+// RecordChecksum records sum, hex encoded, as the SHA-256 of the file at name, which a previous
+// run wrote to the next sink.
+func (c *ChecksumSink) RecordChecksum(name, sum string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sums[name] = sum
+}
+
+func (c *ChecksumSink) record(name string, data []byte) {
+	sum := sha256.Sum256(data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sums[name] = hex.EncodeToString(sum[:])
+}
+
+// Close writes the manifest and closes the next sink.
+func (c *ChecksumSink) Close() error {
+	err := c.writeManifest()
+	if cerr := c.next.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *ChecksumSink) writeManifest() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sums := map[string]string{}
+	if r, ok := c.next.(Reader); ok {
+		data, err := r.ReadFile(ManifestFile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			previous, err := ReadManifest(bytes.NewReader(data))
+			if err != nil {
+				return fmt.Errorf("failed to read the previous %s: %v", ManifestFile, err)
+			}
+			for name, sum := range previous {
+				sums[name] = sum
+			}
+		}
+	}
+	for name, sum := range c.sums {
+		sums[name] = sum
+	}
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, sums); err != nil {
+		return err
+	}
+	return c.next.Write(ManifestFile, buf.Bytes())
+}
+
+// WriteManifest writes the checksums of sums, keyed by path, sorted by path.
+func WriteManifest(w io.Writer, sums map[string]string) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", sums[name], name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadManifest parses a manifest written by WriteManifest into checksums keyed by path.
+func ReadManifest(r io.Reader) (map[string]string, error) {
+	sums := map[string]string{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		i := strings.Index(line, "  ")
+		if i != sha256.Size*2 {
+			return nil, fmt.Errorf("line %d: invalid checksum line", n)
+		}
+		sums[line[i+2:]] = line[:i]
+	}
+	return sums, sc.Err()
+}
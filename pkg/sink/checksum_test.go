@@ -0,0 +1,225 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func sum(data string) string {
+	s := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(s[:])
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readManifest(t *testing.T, dir string) map[string]string {
+	f, err := os.Open(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sums, err := ReadManifest(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sums
+}
+
+// The manifest of a run keeps the files of the previous runs it did not write again.
+func TestChecksumManifestMerge(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	for _, run := range []map[string]string{
+		{"prod/pods.out": "web-1", "prod/nodes.out": "node-1"},
+		{"prod/pods.out": "web-1\nweb-2", "staging/pods.out": "api-1"},
+	} {
+		out := NewChecksumSink(NewFileSink(dir))
+		for name, data := range run {
+			if err := out.Write(name, []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{
+		"prod/nodes.out":   sum("node-1"),
+		"prod/pods.out":    sum("web-1\nweb-2"),
+		"staging/pods.out": sum("api-1"),
+	}
+	if got := readManifest(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("manifest = %v, want %v", got, want)
+	}
+}
+
+// Only the first write of a path is recorded, like the sinks only keep the first one.
+func TestChecksumFirstWrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	out := NewChecksumSink(NewFileSink(dir))
+	for _, data := range []string{"first", "second"} {
+		if err := out.Write("prod/pods.out", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readManifest(t, dir)["prod/pods.out"]; got != sum("first") {
+		t.Errorf("checksum = %s, want the one of the first write", got)
+	}
+}
+
+// The checksum of an appended file covers the whole file, read back from the next sink.
+func TestChecksumAppend(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	log := "prod/logs/default/web-1/nginx.log"
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestFile), []byte(sum("old")+"  "+log+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(log)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, log), []byte("line 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := NewChecksumSink(NewFileSink(dir))
+	for _, data := range []string{"line 2\n", "line 3\n"} {
+		if err := out.Append(log, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readManifest(t, dir)[log], sum("line 1\nline 2\nline 3\n"); got != want {
+		t.Errorf("checksum = %s, want %s", got, want)
+	}
+	v, err := Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.OK() || v.Checked != 1 {
+		t.Errorf("Verify() = %+v", v)
+	}
+}
+
+// appendOnlySink can append but not read back its files.
+type appendOnlySink struct {
+	files map[string][]byte
+}
+
+func (s *appendOnlySink) Write(name string, data []byte) error {
+	s.files[name] = data
+	return nil
+}
+
+func (s *appendOnlySink) Append(name string, data []byte) error {
+	s.files[name] = append(s.files[name], data...)
+	return nil
+}
+
+func (s *appendOnlySink) Close() error {
+	return nil
+}
+
+func TestChecksumAppendWithoutReader(t *testing.T) {
+	out := NewChecksumSink(&appendOnlySink{files: map[string][]byte{}})
+	if err := out.Append("prod/logs/default/web-1/nginx.log", []byte("line\n")); err == nil {
+		t.Error("Append() succeeded without a way to checksum the file")
+	}
+	if err := NewChecksumSink(NewMemorySink()).Append("prod/events.out", nil); err == nil {
+		t.Error("Append() to a sink that cannot append succeeded")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	out := NewChecksumSink(NewFileSink(dir))
+	for _, name := range []string{"prod/pods.out", "prod/nodes.out", "prod/events.out", "prod/metadata.json"} {
+		if err := out.Write(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	v, err := Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.OK() || v.Checked != 4 || v.Mismatched != nil || v.Missing != nil || v.Unlisted != nil {
+		t.Fatalf("Verify() of an intact bundle = %+v", v)
+	}
+
+	for name, data := range map[string]string{
+		"prod/pods.out":         "changed",
+		"prod/report/index.htm": "<html>",
+		"findings.json":         "[]",
+		"checkpoint.ndjson":     "{}",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(filepath.Join(dir, "prod", "nodes.out")); err != nil {
+		t.Fatal(err)
+	}
+	v, err = Verify(dir, "checkpoint.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Verification{
+		Checked:    4,
+		Mismatched: []string{"prod/pods.out"},
+		Missing:    []string{"prod/nodes.out"},
+		Unlisted:   []string{"findings.json", "prod/report/index.htm"},
+	}
+	if v.OK() || !reflect.DeepEqual(v, want) {
+		t.Errorf("Verify() = %+v, want %+v", v, want)
+	}
+}
+
+func TestVerifyWithoutManifest(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	if _, err := Verify(dir); !os.IsNotExist(err) {
+		t.Errorf("Verify() error = %v, want the manifest missing", err)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	var buf bytes.Buffer
+	sums := map[string]string{"b": sum("b"), "a": sum("a")}
+	if err := WriteManifest(&buf, sums); err != nil {
+		t.Fatal(err)
+	}
+	if want := sum("a") + "  a\n" + sum("b") + "  b\n"; buf.String() != want {
+		t.Errorf("WriteManifest() = %q, want %q", buf.String(), want)
+	}
+	got, err := ReadManifest(&buf)
+	if err != nil || !reflect.DeepEqual(got, sums) {
+		t.Errorf("ReadManifest() = %v, %v, want %v", got, err, sums)
+	}
+	if _, err := ReadManifest(bytes.NewBufferString("abc  a\n")); err == nil {
+		t.Error("ReadManifest() of an invalid line succeeded")
+	}
+}
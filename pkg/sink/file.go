@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileSink writes every file below a directory on the local filesystem. Files left by a
+// previous run are replaced, see pkg/checkpoint to resume an interrupted one instead.
+type FileSink struct {
+	dir     string
+	written pathSet
+}
+
+// NewFileSink returns a sink writing below dir.
+func NewFileSink(dir string) *FileSink {
+	return &FileSink{dir: dir}
+}
+
+// Dir returns the root directory of the sink.
+func (f *FileSink) Dir() string {
+	return f.dir
+}
+
+func (f *FileSink) Write(name string, data []byte) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	if !f.written.add(name) {
+		return nil
+	}
+	fpath := filepath.Join(f.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		return err
+	}
+	return WriteFile(fpath, data)
+}
+
+// Append adds data to the end of the file at name, creating it if needed. The file is replaced
+// by a copy with data appended, so that it is never left half appended.
+func (f *FileSink) Append(name string, data []byte) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	fpath := filepath.Join(f.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		return err
+	}
+	existing, err := ioutil.ReadFile(fpath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return WriteFile(fpath, append(existing, data...))
+}
+
+// ReadFile returns the content of the file at name.
+func (f *FileSink) ReadFile(name string) ([]byte, error) {
+	name, err := Clean(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(f.dir, filepath.FromSlash(name)))
+}
+
+func (f *FileSink) Close() error {
+	return nil
+}
+
+// WriteFile writes data to a temporary file next to fpath, syncs it to disk and renames it to
+// fpath, so that fpath is either left as it was or complete. The commands writing next to a
+// bundle use it as well.
+func WriteFile(fpath string, data []byte) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(fpath), "."+filepath.Base(fpath)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Chmod(0644); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fpath)
+}
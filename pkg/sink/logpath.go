@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	logsDir           = "logs"
+	logSuffix         = ".log"
+	previousLogSuffix = ".previous.log"
+	// EventsFile is the path, relative to the cluster, of the events written by the events extractor.
+	EventsFile = "events.out"
+)
+
+// LogFile identifies the log of a single container.
+type LogFile struct {
+	Cluster   string
+	Namespace string
+	Pod       string
+	Container string
+	// Previous is set for the log of the previous instance of the container.
+	Previous bool
+}
+
+// LogPath returns the path, relative to the cluster, the log of a container is written to.
+func LogPath(namespace, pod, container string, previous bool) string {
+	suffix := logSuffix
+	if previous {
+		suffix = previousLogSuffix
+	}
+	return path.Join(logsDir, namespace, pod, container+suffix)
+}
+
+// ParseLogPath reports whether p, a path relative to the root of the bundle, is a container log
+// and which container it belongs to.
+func ParseLogPath(p string) (LogFile, bool) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 5 || parts[1] != logsDir || !strings.HasSuffix(parts[4], logSuffix) {
+		return LogFile{}, false
+	}
+	lf := LogFile{Cluster: parts[0], Namespace: parts[2], Pod: parts[3]}
+	if strings.HasSuffix(parts[4], previousLogSuffix) {
+		lf.Container = strings.TrimSuffix(parts[4], previousLogSuffix)
+		lf.Previous = true
+	} else {
+		lf.Container = strings.TrimSuffix(parts[4], logSuffix)
+	}
+	return lf, true
+}
+
+// Labels returns the labels identifying the log in a log backend.
+func (lf LogFile) Labels() map[string]string {
+	l := map[string]string{
+		"cluster":   lf.Cluster,
+		"namespace": lf.Namespace,
+		"pod":       lf.Pod,
+		"container": lf.Container,
+		"source":    "container",
+	}
+	if lf.Previous {
+		l["previous"] = "true"
+	}
+	return l
+}
+
+// isEventsPath reports whether p is the events file of a cluster and returns the cluster.
+func isEventsPath(p string) (string, bool) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 2 || parts[1] != EventsFile {
+		return "", false
+	}
+	return parts[0], true
+}
@@ -0,0 +1,55 @@
+package sink
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemorySink keeps every file in memory. It is mostly useful in tests.
+type MemorySink struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemorySink returns an empty in-memory sink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{files: map[string][]byte{}}
+}
+
+func (m *MemorySink) Write(name string, data []byte) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; ok {
+		return nil
+	}
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemorySink) Close() error {
+	return nil
+}
+
+// Get returns the content written to name.
+func (m *MemorySink) Get(name string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.files[name]
+	return data, ok
+}
+
+// Paths returns the sorted paths of all written files.
+func (m *MemorySink) Paths() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	paths := make([]string, 0, len(m.files))
+	for p := range m.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/logparse"
+	"github.com/sirupsen/logrus"
+)
+
+// NormalizedDir holds the normalized container logs, relative to the cluster.
+const NormalizedDir = "normalized"
+
+// NormalizeSink detects JSON and logfmt container logs and, next to every such log, writes an
+// NDJSON copy with one normalized record per line under NormalizedDir. Every file is passed on
+// to the next sink unchanged.
+type NormalizeSink struct {
+	next Sink
+}
+
+// NewNormalizeSink returns a sink normalizing the container logs written to next.
+func NewNormalizeSink(next Sink) *NormalizeSink {
+	return &NormalizeSink{next: next}
+}
+
+// normalizedRecord is a line of the NDJSON file.
+type normalizedRecord struct {
+	logparse.Record
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Previous  bool   `json:"previous,omitempty"`
+	Format    string `json:"format"`
+}
+
+func (n *NormalizeSink) Write(name string, data []byte) error {
+	if err := n.next.Write(name, data); err != nil {
+		return err
+	}
+	return n.normalize(name, data, n.next.Write)
+}
+
+// Append appends data to name and its normalized records to the normalized copy. The format
+// is detected on the appended lines only.
+func (n *NormalizeSink) Append(name string, data []byte) error {
+	if err := Append(n.next, name, data); err != nil {
+		return err
+	}
+	return n.normalize(name, data, func(p string, b []byte) error { return Append(n.next, p, b) })
+}
+
+func (n *NormalizeSink) normalize(name string, data []byte, write func(string, []byte) error) error {
+	lf, ok := ParseLogPath(name)
+	if !ok {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	format := logparse.Detect(lines)
+	if format == logparse.Plain {
+		logrus.Debugf("Not normalizing %s, no structured format detected", name)
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		err := enc.Encode(normalizedRecord{
+			Record:    logparse.Parse(format, line),
+			Cluster:   lf.Cluster,
+			Namespace: lf.Namespace,
+			Pod:       lf.Pod,
+			Container: lf.Container,
+			Previous:  lf.Previous,
+			Format:    format,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return write(NormalizedPath(lf), buf.Bytes())
+}
+
+func (n *NormalizeSink) Completed(name string) bool {
+	return Completed(n.next, name)
+}
+
+func (n *NormalizeSink) Close() error {
+	return n.next.Close()
+}
+
+// NormalizedPath returns the path, relative to the root of the bundle, of the normalized copy of
+// a container log.
+func NormalizedPath(lf LogFile) string {
+	name := lf.Container + ".ndjson"
+	if lf.Previous {
+		name = lf.Container + ".previous.ndjson"
+	}
+	return path.Join(lf.Cluster, NormalizedDir, lf.Namespace, lf.Pod, name)
+}
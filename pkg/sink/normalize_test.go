@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeSink(t *testing.T) {
+	files := map[string]string{
+		"prod/logs/payments/api-1/app.log": "2024-03-01T10:00:00Z {\"level\":\"info\",\"msg\":\"ready\",\"port\":8080}\n" +
+			"2024-03-01T10:00:01Z {\"level\":50,\"msg\":\"payment failed\",\"time\":\"2024-03-01T10:00:00.5Z\"}\n" +
+			"2024-03-01T10:00:01Z {\"msg\":\"retrying\"}\n" +
+			"2024-03-01T10:00:01Z {\"msg\":\"retrying\"}\n" +
+			"2024-03-01T10:00:02Z panic: boom\n",
+		"prod/logs/payments/api-1/app.previous.log": "level=warn msg=\"shutting down\"\nlevel=info msg=bye\n",
+		"prod/logs/payments/api-1/proxy.log":        "2024-03-01T10:00:00Z GET /health 200\n",
+		"prod/pods-describe/api-1.yaml":             "{\"level\":\"info\",\"msg\":\"not a log\"}\n",
+	}
+	next := NewMemorySink()
+	out := NewNormalizeSink(next)
+	for name, data := range files {
+		if err := out.Write(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"prod/logs/payments/api-1/app.log",
+		"prod/logs/payments/api-1/app.previous.log",
+		"prod/logs/payments/api-1/proxy.log",
+		"prod/normalized/payments/api-1/app.ndjson",
+		"prod/normalized/payments/api-1/app.previous.ndjson",
+		"prod/pods-describe/api-1.yaml",
+	}
+	if got := next.Paths(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("paths = %q\nwant %q", got, want)
+	}
+	for name, data := range files {
+		if got, _ := next.Get(name); string(got) != data {
+			t.Errorf("%s changed: %q", name, got)
+		}
+	}
+
+	retrying := map[string]interface{}{
+		"timestamp": "2024-03-01T10:00:01Z", "message": "retrying", "fields": map[string]interface{}{"msg": "retrying"},
+		"cluster": "prod", "namespace": "payments", "pod": "api-1", "container": "app", "format": "json",
+	}
+	tests := []struct {
+		path    string
+		records []map[string]interface{}
+	}{
+		{
+			path: "prod/normalized/payments/api-1/app.ndjson",
+			records: []map[string]interface{}{
+				{
+					"timestamp": "2024-03-01T10:00:00Z", "level": "info", "message": "ready",
+					"fields":  map[string]interface{}{"level": "info", "msg": "ready", "port": float64(8080)},
+					"cluster": "prod", "namespace": "payments", "pod": "api-1", "container": "app", "format": "json",
+				},
+				{
+					"timestamp": "2024-03-01T10:00:00.5Z", "level": "error", "message": "payment failed",
+					"fields":  map[string]interface{}{"level": float64(50), "msg": "payment failed", "time": "2024-03-01T10:00:00.5Z"},
+					"cluster": "prod", "namespace": "payments", "pod": "api-1", "container": "app", "format": "json",
+				},
+				retrying,
+				retrying,
+				{
+					"timestamp": "2024-03-01T10:00:02Z", "message": "panic: boom", "unparsed": true,
+					"cluster": "prod", "namespace": "payments", "pod": "api-1", "container": "app", "format": "json",
+				},
+			},
+		},
+		{
+			path: "prod/normalized/payments/api-1/app.previous.ndjson",
+			records: []map[string]interface{}{
+				{
+					"level": "warn", "message": "shutting down", "fields": map[string]interface{}{"level": "warn", "msg": "shutting down"},
+					"cluster": "prod", "namespace": "payments", "pod": "api-1", "container": "app", "previous": true, "format": "logfmt",
+				},
+				{
+					"level": "info", "message": "bye", "fields": map[string]interface{}{"level": "info", "msg": "bye"},
+					"cluster": "prod", "namespace": "payments", "pod": "api-1", "container": "app", "previous": true, "format": "logfmt",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		data, _ := next.Get(tt.path)
+		var records []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var r map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatalf("%s: invalid line %q: %v", tt.path, line, err)
+			}
+			records = append(records, r)
+		}
+		if !reflect.DeepEqual(records, tt.records) {
+			t.Errorf("%s:\n%s\nwant %v", tt.path, data, tt.records)
+		}
+	}
+}
+
+// Appended lines are normalized and appended to the normalized copy.
+func TestNormalizeSinkAppend(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	out := NewNormalizeSink(NewFileSink(dir))
+	log := "prod/logs/default/web-1/nginx.log"
+	if err := out.Write(log, []byte("{\"msg\":\"one\"}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Append(log, []byte("{\"msg\":\"two\"}\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewFileSink(dir).ReadFile("prod/normalized/default/web-1/nginx.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"message":"one"`) || !strings.Contains(lines[1], `"message":"two"`) {
+		t.Errorf("normalized copy:\n%s", data)
+	}
+}
@@ -0,0 +1,352 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PushLoki sends the entries to the Loki push API (/loki/api/v1/push).
+	PushLoki = "loki"
+	// PushJSON sends the entries as a JSON array of {timestamp, labels, line} objects.
+	PushJSON = "json"
+)
+
+// PushConfig configures a PushSink.
+type PushConfig struct {
+	URL string
+	// Format is either PushLoki or PushJSON.
+	Format string
+	// Headers are added to every request, e.g. X-Scope-OrgID for a multi-tenant Loki.
+	Headers map[string]string
+	// BatchSize is the number of lines sent per request.
+	BatchSize int
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry. It doubles with every attempt.
+	Backoff time.Duration
+}
+
+// PushEntry is a single log line together with the labels of its source.
+type PushEntry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Labels    map[string]string `json:"labels"`
+	Line      string            `json:"line"`
+}
+
+// PushSink sends container logs and events to a log backend and passes every file on to
+// the next sink. Lines are batched and requests failing with a network error, 429 or 5xx
+// are retried with exponential backoff. The batches are sent in order by a single goroutine,
+// so that the writers do not wait for the backend. A failed push stops pushing but not the
+// writes to the next sink, and is returned by Close.
+type PushSink struct {
+	cfg    PushConfig
+	next   Sink
+	client *http.Client
+
+	mu    sync.Mutex
+	batch []PushEntry
+
+	batches chan []PushEntry
+	done    chan struct{}
+	// stateMu guards the outcome of the sender.
+	stateMu sync.Mutex
+	err     error
+	retries int
+}
+
+// NewPushSink returns a sink pushing to the backend described by cfg. next may be nil.
+func NewPushSink(cfg PushConfig, next Sink) (*PushSink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("push url is not set")
+	}
+	if cfg.Format != PushLoki && cfg.Format != PushJSON {
+		return nil, fmt.Errorf("unknown push format %q", cfg.Format)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 500 * time.Millisecond
+	}
+	p := &PushSink{
+		cfg:     cfg,
+		next:    next,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		batches: make(chan []PushEntry, 4),
+		done:    make(chan struct{}),
+	}
+	go p.sender()
+	return p, nil
+}
+
+// Write passes the file on to the next sink and pushes it.
+func (p *PushSink) Write(name string, data []byte) error {
+	if p.next != nil {
+		if err := p.next.Write(name, data); err != nil {
+			return err
+		}
+	}
+	p.pushFile(name, data)
+	return nil
+}
+
+// Append appends the lines to the next sink and pushes them.
+func (p *PushSink) Append(name string, data []byte) error {
+	if p.next != nil {
+		if err := Append(p.next, name, data); err != nil {
+			return err
+		}
+	}
+	p.pushFile(name, data)
+	return nil
+}
+
+// pushFile pushes the lines of the container logs and the events. Pushing never fails the
+// write: the bundle is complete even if the backend is down, and the failure is returned by
+// Close.
+func (p *PushSink) pushFile(name string, data []byte) {
+	if lf, ok := ParseLogPath(name); ok {
+		p.push(lf.Labels(), data, nil)
+	} else if cluster, ok := isEventsPath(name); ok {
+		p.push(map[string]string{"cluster": cluster, "source": "events"}, data, eventNamespace)
+	}
+}
+
+func (p *PushSink) Completed(name string) bool {
+	return p.next != nil && Completed(p.next, name)
+}
+
+// Close sends the remaining lines and closes the next sink.
+func (p *PushSink) Close() error {
+	p.mu.Lock()
+	if len(p.batch) > 0 {
+		p.batches <- p.batch
+		p.batch = nil
+	}
+	close(p.batches)
+	p.mu.Unlock()
+	<-p.done
+	p.stateMu.Lock()
+	err, retries := p.err, p.retries
+	p.stateMu.Unlock()
+	if retries > 0 {
+		logrus.Infof("Push to %s needed %d retries", p.cfg.URL, retries)
+	}
+	if p.next != nil {
+		if cerr := p.next.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// failure returns the error the sender stopped at, if any.
+func (p *PushSink) failure() error {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.err
+}
+
+// fail records err as the failure of the push, unless one is already recorded.
+func (p *PushSink) fail(err error) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// push queues every line of data. extra, if set, returns additional labels for a line and
+// reports whether the line has to be sent at all. Nothing is queued once the push failed.
+func (p *PushSink) push(labels map[string]string, data []byte, extra func(string) (map[string]string, bool)) {
+	if p.failure() != nil {
+		return
+	}
+	var (
+		entries []PushEntry
+		last    time.Time
+	)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+		l := labels
+		if extra != nil {
+			more, ok := extra(line)
+			if !ok {
+				continue
+			}
+			l = merge(labels, more)
+		}
+		last = timestamp(line, last)
+		entries = append(entries, PushEntry{Timestamp: last, Labels: l, Line: line})
+	}
+	if err := s.Err(); err != nil {
+		p.fail(err)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range entries {
+		p.batch = append(p.batch, e)
+		if len(p.batch) >= p.cfg.BatchSize {
+			// Queued while holding p.mu, so that the batches are sent in the order they
+			// were filled and the lines of a stream reach the backend in order.
+			p.batches <- p.batch
+			p.batch = nil
+		}
+	}
+}
+
+// timestamp returns the time of a line written with kubectl logs --timestamps. Lines without
+// a timestamp, such as the lines of kubectl get events, are placed right after the previous
+// line of the same file, the first one at the current time.
+func timestamp(line string, previous time.Time) time.Time {
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+			return t
+		}
+	}
+	if previous.IsZero() {
+		return time.Now()
+	}
+	return previous.Add(time.Nanosecond)
+}
+
+// sender sends the queued batches until the queue is closed. Once a batch failed, the
+// remaining ones are dropped.
+func (p *PushSink) sender() {
+	defer close(p.done)
+	for batch := range p.batches {
+		if p.failure() != nil {
+			continue
+		}
+		if err := p.flush(batch); err != nil {
+			p.fail(err)
+		}
+	}
+}
+
+// flush sends a batch, retrying the requests that may succeed later.
+func (p *PushSink) flush(batch []PushEntry) error {
+	body, err := p.encode(batch)
+	if err != nil {
+		return err
+	}
+	backoff := p.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := p.send(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= p.cfg.MaxRetries {
+			return fmt.Errorf("failed to push logs to %s: %v", p.cfg.URL, err)
+		}
+		logrus.Debugf("Push to %s failed, retrying in %s: %v", p.cfg.URL, backoff, err)
+		p.stateMu.Lock()
+		p.retries++
+		p.stateMu.Unlock()
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send posts body and reports whether a failed request may be retried.
+func (p *PushSink) send(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+	return retry, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (p *PushSink) encode(entries []PushEntry) ([]byte, error) {
+	if p.cfg.Format == PushJSON {
+		return json.Marshal(entries)
+	}
+
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	var streams []*stream
+	byLabels := map[string]*stream{}
+	for _, e := range entries {
+		key := labelKey(e.Labels)
+		s, ok := byLabels[key]
+		if !ok {
+			s = &stream{Stream: e.Labels}
+			byLabels[key] = s
+			streams = append(streams, s)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.Timestamp.UnixNano(), 10), e.Line})
+	}
+	return json.Marshal(struct {
+		Streams []*stream `json:"streams"`
+	}{streams})
+}
+
+// eventNamespace takes the namespace of an event from the first column of kubectl get events
+// --all-namespaces and skips the header.
+func eventNamespace(line string) (map[string]string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] == "NAMESPACE" {
+		return nil, false
+	}
+	return map[string]string{"namespace": fields[0]}, true
+}
+
+func labelKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + labels[k] + ",")
+	}
+	return b.String()
+}
+
+func merge(a, b map[string]string) map[string]string {
+	m := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		m[k] = v
+	}
+	return m
+}
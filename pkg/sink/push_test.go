@@ -0,0 +1,228 @@
+package sink
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pushServer records the bodies of the requests it accepts and answers the first ones with the
+// given status codes.
+type pushServer struct {
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (s *pushServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	s.requests++
+	if len(s.statuses) > 0 {
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		if status != http.StatusNoContent {
+			http.Error(w, "try later", status)
+			return
+		}
+	}
+	s.bodies = append(s.bodies, body)
+	s.headers = append(s.headers, r.Header)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+const podLog = "2024-03-01T10:00:00.000000001Z starting\n" +
+	"2024-03-01T10:00:01Z panic: boom\n" +
+	"2024-03-01T10:00:01.5Z goroutine 1 [running]:\n"
+
+func TestPushLoki(t *testing.T) {
+	srv := &pushServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	next := NewMemorySink()
+	p, err := NewPushSink(PushConfig{URL: ts.URL, Format: PushLoki, BatchSize: 2, Headers: map[string]string{"X-Scope-OrgID": "team"}}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write("prod/logs/default/web-1/nginx.log", []byte(podLog)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write("prod/pods.out", []byte("not a log\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(srv.bodies) != 2 {
+		t.Fatalf("got %d requests, want 2 batches of at most 2 lines", len(srv.bodies))
+	}
+	var values [][2]string
+	for i, body := range srv.bodies {
+		var push lokiPush
+		if err := json.Unmarshal(body, &push); err != nil {
+			t.Fatalf("invalid payload %s: %v", body, err)
+		}
+		if len(push.Streams) != 1 {
+			t.Fatalf("got %d streams, want 1", len(push.Streams))
+		}
+		want := map[string]string{"cluster": "prod", "namespace": "default", "pod": "web-1", "container": "nginx", "source": "container"}
+		for k, v := range want {
+			if push.Streams[0].Stream[k] != v {
+				t.Errorf("label %s = %q, want %q", k, push.Streams[0].Stream[k], v)
+			}
+		}
+		if got := srv.headers[i].Get("X-Scope-OrgID"); got != "team" {
+			t.Errorf("X-Scope-OrgID = %q", got)
+		}
+		values = append(values, push.Streams[0].Values...)
+	}
+	want := [][2]string{
+		{"1709287200000000001", "2024-03-01T10:00:00.000000001Z starting"},
+		{"1709287201000000000", "2024-03-01T10:00:01Z panic: boom"},
+		{"1709287201500000000", "2024-03-01T10:00:01.5Z goroutine 1 [running]:"},
+	}
+	if len(values) != len(want) {
+		t.Fatalf("got values %v, want %v", values, want)
+	}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Errorf("value %d = %v, want %v", i, values[i], want[i])
+		}
+	}
+	if b, ok := next.Get("prod/logs/default/web-1/nginx.log"); !ok || string(b) != podLog {
+		t.Errorf("log not passed on to the next sink")
+	}
+}
+
+func TestPushRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		requests int
+		err      string
+	}{
+		{name: "accepted", requests: 1},
+		{name: "429 then accepted", statuses: []int{http.StatusTooManyRequests}, retries: 2, requests: 2},
+		{name: "5xx then accepted", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable}, retries: 2, requests: 3},
+		{name: "retries exhausted", statuses: []int{500, 500, 500}, retries: 2, requests: 3, err: "500 Internal Server Error"},
+		{name: "4xx not retried", statuses: []int{http.StatusBadRequest}, retries: 2, requests: 1, err: "400 Bad Request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &pushServer{statuses: tt.statuses}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+			p, err := NewPushSink(PushConfig{URL: ts.URL, Format: PushJSON, MaxRetries: tt.retries, Backoff: time.Millisecond}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Write("prod/logs/default/web-1/nginx.log", []byte(podLog)); err != nil {
+				t.Fatal(err)
+			}
+			err = p.Close()
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("Close() error = %v, want %q", err, tt.err)
+			}
+			if srv.requests != tt.requests {
+				t.Errorf("got %d requests, want %d", srv.requests, tt.requests)
+			}
+			if tt.err != "" {
+				return
+			}
+			var entries []PushEntry
+			if err := json.Unmarshal(srv.bodies[0], &entries); err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 3 || entries[1].Line != "2024-03-01T10:00:01Z panic: boom" ||
+				!entries[1].Timestamp.Equal(time.Date(2024, 3, 1, 10, 0, 1, 0, time.UTC)) {
+				t.Errorf("unexpected entries %+v", entries)
+			}
+		})
+	}
+}
+
+// A failed push is reported by Close. The files are still written to the next sink, so that an
+// outage of the backend does not leave the bundle empty.
+func TestPushFailureReported(t *testing.T) {
+	srv := &pushServer{statuses: []int{http.StatusBadRequest}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	next := NewMemorySink()
+	p, err := NewPushSink(PushConfig{URL: ts.URL, Format: PushLoki, BatchSize: 1}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Write("prod/logs/default/web-1/nginx.log", []byte(podLog)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for p.failure() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if p.failure() == nil {
+		t.Fatal("push did not fail")
+	}
+	for _, name := range []string{"prod/logs/default/web-2/nginx.log", "prod/events.out", "prod/pods.out"} {
+		if err := p.Write(name, []byte(podLog)); err != nil {
+			t.Errorf("Write(%s) after a failed push error = %v", name, err)
+		}
+	}
+	if err := p.Close(); err == nil {
+		t.Errorf("Close() after a failed push succeeded")
+	}
+	want := []string{"prod/events.out", "prod/logs/default/web-1/nginx.log", "prod/logs/default/web-2/nginx.log", "prod/pods.out"}
+	if got := next.Paths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("next sink holds %q, want %q", got, want)
+	}
+	if srv.requests != 1 {
+		t.Errorf("%d requests after a failed push, want 1", srv.requests)
+	}
+}
+
+func TestPushEvents(t *testing.T) {
+	srv := &pushServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	p, err := NewPushSink(PushConfig{URL: ts.URL, Format: PushJSON}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := "NAMESPACE   LAST SEEN   TYPE      REASON    OBJECT      MESSAGE\n" +
+		"default     1m          Warning   BackOff   pod/web-1   Back-off restarting failed container\n" +
+		"kube-system 2m          Normal    Pulled    pod/dns-1   Container image pulled\n"
+	if err := p.Write("prod/events.out", []byte(events)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var entries []PushEntry
+	if err := json.Unmarshal(srv.bodies[0], &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Labels["namespace"] != "default" || entries[1].Labels["namespace"] != "kube-system" ||
+		entries[0].Labels["source"] != "events" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if !entries[1].Timestamp.After(entries[0].Timestamp) {
+		t.Errorf("events without a timestamp are not kept in order: %v, %v", entries[0].Timestamp, entries[1].Timestamp)
+	}
+}
@@ -0,0 +1,391 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultS3PartSize is the size of the parts used for multipart uploads.
+	DefaultS3PartSize = 16 << 20
+	// minS3PartSize is the smallest part size accepted by S3 for all but the last part.
+	minS3PartSize = 5 << 20
+)
+
+// S3Config holds the location and credentials of an S3 compatible object storage.
+type S3Config struct {
+	// Endpoint is the base URL of the storage, e.g. https://s3.eu-west-1.amazonaws.com or
+	// http://localhost:9000 for a local MinIO. Buckets are always addressed path-style.
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	Prefix          string `json:"prefix"`
+	AccessKeyID     string `json:"accessKeyID"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	SessionToken    string `json:"sessionToken"`
+	PartSize        int64  `json:"partSize"`
+}
+
+// LoadS3Config reads the configuration from the JSON file at file, if not empty, and overrides
+// it with the S3_ENDPOINT, S3_REGION (or AWS_REGION), S3_BUCKET, S3_PREFIX, AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func LoadS3Config(file string) (*S3Config, error) {
+	cfg := &S3Config{}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse s3 config %s: %v", file, err)
+		}
+	}
+	for _, e := range []struct {
+		env   string
+		field *string
+	}{
+		{"S3_ENDPOINT", &cfg.Endpoint},
+		{"AWS_REGION", &cfg.Region},
+		{"S3_REGION", &cfg.Region},
+		{"S3_BUCKET", &cfg.Bucket},
+		{"S3_PREFIX", &cfg.Prefix},
+		{"AWS_ACCESS_KEY_ID", &cfg.AccessKeyID},
+		{"AWS_SECRET_ACCESS_KEY", &cfg.SecretAccessKey},
+		{"AWS_SESSION_TOKEN", &cfg.SessionToken},
+	} {
+		if v := os.Getenv(e.env); v != "" {
+			*e.field = v
+		}
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize == 0 {
+		cfg.PartSize = DefaultS3PartSize
+	}
+	switch {
+	case cfg.Endpoint == "":
+		return nil, fmt.Errorf("s3 endpoint is not set")
+	case cfg.Bucket == "":
+		return nil, fmt.Errorf("s3 bucket is not set")
+	case cfg.AccessKeyID == "" || cfg.SecretAccessKey == "":
+		return nil, fmt.Errorf("s3 credentials are not set")
+	case cfg.PartSize < minS3PartSize:
+		return nil, fmt.Errorf("s3 part size has to be at least %d bytes", minS3PartSize)
+	}
+	return cfg, nil
+}
+
+// S3Client uploads objects to an S3 compatible object storage, signing requests with AWS
+// signature version 4.
+type S3Client struct {
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Client returns a client for the storage described by cfg.
+func NewS3Client(cfg *S3Config) (*S3Client, error) {
+	if _, err := url.Parse(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint %q: %v", cfg.Endpoint, err)
+	}
+	return &S3Client{cfg: *cfg, client: http.DefaultClient, now: time.Now}, nil
+}
+
+// Key returns the object key of name below the configured prefix.
+func (c *S3Client) Key(name string) string {
+	return strings.TrimPrefix(path.Join(c.cfg.Prefix, name), "/")
+}
+
+// PutObject uploads data as a single object.
+func (c *S3Client) PutObject(key string, data []byte) error {
+	resp, err := c.do(http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Upload reads r until EOF and stores it under key. Content larger than the part size is sent
+// as a multipart upload. The SHA-256 of the content is stored next to it, in key + ".sha256".
+func (c *S3Client) Upload(key string, r io.Reader) error {
+	h := sha256.New()
+	r = io.TeeReader(r, h)
+	first, err := readPart(r, c.cfg.PartSize)
+	if err != nil {
+		return err
+	}
+	if int64(len(first)) < c.cfg.PartSize {
+		err = c.PutObject(key, first)
+	} else {
+		err = c.multipartUpload(key, first, r)
+	}
+	if err != nil {
+		return err
+	}
+	sum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), path.Base(key))
+	return c.PutObject(key+".sha256", []byte(sum))
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (c *S3Client) multipartUpload(key string, first []byte, r io.Reader) (err error) {
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = decodeXML(resp, &initiated)
+	if err != nil {
+		return err
+	}
+	uploadID := initiated.UploadID
+	defer func() {
+		if err != nil {
+			if resp, aerr := c.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil); aerr == nil {
+				_ = resp.Body.Close()
+			}
+		}
+	}()
+
+	var parts []completedPart
+	for part := first; len(part) > 0; {
+		n := len(parts) + 1
+		q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		resp, err := c.do(http.MethodPut, key, q, part)
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d of %s: %v", n, key, err)
+		}
+		_ = resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: n, ETag: resp.Header.Get("ETag")})
+		if part, err = readPart(r, c.cfg.PartSize); err != nil {
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err = c.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	if err != nil {
+		return err
+	}
+	// Completing an upload can fail after the status line was sent, in which case the
+	// error is reported in the body of a 200 response.
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if err = decodeXML(resp, &result); err != nil {
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		return fmt.Errorf("failed to complete upload of %s: %s: %s", key, result.Code, result.Message)
+	}
+	return nil
+}
+
+// do sends a signed request for key and returns the response if its status is 2xx.
+func (c *S3Client) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u, err := url.Parse(c.cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + c.cfg.Bucket + "/" + key
+	u.RawPath = "/" + s3Escape(c.cfg.Bucket, false) + "/" + s3Escape(key, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body != nil {
+		sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	c.sign(req, body)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		var s3err struct {
+			Code    string
+			Message string
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if xml.Unmarshal(b, &s3err) == nil && s3err.Code != "" {
+			return nil, fmt.Errorf("%s %s: %s: %s", method, key, s3err.Code, s3err.Message)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, key, resp.Status)
+	}
+	return resp, nil
+}
+
+// sign adds an AWS signature version 4 authorization header to req.
+func (c *S3Client) sign(req *http.Request, body []byte) {
+	t := c.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + c.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), day)
+	for _, s := range []string{c.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// S3Sink streams a tar.gz archive of every written file to an object, uploading it while
+// the extractors are still running.
+type S3Sink struct {
+	*TarGzSink
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// NewS3Sink starts the upload of the archive to key.
+func NewS3Sink(c *S3Client, key string) *S3Sink {
+	pr, pw := io.Pipe()
+	s := &S3Sink{TarGzSink: NewTarGzSink(pw), pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := c.Upload(key, pr)
+		// Unblock the writers if the upload stopped before reading everything.
+		_ = pr.CloseWithError(fmt.Errorf("upload of %s aborted: %v", key, err))
+		s.done <- err
+	}()
+	return s
+}
+
+// Close finishes the archive and waits for the upload to complete.
+func (s *S3Sink) Close() error {
+	err := s.TarGzSink.Close()
+	if err != nil {
+		_ = s.pw.CloseWithError(err)
+	}
+	if uerr := <-s.done; uerr != nil {
+		return uerr
+	}
+	return err
+}
+
+// readPart reads up to size bytes from r. It returns an empty slice once r is exhausted.
+func readPart(r io.Reader, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+func decodeXML(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes s as required by signature version 4. Slashes are kept unless
+// encodeSlash is set.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
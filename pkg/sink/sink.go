@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Sink receives the files produced by the extractors. Paths are slash separated and
+// relative to the root of the bundle, e.g. "prod.kubeconfig/pods-describe/nginx.yaml".
+//
+// A path is written at most once, later writes to the same path are ignored.
+type Sink interface {
+	Write(path string, data []byte) error
+	Close() error
+}
+
+// Appender is implemented by sinks able to add to the end of a file written by a previous run.
+type Appender interface {
+	Append(path string, data []byte) error
+}
+
+// Append adds data to the end of the file at name, if s is an Appender.
+func Append(s Sink, name string, data []byte) error {
+	a, ok := s.(Appender)
+	if !ok {
+		return fmt.Errorf("%T cannot append to %s", s, name)
+	}
+	return a.Append(name, data)
+}
+
+// Reader is implemented by sinks able to read back the files they hold.
+type Reader interface {
+	ReadFile(path string) ([]byte, error)
+}
+
+// Completer is implemented by sinks that know which files an interrupted run already wrote
+// completely, so that extractors can avoid fetching them again.
+type Completer interface {
+	Completed(path string) bool
+}
+
+// Completed reports whether the file at name was completed by a previous run, if s is a
+// Completer.
+func Completed(s Sink, name string) bool {
+	c, ok := s.(Completer)
+	return ok && c.Completed(name)
+}
+
+// Checksummer is implemented by sinks recording the checksums of the files of a bundle, so that
+// they can be given the checksums of files written by a previous run instead of the files.
+type Checksummer interface {
+	RecordChecksum(path, sum string)
+}
+
+// Clean validates p and returns it in its canonical form.
+func Clean(p string) (string, error) {
+	c := path.Clean(filepath.ToSlash(p))
+	if c == "." || c == ".." || strings.HasPrefix(c, "/") || strings.HasPrefix(c, "../") {
+		return "", fmt.Errorf("invalid sink path %q", p)
+	}
+	return c, nil
+}
+
+// Prefix returns a Sink which writes to s with every path placed under prefix.
+// Closing the returned sink does not close s.
+func Prefix(s Sink, prefix string) Sink {
+	return &prefixSink{s: s, prefix: prefix}
+}
+
+type prefixSink struct {
+	s      Sink
+	prefix string
+}
+
+func (p *prefixSink) Write(name string, data []byte) error {
+	return p.s.Write(path.Join(p.prefix, name), data)
+}
+
+func (p *prefixSink) Append(name string, data []byte) error {
+	return Append(p.s, path.Join(p.prefix, name), data)
+}
+
+func (p *prefixSink) Completed(name string) bool {
+	return Completed(p.s, path.Join(p.prefix, name))
+}
+
+func (p *prefixSink) Close() error {
+	return nil
+}
+
+// WriteDir copies every regular file found under dir to s, under prefix.
+func WriteDir(s Sink, dir, prefix string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return s.Write(path.Join(prefix, filepath.ToSlash(rel)), data)
+	})
+}
+
+// pathSet records the paths already written to a sink.
+type pathSet struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// add reports whether p was not seen before and marks it as seen.
+func (ps *pathSet) add(p string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.seen == nil {
+		ps.seen = map[string]bool{}
+	}
+	if ps.seen[p] {
+		return false
+	}
+	ps.seen[p] = true
+	return true
+}
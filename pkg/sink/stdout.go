@@ -0,0 +1,51 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// StdoutSink prints every file to a writer, preceded by a header holding its path.
+type StdoutSink struct {
+	mu    sync.Mutex
+	w     io.Writer
+	paths pathSet
+}
+
+// NewStdoutSink returns a sink printing to os.Stdout.
+func NewStdoutSink() *StdoutSink {
+	return NewWriterSink(os.Stdout)
+}
+
+// NewWriterSink returns a sink printing to w.
+func NewWriterSink(w io.Writer) *StdoutSink {
+	return &StdoutSink{w: w}
+}
+
+func (s *StdoutSink) Write(name string, data []byte) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	if !s.paths.add(name) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, "==> %s <==\n", name); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		_, err = io.WriteString(s.w, "\n")
+	}
+	return err
+}
+
+func (s *StdoutSink) Close() error {
+	return nil
+}
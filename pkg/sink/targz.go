@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TarGzSink writes every file into a single gzip compressed tar archive.
+type TarGzSink struct {
+	mu    sync.Mutex
+	w     io.WriteCloser
+	gz    *gzip.Writer
+	tw    *tar.Writer
+	paths pathSet
+}
+
+// NewTarGzSink returns a sink writing a tar.gz archive to w. Closing the sink closes w.
+func NewTarGzSink(w io.WriteCloser) *TarGzSink {
+	gz := gzip.NewWriter(w)
+	return &TarGzSink{w: w, gz: gz, tw: tar.NewWriter(gz)}
+}
+
+// NewTarGzFile creates the archive at path, truncating any existing file.
+func NewTarGzFile(path string) (*TarGzSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewTarGzSink(f), nil
+}
+
+func (t *TarGzSink) Write(name string, data []byte) error {
+	name, err := Clean(name)
+	if err != nil {
+		return err
+	}
+	if !t.paths.add(name) {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err = t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = t.tw.Write(data)
+	return err
+}
+
+func (t *TarGzSink) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if err := t.gz.Close(); err != nil {
+		return err
+	}
+	return t.w.Close()
+}
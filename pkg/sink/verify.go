@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Verification is the outcome of checking a bundle against its manifest.
+type Verification struct {
+	// Checked is the number of files listed by the manifest.
+	Checked int
+	// Mismatched lists the files whose content changed, Missing the ones that are gone.
+	Mismatched []string
+	Missing    []string
+	// Unlisted lists the files of the bundle the manifest does not cover, e.g. written later by
+	// the analyze or report commands.
+	Unlisted []string
+}
+
+// OK reports whether every file listed by the manifest is intact.
+func (v *Verification) OK() bool {
+	return len(v.Mismatched) == 0 && len(v.Missing) == 0
+}
+
+// Verify checks the files of the bundle in dir against its ManifestFile. The files named ignore,
+// at the root of the bundle, are not reported as unlisted.
+func Verify(dir string, ignore ...string) (*Verification, error) {
+	f, err := os.Open(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	sums, err := ReadManifest(f)
+	_ = f.Close()
+	if err != nil {
+		return nil, err
+	}
+	v := &Verification{Checked: len(sums)}
+	for name, want := range sums {
+		got, err := fileSum(filepath.Join(dir, filepath.FromSlash(name)))
+		switch {
+		case os.IsNotExist(err):
+			v.Missing = append(v.Missing, name)
+		case err != nil:
+			return nil, err
+		case got != want:
+			v.Mismatched = append(v.Mismatched, name)
+		}
+	}
+	skip := map[string]bool{ManifestFile: true}
+	for _, name := range ignore {
+		skip[name] = true
+	}
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); !skip[rel] {
+			if _, ok := sums[rel]; !ok {
+				v.Unlisted = append(v.Unlisted, rel)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(v.Mismatched)
+	sort.Strings(v.Missing)
+	sort.Strings(v.Unlisted)
+	return v, nil
+}
+
+func fileSum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
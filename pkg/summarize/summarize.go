@@ -0,0 +1,298 @@
+package summarize
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+	"github.com/astralkn/k8s-logs-extractor/pkg/logparse"
+	kubeApiCore "k8s.io/api/core/v1"
+)
+
+// SummaryFile and SummaryText are written in the directory of every summarized cluster.
+const (
+	SummaryFile = "log-summary.json"
+	SummaryText = "log-summary.txt"
+)
+
+// Options configures the summaries.
+type Options struct {
+	// Top is the number of templates kept per container, highlighted ones excluded.
+	Top int
+	// RestartWindow is how close to a restart a line has to be to count as near it.
+	RestartWindow time.Duration
+}
+
+// ContainerSummary lists the templates of the logs of a container.
+type ContainerSummary struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	// Container is empty for the per pod logs of kubectl cluster-info dump.
+	Container string      `json:"container,omitempty"`
+	Lines     int         `json:"lines"`
+	Templates int         `json:"templates"`
+	Restarts  []time.Time `json:"restarts,omitempty"`
+	Top       []*Stat     `json:"top"`
+	// Highlights are the templates found only in the previous instance of the container or
+	// only near restarts.
+	Highlights []*Stat `json:"highlights,omitempty"`
+}
+
+// Stat counts the lines of a template.
+type Stat struct {
+	Template string    `json:"template"`
+	Example  string    `json:"example"`
+	Count    int       `json:"count"`
+	Previous int       `json:"previous"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+	// NearRestart counts the lines written within the restart window of a restart.
+	NearRestart  int  `json:"nearRestart"`
+	OnlyPrevious bool `json:"onlyPrevious,omitempty"`
+}
+
+// Flags returns the reasons the template is highlighted.
+func (s *Stat) Flags() string {
+	var flags []string
+	if s.OnlyPrevious {
+		flags = append(flags, "only-previous")
+	}
+	if s.nearRestarts() {
+		flags = append(flags, "near-restart")
+	}
+	return strings.Join(flags, ",")
+}
+
+// nearRestarts reports whether every line of the template was written near a restart.
+func (s *Stat) nearRestarts() bool {
+	return s.NearRestart > 0 && s.NearRestart == s.Count
+}
+
+func (s *Stat) seen(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if s.First.IsZero() || t.Before(s.First) {
+		s.First = t
+	}
+	if t.After(s.Last) {
+		s.Last = t
+	}
+}
+
+// Cluster summarizes the logs of every container of c.
+func Cluster(c *bundle.Cluster, opts Options) ([]ContainerSummary, error) {
+	files, err := c.LogFiles()
+	if err != nil {
+		return nil, err
+	}
+	type key struct{ namespace, pod, container string }
+	var keys []key
+	byContainer := map[key][]bundle.LogFile{}
+	for _, lf := range files {
+		k := key{lf.Namespace, lf.Pod, lf.Container}
+		if _, ok := byContainer[k]; !ok {
+			keys = append(keys, k)
+		}
+		byContainer[k] = append(byContainer[k], lf)
+	}
+	var summaries []ContainerSummary
+	for _, k := range keys {
+		s := &ContainerSummary{Cluster: c.Name, Namespace: k.namespace, Pod: k.pod, Container: k.container}
+		if err := s.summarize(byContainer[k], restarts(c, k.namespace, k.pod, k.container), opts); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, *s)
+	}
+	return summaries, nil
+}
+
+// restarts returns the times the container was restarted at, according to its status.
+func restarts(c *bundle.Cluster, namespace, pod, container string) []time.Time {
+	ns := c.Namespace(namespace)
+	if ns == nil {
+		return nil
+	}
+	var times []time.Time
+	for _, p := range ns.Pods {
+		if p.Name != pod {
+			continue
+		}
+		for _, cs := range append(append([]kubeApiCore.ContainerStatus(nil), p.Status.InitContainerStatuses...), p.Status.ContainerStatuses...) {
+			if container != "" && cs.Name != container {
+				continue
+			}
+			if t := cs.LastTerminationState.Terminated; t != nil && !t.FinishedAt.IsZero() {
+				times = append(times, t.FinishedAt.Time)
+			}
+		}
+	}
+	return times
+}
+
+type line struct {
+	time     time.Time
+	template string
+	text     string
+	previous bool
+}
+
+func (s *ContainerSummary) summarize(files []bundle.LogFile, restartTimes []time.Time, opts Options) error {
+	var lines []line
+	hasCurrent := false
+	for _, lf := range files {
+		read, err := readLines(lf)
+		if err != nil {
+			return err
+		}
+		if lf.Previous {
+			// The previous instance stopped right after its last line, whether or not the
+			// status still records the restart.
+			if n := len(read); n > 0 && !read[n-1].time.IsZero() {
+				restartTimes = append(restartTimes, read[n-1].time)
+			}
+		} else {
+			hasCurrent = true
+		}
+		lines = append(lines, read...)
+	}
+	s.Restarts = mergeTimes(restartTimes, opts.RestartWindow)
+
+	stats := map[string]*Stat{}
+	var order []*Stat
+	for _, l := range lines {
+		st, ok := stats[l.template]
+		if !ok {
+			st = &Stat{Template: l.template, Example: l.text}
+			stats[l.template] = st
+			order = append(order, st)
+		}
+		st.Count++
+		if l.previous {
+			st.Previous++
+		}
+		st.seen(l.time)
+		if near(l.time, s.Restarts, opts.RestartWindow) {
+			st.NearRestart++
+		}
+	}
+	s.Lines, s.Templates = len(lines), len(order)
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i].Count > order[j].Count })
+	for _, st := range order {
+		st.OnlyPrevious = hasCurrent && st.Previous == st.Count
+		if st.OnlyPrevious || st.nearRestarts() {
+			s.Highlights = append(s.Highlights, st)
+		} else if len(s.Top) < opts.Top {
+			s.Top = append(s.Top, st)
+		}
+	}
+	if len(s.Highlights) > opts.Top {
+		s.Highlights = s.Highlights[:opts.Top]
+	}
+	return nil
+}
+
+func near(t time.Time, restarts []time.Time, window time.Duration) bool {
+	if t.IsZero() {
+		return false
+	}
+	for _, r := range restarts {
+		if d := t.Sub(r); d >= -window && d <= window {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeTimes sorts times and drops the ones within window of the one before them, since the last
+// line of a previous instance and the status of the container record the same restart.
+func mergeTimes(times []time.Time, window time.Duration) []time.Time {
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	var out []time.Time
+	for _, t := range times {
+		if len(out) == 0 || t.Sub(out[len(out)-1]) > window {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// readLines reads a log and masks its lines. The messages of JSON and logfmt logs are used as
+// the lines, and lines without a time take the one of the line before them.
+func readLines(lf bundle.LogFile) ([]line, error) {
+	f, err := os.Open(lf.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var raw []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if strings.TrimSpace(sc.Text()) != "" {
+			raw = append(raw, sc.Text())
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	format := logparse.Detect(raw)
+	var (
+		lines []line
+		last  time.Time
+	)
+	for _, r := range raw {
+		rec := logparse.Parse(format, r)
+		if t, err := time.Parse(time.RFC3339Nano, rec.Timestamp); err == nil {
+			last = t
+		}
+		msg := rec.Message
+		if rec.Level != "" {
+			msg = rec.Level + " " + msg
+		}
+		lines = append(lines, line{time: last, template: Template(msg), text: msg, previous: lf.Previous})
+	}
+	return lines, nil
+}
+
+// WriteText writes summaries as text, one table per container.
+func WriteText(w io.Writer, summaries []ContainerSummary) error {
+	for i, s := range summaries {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		name := strings.Join([]string{s.Cluster, s.Namespace, s.Pod}, "/")
+		if s.Container != "" {
+			name += "/" + s.Container
+		}
+		if _, err := fmt.Fprintf(w, "== %s: %d lines, %d templates, %d restarts\n", name, s.Lines, s.Templates, len(s.Restarts)); err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "COUNT\tPREVIOUS\tFIRST\tLAST\tFLAGS\tTEMPLATE")
+		for _, st := range append(append([]*Stat(nil), s.Highlights...), s.Top...) {
+			_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%s\n", st.Count, st.Previous, formatTime(st.First), formatTime(st.Last), st.Flags(), st.Template)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
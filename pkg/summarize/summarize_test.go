@@ -0,0 +1,167 @@
+package summarize
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/astralkn/k8s-logs-extractor/pkg/bundle"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestMergeTimes(t *testing.T) {
+	tests := []struct {
+		name  string
+		times []time.Time
+		want  []time.Time
+	}{
+		{"none", nil, nil},
+		{"sorted", []time.Time{at("2024-03-01T12:00:00Z"), at("2024-03-01T10:00:00Z")}, []time.Time{at("2024-03-01T10:00:00Z"), at("2024-03-01T12:00:00Z")}},
+		{"same restart", []time.Time{at("2024-03-01T10:00:00Z"), at("2024-03-01T09:59:30Z")}, []time.Time{at("2024-03-01T09:59:30Z")}},
+		{"at the window", []time.Time{at("2024-03-01T10:00:00Z"), at("2024-03-01T10:01:00Z")}, []time.Time{at("2024-03-01T10:00:00Z")}},
+		{"past the window", []time.Time{at("2024-03-01T10:00:00Z"), at("2024-03-01T10:01:01Z")}, []time.Time{at("2024-03-01T10:00:00Z"), at("2024-03-01T10:01:01Z")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeTimes(tt.times, time.Minute); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeTimes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNear(t *testing.T) {
+	restarts := []time.Time{at("2024-03-01T10:00:00Z"), at("2024-03-01T12:00:00Z")}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{at("2024-03-01T09:59:00Z"), true},
+		{at("2024-03-01T09:58:59Z"), false},
+		{at("2024-03-01T10:01:00Z"), true},
+		{at("2024-03-01T11:00:00Z"), false},
+		{at("2024-03-01T12:00:30Z"), true},
+		{time.Time{}, false},
+	}
+	for _, tt := range tests {
+		if got := near(tt.t, restarts, time.Minute); got != tt.want {
+			t.Errorf("near(%s) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+// stat is the part of a Stat checked by the tests.
+type stat struct {
+	template                     string
+	count, previous, nearRestart int
+	first, last                  string
+	flags                        string
+}
+
+func stats(sts []*Stat) []stat {
+	var s []stat
+	for _, st := range sts {
+		s = append(s, stat{
+			template: st.Template, count: st.Count, previous: st.Previous, nearRestart: st.NearRestart,
+			first: st.First.UTC().Format(time.RFC3339), last: st.Last.UTC().Format(time.RFC3339), flags: st.Flags(),
+		})
+	}
+	return s
+}
+
+func summaries(t *testing.T, top int) []ContainerSummary {
+	c, err := bundle.LoadCluster("testdata/prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Cluster(c, Options{Top: top, RestartWindow: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 2 || s[0].Container != "app" || s[1].Container != "sidecar" {
+		t.Fatalf("summaries = %+v, want app and sidecar", s)
+	}
+	return s
+}
+
+// The fixture has a previous log of the app container, which stopped right before the restart
+// recorded in its status.
+func TestCluster(t *testing.T) {
+	app := summaries(t, 10)[0]
+	if app.Lines != 12 || app.Templates != 7 {
+		t.Errorf("lines, templates = %d, %d, want 12, 7", app.Lines, app.Templates)
+	}
+	// The last line of the previous log and the status record the same restart.
+	if want := []time.Time{at("2024-03-01T09:59:59Z")}; !reflect.DeepEqual(app.Restarts, want) {
+		t.Errorf("restarts = %v, want %v", app.Restarts, want)
+	}
+	wantTop := []stat{
+		{"request <UUID> served in <NUM>ms", 4, 2, 0, "2024-03-01T09:58:00Z", "2024-03-01T10:06:00Z", ""},
+		{"cache refreshed in <NUM>ms", 2, 0, 0, "2024-03-01T10:07:00Z", "2024-03-01T10:08:00Z", ""},
+		{"health check ok", 1, 0, 0, "2024-03-01T10:09:00Z", "2024-03-01T10:09:00Z", ""},
+	}
+	if got := stats(app.Top); !reflect.DeepEqual(got, wantTop) {
+		t.Errorf("top =\n%+v\nwant\n%+v", got, wantTop)
+	}
+	wantHighlights := []stat{
+		{"dial tcp <IP>: connect: connection refused", 2, 2, 2, "2024-03-01T09:59:57Z", "2024-03-01T09:59:58Z", "only-previous,near-restart"},
+		{"starting server on port <NUM>", 1, 0, 1, "2024-03-01T10:00:05Z", "2024-03-01T10:00:05Z", "near-restart"},
+		{"panic: out of memory", 1, 1, 1, "2024-03-01T09:59:59Z", "2024-03-01T09:59:59Z", "only-previous,near-restart"},
+		// The line without a timestamp takes the time of the line before it.
+		{"goroutine <NUM> [running]:", 1, 1, 1, "2024-03-01T09:59:59Z", "2024-03-01T09:59:59Z", "only-previous,near-restart"},
+	}
+	if got := stats(app.Highlights); !reflect.DeepEqual(got, wantHighlights) {
+		t.Errorf("highlights =\n%+v\nwant\n%+v", got, wantHighlights)
+	}
+
+	sidecar := summaries(t, 10)[1]
+	if sidecar.Restarts != nil || len(sidecar.Highlights) != 0 || len(sidecar.Top) != 1 {
+		t.Errorf("sidecar = %+v, it never restarted", sidecar)
+	}
+}
+
+// Top limits the templates and the highlights kept, the most frequent first.
+func TestClusterTop(t *testing.T) {
+	app := summaries(t, 2)[0]
+	var top, highlights []string
+	for _, st := range app.Top {
+		top = append(top, st.Template)
+	}
+	for _, st := range app.Highlights {
+		highlights = append(highlights, st.Template)
+	}
+	if want := []string{"request <UUID> served in <NUM>ms", "cache refreshed in <NUM>ms"}; !reflect.DeepEqual(top, want) {
+		t.Errorf("top = %q, want %q", top, want)
+	}
+	if want := []string{"dial tcp <IP>: connect: connection refused", "starting server on port <NUM>"}; !reflect.DeepEqual(highlights, want) {
+		t.Errorf("highlights = %q, want %q", highlights, want)
+	}
+	if app.Templates != 7 {
+		t.Errorf("templates = %d, the count is not limited", app.Templates)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteText(&buf, summaries(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"== prod/payments/api-1/app: 12 lines, 7 templates, 1 restarts",
+		"2      2         2024-03-01T09:59:57Z  2024-03-01T09:59:58Z  only-previous,near-restart  dial tcp <IP>: connect: connection refused",
+		"== prod/payments/api-1/sidecar: 1 lines, 1 templates, 0 restarts",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("text does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
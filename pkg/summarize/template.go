@@ -0,0 +1,46 @@
+// Package summarize clusters the lines of container logs into templates.
+package summarize
+
+import (
+	"regexp"
+)
+
+type mask struct {
+	re          *regexp.Regexp
+	placeholder string
+	// minLength leaves shorter matches alone.
+	minLength int
+}
+
+// masks replace the variable parts of a line, most specific first, so that lines differing only
+// by ids, addresses, times or counters share a template.
+var masks = []mask{
+	{re: regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), placeholder: "<TS>"},
+	{re: regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(\.\d+)?\b`), placeholder: "<TS>"},
+	{re: regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), placeholder: "<UUID>"},
+	{re: regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}(:\d+)?\b`), placeholder: "<IP>"},
+	// IPv6 addresses, in full or with a run of zero groups compressed to ::.
+	{re: regexp.MustCompile(`(?i)\b([0-9a-f]{1,4}:){3,7}[0-9a-f]{1,4}\b|\b([0-9a-f]{1,4}:){1,6}(:[0-9a-f]{1,4}){1,6}\b|\b[0-9a-f]{1,4}::|::[0-9a-f]{1,4}\b`), placeholder: "<IP>"},
+	{re: regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), placeholder: "<HEX>"},
+	// Hashes and container ids mix digits and letters. Short words such as "v1" or "sha1" do not
+	// reach the minimum length.
+	{re: regexp.MustCompile(`(?i)\b[0-9a-f]*(\d[0-9a-f]*[a-f]|[a-f][0-9a-f]*\d)[0-9a-f]*\b`), placeholder: "<HEX>", minLength: 8},
+	{re: regexp.MustCompile(`[-+]?\b\d+(\.\d+)*`), placeholder: "<NUM>"},
+}
+
+// Template returns line with its variable parts masked.
+func Template(line string) string {
+	for _, m := range masks {
+		if m.minLength == 0 {
+			line = m.re.ReplaceAllString(line, m.placeholder)
+			continue
+		}
+		line = m.re.ReplaceAllStringFunc(line, func(s string) string {
+			if len(s) < m.minLength {
+				return s
+			}
+			return m.placeholder
+		})
+	}
+	return line
+}
@@ -0,0 +1,35 @@
+package summarize
+
+import "testing"
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"2024-03-01T10:00:00.123Z started", "<TS> started"},
+		{"2024-03-01 10:00:00+01:00 started", "<TS> started"},
+		{"done at 10:00:01.5", "done at <TS>"},
+		{"request 3F1C2A9E-4b7d-4c1e-9a2b-1c2d3e4f5a6b served", "request <UUID> served"},
+		{"dial tcp 10.0.0.5:5432: connect: connection refused", "dial tcp <IP>: connect: connection refused"},
+		{"from 192.168.1.20 to 10.0.0.1", "from <IP> to <IP>"},
+		{"via 2001:db8:0:0:8a2e:370:7334", "via <IP>"},
+		{"via 2001:db8::8a2e:370:7334", "via <IP>"},
+		{"bind [::1]:8080", "bind [<IP>]:<NUM>"},
+		{"listening on fe80::", "listening on <IP>"},
+		{"std::string and Foo::Bar", "std::string and Foo::Bar"},
+		{"fault at 0x7ffd1234", "fault at <HEX>"},
+		{"container 3b1f0c2d9e8a7f6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b started", "container <HEX> started"},
+		{"commit abc12345", "commit <HEX>"},
+		{"api v1 uses sha1 and a1b2c3", "api v1 uses sha1 and a1b2c3"},
+		{"cafebabe deadbeef", "cafebabe deadbeef"},
+		{"took 12.5ms, retry -3 of +4", "took <NUM>ms, retry <NUM> of <NUM>"},
+		{"version 1.2.3", "version <NUM>"},
+		{"no variable part", "no variable part"},
+	}
+	for _, tt := range tests {
+		if got := Template(tt.line); got != tt.want {
+			t.Errorf("Template(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}